@@ -0,0 +1,60 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// analyzeBufferSize is the number of samples Analyze reads at a time.
+const analyzeBufferSize = 8192
+
+// Analyze reads f to the end and returns its peak absolute sample and its RMS
+// level in dBFS, relative to a full-scale square wave, so a full-scale sine
+// measures about -3 dBFS. Silence, or an empty stream, measures -Inf dBFS. A
+// peak at the most negative sample, whose magnitude an int32 cannot hold, is
+// reported as the largest positive one.
+// Analyze consumes the stream: to encode f afterwards, Seek it back to the
+// start if it implements Seeker, or open it again.
+func Analyze(f Format) (peak int32, rmsDBFS float64, err error) {
+	bitDepth := f.BitDepth()
+	if bitDepth < 1 || bitDepth > 32 {
+		return 0, 0, fmt.Errorf("invalid bit depth: %d", bitDepth)
+	}
+
+	var maxAbs int64
+	var sumSquares float64
+	var count uint64
+	buffer := make([]int32, analyzeBufferSize)
+	for {
+		n, err := f.ReadSamples(buffer)
+		for _, s := range buffer[:n] {
+			v := int64(s)
+			if v < 0 {
+				v = -v
+			}
+			if v > maxAbs {
+				maxAbs = v
+			}
+			sumSquares += float64(s) * float64(s)
+		}
+		count += uint64(n)
+		if err == io.EOF || (err == nil && n == 0) {
+			break
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("error reading samples: %w", err)
+		}
+	}
+
+	// The most negative sample's magnitude does not fit an int32
+	if maxAbs > math.MaxInt32 {
+		maxAbs = math.MaxInt32
+	}
+	if count == 0 || sumSquares == 0 {
+		return int32(maxAbs), math.Inf(-1), nil
+	}
+	fullScale := float64(int64(1) << (bitDepth - 1))
+	rms := math.Sqrt(sumSquares / float64(count))
+	return int32(maxAbs), 20 * math.Log10(rms/fullScale), nil
+}
@@ -0,0 +1,69 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	const count = 48000
+
+	sine := make([]int32, count)
+	for i := range sine {
+		sine[i] = int32(math.Round(math.Sin(2*math.Pi*1000*float64(i)/48000) * 32767))
+	}
+	square := make([]int32, count)
+	for i := range square {
+		square[i] = 32767
+		if (i/24)%2 == 1 {
+			square[i] = -32767
+		}
+	}
+	half := make([]int32, count)
+	for i := range half {
+		half[i] = sine[i] / 2
+	}
+
+	tests := []struct {
+		name         string
+		samples      []int32
+		bitDepth     int
+		expectedPeak int32
+		expectedRMS  float64 // dBFS
+	}{
+		{name: "Full-scale sine", samples: sine, bitDepth: 16, expectedPeak: 32767, expectedRMS: -3.01},
+		{name: "Full-scale square", samples: square, bitDepth: 16, expectedPeak: 32767, expectedRMS: 0},
+		{name: "Half-scale sine", samples: half, bitDepth: 16, expectedPeak: 16383, expectedRMS: -9.03},
+		{name: "Most negative 32-bit sample", samples: []int32{math.MinInt32, 0}, bitDepth: 32, expectedPeak: math.MaxInt32, expectedRMS: -3.01},
+		{name: "Silence", samples: make([]int32, 100), bitDepth: 16, expectedRMS: math.Inf(-1)},
+		{name: "Empty", bitDepth: 16, expectedRMS: math.Inf(-1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewMemoryFormat(tt.samples, 48000, 1, tt.bitDepth)
+			if err != nil {
+				t.Fatalf("NewMemoryFormat failed: %v", err)
+			}
+			peak, rms, err := Analyze(f)
+			if err != nil {
+				t.Fatalf("Analyze failed: %v", err)
+			}
+			if peak != tt.expectedPeak {
+				t.Errorf("expected peak %d, got %d", tt.expectedPeak, peak)
+			}
+			if math.IsInf(tt.expectedRMS, -1) {
+				if !math.IsInf(rms, -1) {
+					t.Errorf("expected -Inf dBFS, got %v", rms)
+				}
+			} else if math.Abs(rms-tt.expectedRMS) > 0.02 {
+				t.Errorf("expected RMS %.2f dBFS, got %.2f", tt.expectedRMS, rms)
+			}
+
+			// The stream is consumed
+			if n, _ := f.ReadSamples(make([]int32, 1)); n != 0 {
+				t.Errorf("expected the stream to be consumed, read %d more samples", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package audio
+
+import "fmt"
+
+// ClipGuardFormat clamps the samples of a Format to the range of its bit
+// depth, counting the samples it clamps.
+type ClipGuardFormat struct {
+	Format
+	clipped uint64
+}
+
+// ClipGuard returns a Format passing on the samples of f, with any beyond the
+// signed range of f's bit depth clamped to full scale rather than left to wrap
+// around when they are cut down to that many bits, as the encoder does. Such
+// samples come from sources that overshoot, such as float input above 1.0 or
+// the ringing of a resampling filter. The result can be seeked if f can.
+func ClipGuard(f Format) *ClipGuardFormat {
+	return &ClipGuardFormat{Format: f}
+}
+
+// ReadSamples reads samples from the source and clamps them in place.
+func (c *ClipGuardFormat) ReadSamples(buffer []int32) (int, error) {
+	n, err := c.Format.ReadSamples(buffer)
+	bits := c.Format.BitDepth()
+	if bits < 1 || bits >= 32 {
+		return n, err // every int32 is in range
+	}
+
+	lowest, highest := int32(-1)<<(bits-1), int32(1)<<(bits-1)-1
+	for i, s := range buffer[:n] {
+		switch {
+		case s > highest:
+			buffer[i] = highest
+		case s < lowest:
+			buffer[i] = lowest
+		default:
+			continue
+		}
+		c.clipped++
+	}
+	return n, err
+}
+
+// Clipped returns the number of samples clamped so far, counting each channel
+// of an inter-channel sample separately.
+func (c *ClipGuardFormat) Clipped() uint64 {
+	return c.clipped
+}
+
+// Seek moves to the sample at sampleIndex if the source implements Seeker.
+// The count of clipped samples is kept.
+func (c *ClipGuardFormat) Seek(sampleIndex uint64) error {
+	seeker, ok := c.Format.(Seeker)
+	if !ok {
+		return fmt.Errorf("source format cannot seek")
+	}
+	return seeker.Seek(sampleIndex)
+}
@@ -0,0 +1,76 @@
+package audio
+
+import (
+	"reflect"
+	"testing"
+)
+
+// overshootFormat serves samples in memory without checking them against
+// its bit depth, like a source whose processing overshot full scale.
+type overshootFormat struct {
+	*MemoryFormat
+	bitDepth int
+}
+
+func (f *overshootFormat) BitDepth() int { return f.bitDepth }
+
+func TestClipGuard(t *testing.T) {
+	tests := []struct {
+		name     string
+		samples  []int32
+		bitDepth int
+		expected []int32
+		clipped  uint64
+	}{
+		{
+			name:     "16-bit",
+			samples:  []int32{32767, 32768, 40000, -32768, -32769, -100000, 0},
+			bitDepth: 16,
+			expected: []int32{32767, 32767, 32767, -32768, -32768, -32768, 0},
+			clipped:  4,
+		},
+		{
+			name:     "24-bit in range",
+			samples:  []int32{8388607, -8388608, 1},
+			bitDepth: 24,
+			expected: []int32{8388607, -8388608, 1},
+		},
+		{
+			name:     "8-bit",
+			samples:  []int32{128, -129, 127},
+			bitDepth: 8,
+			expected: []int32{127, -128, 127},
+			clipped:  2,
+		},
+		{
+			name:     "32-bit",
+			samples:  []int32{2147483647, -2147483648},
+			bitDepth: 32,
+			expected: []int32{2147483647, -2147483648},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewMemoryFormat(tt.samples, 44100, 1, 32)
+			if err != nil {
+				t.Fatalf("NewMemoryFormat failed: %v", err)
+			}
+			guard := ClipGuard(&overshootFormat{MemoryFormat: source, bitDepth: tt.bitDepth})
+			if got := readAll(t, guard, 3); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			if guard.Clipped() != tt.clipped {
+				t.Errorf("expected %d clipped samples, got %d", tt.clipped, guard.Clipped())
+			}
+
+			if err := guard.Seek(0); err != nil {
+				t.Fatalf("Seek failed: %v", err)
+			}
+			readAll(t, guard, 3)
+			if guard.Clipped() != 2*tt.clipped {
+				t.Errorf("expected %d clipped samples after reading twice, got %d", 2*tt.clipped, guard.Clipped())
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// concatenated plays a list of Formats one after the other.
+type concatenated struct {
+	formats []Format
+	current int // index in formats of the source being read
+}
+
+// Concat returns a Format playing formats one after the other, as for a
+// recording split across several files. Every format must have the same
+// sample rate, channel count and bit depth. The total sample count is the sum
+// of those of formats, and the result can be seeked if every format can. A
+// single format is returned as is.
+func Concat(formats ...Format) (Format, error) {
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("no formats to concatenate")
+	}
+	first := formats[0]
+	for i, f := range formats[1:] {
+		if f.SampleRate() != first.SampleRate() || f.Channels() != first.Channels() || f.BitDepth() != first.BitDepth() {
+			return nil, fmt.Errorf("format %d has %d Hz, %d channels and %d bits, expected %d Hz, %d channels and %d bits",
+				i+1, f.SampleRate(), f.Channels(), f.BitDepth(), first.SampleRate(), first.Channels(), first.BitDepth())
+		}
+	}
+	if len(formats) == 1 {
+		return first, nil
+	}
+	return &concatenated{formats: formats}, nil
+}
+
+// SampleRate returns the sample rate shared by the sources.
+func (c *concatenated) SampleRate() int {
+	return c.formats[0].SampleRate()
+}
+
+// Channels returns the channel count shared by the sources.
+func (c *concatenated) Channels() int {
+	return c.formats[0].Channels()
+}
+
+// BitDepth returns the bit depth shared by the sources.
+func (c *concatenated) BitDepth() int {
+	return c.formats[0].BitDepth()
+}
+
+// TotalSamples returns the sum of the sources' sample counts.
+func (c *concatenated) TotalSamples() uint64 {
+	var total uint64
+	for _, f := range c.formats {
+		total += f.TotalSamples()
+	}
+	return total
+}
+
+// Duration returns the playing time of all the sources together.
+func (c *concatenated) Duration() time.Duration {
+	return duration(c.TotalSamples(), c.SampleRate())
+}
+
+// ReadSamples reads from the current source, moving on to the next once it is
+// exhausted. It returns io.EOF after the last source.
+func (c *concatenated) ReadSamples(buffer []int32) (int, error) {
+	if len(buffer) == 0 {
+		return 0, nil
+	}
+	for c.current < len(c.formats) {
+		n, err := c.formats[c.current].ReadSamples(buffer)
+		if err == io.EOF || (err == nil && n == 0) {
+			c.current++
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+	return 0, io.EOF
+}
+
+// Seek moves to the inter-channel sample at sampleIndex, counted from the
+// start of the first source, if every source implements Seeker. Seeking to
+// TotalSamples is allowed and leaves nothing more to read.
+func (c *concatenated) Seek(sampleIndex uint64) error {
+	seekers := make([]Seeker, len(c.formats))
+	for i, f := range c.formats {
+		seeker, ok := f.(Seeker)
+		if !ok {
+			return fmt.Errorf("source format %d cannot seek", i)
+		}
+		seekers[i] = seeker
+	}
+	if total := c.TotalSamples(); sampleIndex > total {
+		return fmt.Errorf("seek to sample %d out of range: %d samples", sampleIndex, total)
+	}
+
+	// Find the source holding the sample, and rewind those after it so they
+	// play from the start once it is exhausted
+	current := len(c.formats) - 1
+	offset := sampleIndex
+	for i, f := range c.formats {
+		if offset < f.TotalSamples() {
+			current = i
+			break
+		}
+		if i < len(c.formats)-1 {
+			offset -= f.TotalSamples()
+		}
+	}
+	if err := seekers[current].Seek(offset); err != nil {
+		return err
+	}
+	for _, seeker := range seekers[current+1:] {
+		if err := seeker.Seek(0); err != nil {
+			return err
+		}
+	}
+	c.current = current
+	return nil
+}
@@ -0,0 +1,97 @@
+package audio
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// rampFormat returns a Format of count stereo samples at 8000 Hz, each
+// holding its index plus start in both channels.
+func rampFormat(t *testing.T, start, count int) *MemoryFormat {
+	t.Helper()
+	samples := make([]int32, 2*count)
+	for i := range samples {
+		samples[i] = int32(start + i/2)
+	}
+	f, err := NewMemoryFormat(samples, 8000, 2, 16)
+	if err != nil {
+		t.Fatalf("NewMemoryFormat failed: %v", err)
+	}
+	return f
+}
+
+func TestConcat(t *testing.T) {
+	first, second := rampFormat(t, 0, 8000), rampFormat(t, 8000, 8000)
+	f, err := Concat(&trickleFormat{MemoryFormat: first, max: 999}, second)
+	if err != nil {
+		t.Fatalf("Concat failed: %v", err)
+	}
+	if f.TotalSamples() != 16000 || f.Duration() != 2*time.Second {
+		t.Errorf("expected 16000 samples lasting 2s, got %d lasting %v", f.TotalSamples(), f.Duration())
+	}
+	if f.SampleRate() != 8000 || f.Channels() != 2 || f.BitDepth() != 16 {
+		t.Errorf("expected 8000 Hz, 2 channels and 16 bits, got %d Hz, %d channels and %d bits", f.SampleRate(), f.Channels(), f.BitDepth())
+	}
+	if got, want := readAll(t, f, 1024), rampFormat(t, 0, 16000).samples; !reflect.DeepEqual(got, want) {
+		t.Errorf("concatenated samples differ from the two inputs in turn")
+	}
+
+	// Seek into each source and to the end
+	for _, index := range []uint64{12000, 3, 8000, 16000} {
+		if err := f.(Seeker).Seek(index); err != nil {
+			t.Fatalf("Seek(%d) failed: %v", index, err)
+		}
+		got := readAll(t, f, 1024)
+		want := rampFormat(t, int(index), 16000-int(index)).samples
+		if len(got) != len(want) || (len(want) > 0 && !reflect.DeepEqual(got, want)) {
+			t.Errorf("after Seek(%d): expected %d values from %d, got %d", index, len(want), index, len(got))
+		}
+	}
+	if err := f.(Seeker).Seek(16001); err == nil {
+		t.Errorf("expected an error seeking past the end")
+	}
+
+	if single, err := Concat(first); err != nil || single != Format(first) {
+		t.Errorf("expected a single format to be returned as is, got %v, %v", single, err)
+	}
+}
+
+func TestConcatInvalid(t *testing.T) {
+	stereo := rampFormat(t, 0, 10)
+	mono, _ := NewMemoryFormat([]int32{1, 2, 3}, 8000, 1, 16)
+	fast, _ := NewMemoryFormat([]int32{1, 2}, 44100, 2, 16)
+	wide, _ := NewMemoryFormat([]int32{1, 2}, 8000, 2, 24)
+
+	tests := []struct {
+		name        string
+		formats     []Format
+		expectedErr string
+	}{
+		{name: "No formats", expectedErr: "no formats to concatenate"},
+		{
+			name:        "Channel mismatch",
+			formats:     []Format{stereo, mono},
+			expectedErr: "format 1 has 8000 Hz, 1 channels and 16 bits, expected 8000 Hz, 2 channels and 16 bits",
+		},
+		{
+			name:        "Sample rate mismatch",
+			formats:     []Format{stereo, stereo, fast},
+			expectedErr: "format 2 has 44100 Hz, 2 channels and 16 bits, expected 8000 Hz, 2 channels and 16 bits",
+		},
+		{
+			name:        "Bit depth mismatch",
+			formats:     []Format{stereo, wide},
+			expectedErr: "format 1 has 8000 Hz, 2 channels and 24 bits, expected 8000 Hz, 2 channels and 16 bits",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Concat(tt.formats...)
+			if err == nil || err.Error() != tt.expectedErr {
+				t.Errorf("expected error %q, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+)
+
+// downmixed averages the channels of a Format into one.
+type downmixed struct {
+	Format
+	channels int
+	buffer   []int32 // interleaved source samples, starting with any incomplete one carried over
+	carried  int     // values of an incomplete inter-channel sample at the start of buffer
+}
+
+// Downmix returns a mono Format whose every sample is the average of the
+// channels of the corresponding sample of f, rounded to the nearest integer
+// with halves rounded away from zero. The average of in-range samples is in
+// range, so the mix never clips. The bit depth, sample rate and total sample
+// count are those of f, and the result can be seeked if f can. A mono f is
+// returned as is.
+func Downmix(f Format) Format {
+	if f.Channels() == 1 {
+		return f
+	}
+	return &downmixed{Format: f, channels: f.Channels()}
+}
+
+// Channels returns 1.
+func (d *downmixed) Channels() int {
+	return 1
+}
+
+// ReadSamples reads inter-channel samples of the source and writes the
+// average of each to buffer. Values of an incomplete inter-channel sample
+// returned by a short read are held until the rest arrive.
+func (d *downmixed) ReadSamples(buffer []int32) (int, error) {
+	if len(buffer) == 0 {
+		return 0, nil
+	}
+	if size := len(buffer) * d.channels; cap(d.buffer) < size {
+		grown := make([]int32, size)
+		copy(grown, d.buffer[:d.carried])
+		d.buffer = grown
+	}
+	source := d.buffer[:len(buffer)*d.channels]
+
+	// Read until at least one whole sample is in, so a short read is never
+	// mistaken for the end of the stream
+	n := d.carried
+	for n < d.channels {
+		read, err := d.Format.ReadSamples(source[n:])
+		n += read
+		if err == io.EOF || (err == nil && read == 0) {
+			break
+		}
+		if err != nil {
+			d.carried = n
+			return 0, err
+		}
+	}
+
+	count := n / d.channels
+	for i := 0; i < count; i++ {
+		var sum int64
+		for _, s := range source[i*d.channels : (i+1)*d.channels] {
+			sum += int64(s)
+		}
+		buffer[i] = int32(roundedQuotient(sum, int64(d.channels)))
+	}
+	d.carried = copy(source, source[count*d.channels:n])
+	if count == 0 {
+		return 0, io.EOF
+	}
+	return count, nil
+}
+
+// roundedQuotient divides n by a positive d, rounding halves away from zero.
+func roundedQuotient(n, d int64) int64 {
+	if n < 0 {
+		return -((-n + d/2) / d)
+	}
+	return (n + d/2) / d
+}
+
+// Seek moves to the inter-channel sample at sampleIndex if the source
+// implements Seeker.
+func (d *downmixed) Seek(sampleIndex uint64) error {
+	seeker, ok := d.Format.(Seeker)
+	if !ok {
+		return fmt.Errorf("source format cannot seek")
+	}
+	if err := seeker.Seek(sampleIndex); err != nil {
+		return err
+	}
+	d.carried = 0
+	return nil
+}
@@ -0,0 +1,117 @@
+package audio
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+// trickleFormat returns at most max values per ReadSamples call, splitting
+// inter-channel samples across calls.
+type trickleFormat struct {
+	*MemoryFormat
+	max int
+}
+
+func (f *trickleFormat) ReadSamples(buffer []int32) (int, error) {
+	if len(buffer) > f.max {
+		buffer = buffer[:f.max]
+	}
+	return f.MemoryFormat.ReadSamples(buffer)
+}
+
+// readAll reads f to the end, buffer values at a time.
+func readAll(t *testing.T, f Format, buffer int) []int32 {
+	t.Helper()
+	var all []int32
+	buf := make([]int32, buffer)
+	for {
+		n, err := f.ReadSamples(buf)
+		all = append(all, buf[:n]...)
+		if err == io.EOF {
+			return all
+		}
+		if err != nil {
+			t.Fatalf("ReadSamples failed: %v", err)
+		}
+	}
+}
+
+func TestDownmix(t *testing.T) {
+	tests := []struct {
+		name     string
+		samples  []int32
+		channels int
+		bitDepth int
+		expected []int32
+	}{
+		{
+			name:     "Hard-panned left",
+			samples:  []int32{1000, 0, -1000, 0, 3, 0, -3, 0, 32767, 0, -32768, 0},
+			channels: 2,
+			bitDepth: 16,
+			expected: []int32{500, -500, 2, -2, 16384, -16384},
+		},
+		{
+			name:     "Hard-panned right",
+			samples:  []int32{0, 1000, 0, -1000, 0, 1, 0, -1},
+			channels: 2,
+			bitDepth: 16,
+			expected: []int32{500, -500, 1, -1},
+		},
+		{
+			name:     "Centred at full scale",
+			samples:  []int32{32767, 32767, -32768, -32768},
+			channels: 2,
+			bitDepth: 16,
+			expected: []int32{32767, -32768},
+		},
+		{
+			name:     "Three channels",
+			samples:  []int32{3, 3, 4, -1, -1, 0, 8388607, 8388607, 8388607},
+			channels: 3,
+			bitDepth: 24,
+			expected: []int32{3, -1, 8388607},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, max := range []int{1, 3, len(tt.samples)} {
+				source, err := NewMemoryFormat(tt.samples, 44100, tt.channels, tt.bitDepth)
+				if err != nil {
+					t.Fatalf("NewMemoryFormat failed: %v", err)
+				}
+				mono := Downmix(&trickleFormat{MemoryFormat: source, max: max})
+				if mono.Channels() != 1 || mono.BitDepth() != tt.bitDepth || mono.TotalSamples() != uint64(len(tt.expected)) {
+					t.Errorf("expected 1 channel of %d bits and %d samples, got %d channels of %d bits and %d samples",
+						tt.bitDepth, len(tt.expected), mono.Channels(), mono.BitDepth(), mono.TotalSamples())
+				}
+				if got := readAll(t, mono, 2); !reflect.DeepEqual(got, tt.expected) {
+					t.Errorf("reading %d values at a time: expected %v, got %v", max, tt.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestDownmixSeek(t *testing.T) {
+	source, err := NewMemoryFormat([]int32{2, 4, 6, 8, 10, 12}, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("NewMemoryFormat failed: %v", err)
+	}
+	mono := Downmix(source)
+	readAll(t, mono, 4)
+	if err := mono.(Seeker).Seek(1); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if got := readAll(t, mono, 4); !reflect.DeepEqual(got, []int32{7, 11}) {
+		t.Errorf("expected [7 11] after seeking, got %v", got)
+	}
+
+	// Embedding the interface hides the source's Seek method
+	unseekable := struct{ Format }{source}
+	if mono := Downmix(unseekable); mono.(Seeker).Seek(0) == nil {
+		t.Errorf("expected an error seeking a source that cannot seek")
+	}
+}
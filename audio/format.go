@@ -1,9 +1,35 @@
 package audio
 
+import "time"
+
+// Format is a source of interleaved integer samples. Samples are held in an
+// int32, so bit depths of up to 32 are supported; a full-scale 32-bit sample
+// uses the whole int32 range.
 type Format interface {
 	SampleRate() int
 	Channels() int
 	BitDepth() int
 	TotalSamples() uint64
 	ReadSamples([]int32) (int, error)
+	Duration() time.Duration
+}
+
+// Seeker is implemented by formats that can reposition their input to an
+// arbitrary sample. Sources that can only be read once, such as pipes, need
+// not implement it.
+type Seeker interface {
+	// Seek moves to the inter-channel sample at sampleIndex, so the next
+	// ReadSamples call starts with its first channel.
+	Seek(sampleIndex uint64) error
+}
+
+// duration converts a count of inter-channel samples at sampleRate to a
+// time.Duration, returning 0 when the sample rate is unknown.
+func duration(totalSamples uint64, sampleRate int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	seconds := totalSamples / uint64(sampleRate)
+	rest := totalSamples % uint64(sampleRate)
+	return time.Duration(seconds)*time.Second + time.Duration(rest)*time.Second/time.Duration(sampleRate)
 }
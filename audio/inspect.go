@@ -0,0 +1,90 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// WAVInfo describes a WAV file as found by InspectWAV.
+type WAVInfo struct {
+	SampleRate  int
+	Channels    int
+	BitDepth    int // as ReadSamples delivers it: the float target depth for IEEE float files
+	Duration    time.Duration
+	AudioFormat string   // name of the audio format, such as "PCM" or "extensible IEEE float"
+	DataSize    uint64   // size of the data chunk in bytes, from the ds64 chunk of RF64 files
+	OtherChunks []string // IDs of the chunks other than fmt and data, in file order
+}
+
+// InspectWAV reads the header and chunk list of the WAV file at path without
+// decoding any audio, for checking files before encoding them. It fails with
+// the same errors as NewWAVFormat, so a file it accepts can be encoded. The
+// file is closed before it returns.
+func InspectWAV(path string) (*WAVInfo, error) {
+	wav, err := NewWAVFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	defer wav.Close()
+
+	others, err := otherChunks(wav.r)
+	if err != nil {
+		return nil, err
+	}
+	return &WAVInfo{
+		SampleRate:  wav.SampleRate(),
+		Channels:    wav.Channels(),
+		BitDepth:    wav.BitDepth(),
+		Duration:    wav.Duration(),
+		AudioFormat: wav.formatName(),
+		DataSize:    wav.dataSize(),
+		OtherChunks: others,
+	}, nil
+}
+
+// formatName names the audio format, looking through WAVE_FORMAT_EXTENSIBLE to
+// its sub-format.
+func (w *WAVFormat) formatName() string {
+	name, ok := wavFormatNames[w.formatCode()]
+	if !ok {
+		name = "unknown"
+	}
+	if w.AudioFormat == WAVFormatExtensible {
+		return "extensible " + name
+	}
+	return name
+}
+
+// otherChunks walks every chunk of a RIFF file and returns the IDs of those
+// other than fmt and data. A final chunk cut short by the end of the file,
+// such as a data chunk whose size was never patched, ends the walk quietly.
+func otherChunks(r io.ReadSeeker) ([]string, error) {
+	var others []string
+	offset := int64(12) // past "RIFF", the RIFF size and "WAVE"
+	for {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("error seeking to chunk: %w", err)
+		}
+		var id [4]byte
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return others, nil
+			}
+			return nil, fmt.Errorf("error reading chunk ID: %w", err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return others, nil
+			}
+			return nil, fmt.Errorf("error reading %q chunk size: %w", id, err)
+		}
+
+		if name := string(id[:]); name != "fmt " && name != "data" {
+			others = append(others, name)
+		}
+		offset += 8 + int64(size) + int64(size%2)
+	}
+}
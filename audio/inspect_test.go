@@ -0,0 +1,94 @@
+package audio
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInspectWAVSample(t *testing.T) {
+	info, err := InspectWAV(sampleWavPath)
+	if err != nil {
+		t.Fatalf("InspectWAV failed: %v", err)
+	}
+	if info.SampleRate != int(expectedSampleRate) || info.Channels != int(expectedChannels) || info.BitDepth != int(expectedBitDepth) {
+		t.Errorf("expected %d Hz, %d channels, %d bits, got %d Hz, %d channels, %d bits",
+			expectedSampleRate, expectedChannels, expectedBitDepth, info.SampleRate, info.Channels, info.BitDepth)
+	}
+	if info.AudioFormat != "PCM" {
+		t.Errorf("expected PCM, got %q", info.AudioFormat)
+	}
+	if info.DataSize == 0 || info.Duration == 0 {
+		t.Errorf("expected a data size and duration, got %d bytes and %v", info.DataSize, info.Duration)
+	}
+}
+
+func TestInspectWAV(t *testing.T) {
+	pcm := []byte{1, 0, 2, 0, 3, 0, 4, 0}
+	list := chunk("LIST", append([]byte("INFO"), chunk("INAM", []byte("Title"))...))
+
+	tests := []struct {
+		name        string
+		path        func(t *testing.T) string
+		expected    *WAVInfo
+		expectedErr bool
+	}{
+		{
+			name: "Chunks around the data",
+			path: func(t *testing.T) string {
+				return writeTempWAV(t, riffWAV(chunk("JUNK", make([]byte, 3)), chunk("fmt ", fmtBody(WAVFormatPCM, 2, 8000, 16, nil)), chunk("data", pcm), list))
+			},
+			expected: &WAVInfo{
+				SampleRate:  8000,
+				Channels:    2,
+				BitDepth:    16,
+				Duration:    250 * time.Microsecond,
+				AudioFormat: "PCM",
+				DataSize:    8,
+				OtherChunks: []string{"JUNK", "LIST"},
+			},
+		},
+		{
+			name: "Extensible float",
+			path: func(t *testing.T) string {
+				fmtChunk := fmtBody(WAVFormatExtensible, 1, 48000, 32, extensibleExtension(WAVFormatIEEEFloat, 32))
+				return writeTempWAV(t, riffWAV(chunk("fmt ", fmtChunk), chunk("data", pcm)))
+			},
+			expected: &WAVInfo{
+				SampleRate:  48000,
+				Channels:    1,
+				BitDepth:    DefaultFloatBitDepth,
+				Duration:    time.Second * 2 / 48000,
+				AudioFormat: "extensible IEEE float",
+				DataSize:    8,
+			},
+		},
+		{
+			name: "Unsupported format",
+			path: func(t *testing.T) string {
+				return writeTempWAV(t, riffWAV(chunk("fmt ", fmtBody(WAVFormatALaw, 1, 8000, 8, []byte{0, 0})), chunk("data", pcm)))
+			},
+			expectedErr: true,
+		},
+		{
+			name:        "Missing file",
+			path:        func(t *testing.T) string { return nonExistentWavPath },
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := InspectWAV(tt.path(t))
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(info, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, info)
+			}
+		})
+	}
+}
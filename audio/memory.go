@@ -0,0 +1,95 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// MemoryFormat serves interleaved samples held in memory, for tests,
+// benchmarks and audio generated by the caller rather than read from a file.
+type MemoryFormat struct {
+	sampleRate int
+	channels   int
+	bitDepth   int
+	samples    []int32
+	pos        int // index of the next value to read
+}
+
+// NewMemoryFormat returns a Format over samples, which are interleaved by
+// channel and must fit in bitDepth bits as signed integers. samples must hold
+// whole inter-channel samples and is not copied.
+func NewMemoryFormat(samples []int32, sampleRate, channels, bitDepth int) (*MemoryFormat, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	if channels <= 0 {
+		return nil, fmt.Errorf("invalid number of channels: %d", channels)
+	}
+	if bitDepth < 1 || bitDepth > 32 {
+		return nil, fmt.Errorf("unsupported bit depth: %d", bitDepth)
+	}
+	if len(samples)%channels != 0 {
+		return nil, fmt.Errorf("%d samples do not divide into %d channels", len(samples), channels)
+	}
+
+	lo, hi := int64(-1)<<(bitDepth-1), int64(1)<<(bitDepth-1)-1
+	for i, s := range samples {
+		if int64(s) < lo || int64(s) > hi {
+			return nil, fmt.Errorf("sample %d out of range for %d bits: %d", i, bitDepth, s)
+		}
+	}
+
+	return &MemoryFormat{
+		sampleRate: sampleRate,
+		channels:   channels,
+		bitDepth:   bitDepth,
+		samples:    samples,
+	}, nil
+}
+
+// SampleRate returns the sample rate given to NewMemoryFormat.
+func (m *MemoryFormat) SampleRate() int {
+	return m.sampleRate
+}
+
+// Channels returns the number of channels given to NewMemoryFormat.
+func (m *MemoryFormat) Channels() int {
+	return m.channels
+}
+
+// BitDepth returns the bit depth given to NewMemoryFormat.
+func (m *MemoryFormat) BitDepth() int {
+	return m.bitDepth
+}
+
+// TotalSamples returns the number of inter-channel samples held.
+func (m *MemoryFormat) TotalSamples() uint64 {
+	return uint64(len(m.samples) / m.channels)
+}
+
+// Duration returns the playing time of the samples held.
+func (m *MemoryFormat) Duration() time.Duration {
+	return duration(m.TotalSamples(), m.sampleRate)
+}
+
+// Seek moves to the inter-channel sample at sampleIndex. Seeking to
+// TotalSamples is allowed and leaves nothing more to read.
+func (m *MemoryFormat) Seek(sampleIndex uint64) error {
+	if sampleIndex > m.TotalSamples() {
+		return fmt.Errorf("seek to sample %d out of range: %d samples", sampleIndex, m.TotalSamples())
+	}
+	m.pos = int(sampleIndex) * m.channels
+	return nil
+}
+
+// ReadSamples copies the next samples into buffer, returning io.EOF once
+// every sample has been read.
+func (m *MemoryFormat) ReadSamples(buffer []int32) (int, error) {
+	if m.pos >= len(m.samples) && len(buffer) > 0 {
+		return 0, io.EOF
+	}
+	n := copy(buffer, m.samples[m.pos:])
+	m.pos += n
+	return n, nil
+}
@@ -0,0 +1,125 @@
+package audio
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewMemoryFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		samples     []int32
+		channels    int
+		bitDepth    int
+		expectedErr bool
+	}{
+		{
+			name:     "16-bit stereo",
+			samples:  []int32{1, -1, -32768, 32767},
+			channels: 2,
+			bitDepth: 16,
+		},
+		{
+			name:     "24-bit with 8 channels",
+			samples:  []int32{-8388608, 8388607, 0, 1, 2, 3, 4, 5},
+			channels: 8,
+			bitDepth: 24,
+		},
+		{
+			name:     "No samples",
+			channels: 1,
+			bitDepth: 16,
+		},
+		{
+			name:        "Partial inter-channel sample",
+			samples:     []int32{1, 2, 3},
+			channels:    2,
+			bitDepth:    16,
+			expectedErr: true,
+		},
+		{
+			name:        "Sample out of range",
+			samples:     []int32{128},
+			channels:    1,
+			bitDepth:    8,
+			expectedErr: true,
+		},
+		{
+			name:        "Unsupported bit depth",
+			channels:    1,
+			bitDepth:    33,
+			expectedErr: true,
+		},
+		{
+			name:        "No channels",
+			channels:    0,
+			bitDepth:    16,
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMemoryFormat(tt.samples, 44100, tt.channels, tt.bitDepth)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if want := uint64(len(tt.samples) / tt.channels); m.TotalSamples() != want {
+				t.Errorf("expected %d total samples, got %d", want, m.TotalSamples())
+			}
+			if m.Channels() != tt.channels || m.BitDepth() != tt.bitDepth || m.SampleRate() != 44100 {
+				t.Errorf("unexpected format: %d channels, %d bits, %d Hz", m.Channels(), m.BitDepth(), m.SampleRate())
+			}
+
+			var got []int32
+			buffer := make([]int32, 3)
+			for {
+				n, err := m.ReadSamples(buffer)
+				got = append(got, buffer[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("ReadSamples failed: %v", err)
+				}
+			}
+			if len(got) != len(tt.samples) || (len(got) > 0 && !reflect.DeepEqual(got, tt.samples)) {
+				t.Errorf("expected samples %v, got %v", tt.samples, got)
+			}
+		})
+	}
+}
+
+func TestMemoryFormatSeek(t *testing.T) {
+	m, err := NewMemoryFormat([]int32{1, 2, 3, 4, 5, 6}, 2, 2, 16)
+	if err != nil {
+		t.Fatalf("NewMemoryFormat failed: %v", err)
+	}
+	if m.Duration() != 1500*time.Millisecond {
+		t.Errorf("expected a duration of 1.5s, got %v", m.Duration())
+	}
+
+	if err := m.Seek(1); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	buffer := make([]int32, 2)
+	if n, err := m.ReadSamples(buffer); err != nil || n != 2 || buffer[0] != 3 || buffer[1] != 4 {
+		t.Errorf("expected [3 4] after seeking to sample 1, got %v (n=%d, err=%v)", buffer[:n], n, err)
+	}
+
+	if err := m.Seek(3); err != nil {
+		t.Fatalf("Seek to the end failed: %v", err)
+	}
+	if _, err := m.ReadSamples(buffer); err != io.EOF {
+		t.Errorf("expected io.EOF at the end, got %v", err)
+	}
+	if err := m.Seek(4); err == nil {
+		t.Errorf("expected an error seeking past the end")
+	}
+}
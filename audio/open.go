@@ -0,0 +1,49 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrUnknownFileFormat is returned by Open for a file whose header matches no
+// container it can read.
+var ErrUnknownFileFormat = errors.New("unknown audio file format")
+
+// Open opens the audio file at path, choosing how to read it from the magic
+// bytes its header starts with rather than its extension: "RIFF", "RF64" and
+// "BW64" files are read as a WAVFormat. AIFF files, starting with "FORM", are
+// recognized but cannot be read yet, and raw PCM has no header to recognize,
+// so it must be opened with NewRawPCMFormat. Any other file fails with an
+// error wrapping ErrUnknownFileFormat. The Format returned is an io.Closer
+// that closes the file.
+func Open(path string) (Format, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+
+	magic := make([]byte, 4)
+	n, err := io.ReadFull(file, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		file.Close()
+		return nil, fmt.Errorf("error reading file header: %w", err)
+	}
+
+	switch string(magic[:n]) {
+	case "RIFF", "RF64", "BW64":
+		wav, err := NewWAVFormatReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		wav.file = file
+		return wav, nil
+	case "FORM":
+		file.Close()
+		return nil, fmt.Errorf("AIFF files are not supported")
+	}
+	file.Close()
+	return nil, fmt.Errorf("%w: header starts with %q", ErrUnknownFileFormat, magic[:n])
+}
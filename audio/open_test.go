@@ -0,0 +1,101 @@
+package audio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	f, err := Open("../sample.wav")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	wav, ok := f.(*WAVFormat)
+	if !ok {
+		t.Fatalf("expected a *WAVFormat, got %T", f)
+	}
+	defer wav.Close()
+
+	direct, err := NewWAVFormat("../sample.wav")
+	if err != nil {
+		t.Fatalf("NewWAVFormat failed: %v", err)
+	}
+	defer direct.Close()
+	if !reflect.DeepEqual(readAll(t, wav, 4096), readAll(t, direct, 4096)) {
+		t.Errorf("samples read through Open differ from those of NewWAVFormat")
+	}
+
+	// The header decides, not the extension
+	pcm := []byte{1, 0, 2, 0}
+	rf64 := riffWAV(chunk("fmt ", fmtBody(WAVFormatPCM, 1, 8000, 16, nil)), chunk("data", pcm))
+	copy(rf64, "RF64")
+	rf64Path := filepath.Join(t.TempDir(), "recording.bin")
+	if err := os.WriteFile(rf64Path, rf64, 0o644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	if f, err := Open(rf64Path); err != nil {
+		t.Errorf("expected an RF64 file to open, got %v", err)
+	} else {
+		f.(*WAVFormat).Close()
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("failed to write test file: %v", err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		expectedErr string
+		unknown     bool // whether the error wraps ErrUnknownFileFormat
+	}{
+		{
+			name:        "Text file",
+			path:        write("notes.wav", []byte("hello, this is not audio\n")),
+			expectedErr: `unknown audio file format: header starts with "hell"`,
+			unknown:     true,
+		},
+		{
+			name:        "Shorter than the magic",
+			path:        write("short.wav", []byte("RI")),
+			expectedErr: `unknown audio file format: header starts with "RI"`,
+			unknown:     true,
+		},
+		{
+			name:        "AIFF",
+			path:        write("sound.aiff", []byte("FORM\x00\x00\x00\x04AIFF")),
+			expectedErr: "AIFF files are not supported",
+		},
+		{
+			name:        "Truncated WAV",
+			path:        write("truncated.wav", []byte("RIFF\x04\x00\x00\x00")),
+			expectedErr: "not a valid WAVE file: error reading WAV header: EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Open(tt.path)
+			if err == nil || err.Error() != tt.expectedErr {
+				t.Fatalf("expected error %q, got %v", tt.expectedErr, err)
+			}
+			if errors.Is(err, ErrUnknownFileFormat) != tt.unknown {
+				t.Errorf("expected errors.Is(err, ErrUnknownFileFormat) to be %v", tt.unknown)
+			}
+		})
+	}
+
+	if _, err := Open(filepath.Join(dir, "missing.wav")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
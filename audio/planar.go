@@ -0,0 +1,102 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// PlanarFormat serves samples held in memory as one slice per channel, such as
+// the output of a DSP stage working on whole channels. Samples are interleaved
+// only as they are read, a buffer at a time, so no interleaved copy of the
+// whole signal is ever made.
+type PlanarFormat struct {
+	sampleRate int
+	bitDepth   int
+	channels   [][]int32
+	pos        int // index of the next value to read, counted in interleaved order
+}
+
+// NewPlanarFormat returns a Format over channels, one slice of samples per
+// channel. Every channel must hold the same number of samples, each fitting in
+// bitDepth bits as a signed integer. The slices are not copied.
+func NewPlanarFormat(channels [][]int32, sampleRate, bitDepth int) (*PlanarFormat, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("invalid number of channels: 0")
+	}
+	if bitDepth < 1 || bitDepth > 32 {
+		return nil, fmt.Errorf("unsupported bit depth: %d", bitDepth)
+	}
+
+	lo, hi := int64(-1)<<(bitDepth-1), int64(1)<<(bitDepth-1)-1
+	for ch, samples := range channels {
+		if len(samples) != len(channels[0]) {
+			return nil, fmt.Errorf("channel %d holds %d samples, channel 0 holds %d", ch, len(samples), len(channels[0]))
+		}
+		for i, s := range samples {
+			if int64(s) < lo || int64(s) > hi {
+				return nil, fmt.Errorf("sample %d of channel %d out of range for %d bits: %d", i, ch, bitDepth, s)
+			}
+		}
+	}
+
+	return &PlanarFormat{
+		sampleRate: sampleRate,
+		bitDepth:   bitDepth,
+		channels:   channels,
+	}, nil
+}
+
+// SampleRate returns the sample rate given to NewPlanarFormat.
+func (p *PlanarFormat) SampleRate() int {
+	return p.sampleRate
+}
+
+// Channels returns the number of channel slices given to NewPlanarFormat.
+func (p *PlanarFormat) Channels() int {
+	return len(p.channels)
+}
+
+// BitDepth returns the bit depth given to NewPlanarFormat.
+func (p *PlanarFormat) BitDepth() int {
+	return p.bitDepth
+}
+
+// TotalSamples returns the number of samples in each channel.
+func (p *PlanarFormat) TotalSamples() uint64 {
+	return uint64(len(p.channels[0]))
+}
+
+// Duration returns the playing time of the samples held.
+func (p *PlanarFormat) Duration() time.Duration {
+	return duration(p.TotalSamples(), p.sampleRate)
+}
+
+// Seek moves to the inter-channel sample at sampleIndex. Seeking to
+// TotalSamples is allowed and leaves nothing more to read.
+func (p *PlanarFormat) Seek(sampleIndex uint64) error {
+	if sampleIndex > p.TotalSamples() {
+		return fmt.Errorf("seek to sample %d out of range: %d samples", sampleIndex, p.TotalSamples())
+	}
+	p.pos = int(sampleIndex) * len(p.channels)
+	return nil
+}
+
+// ReadSamples interleaves the next samples of every channel into buffer,
+// returning io.EOF once every sample has been read.
+func (p *PlanarFormat) ReadSamples(buffer []int32) (int, error) {
+	total := len(p.channels[0]) * len(p.channels)
+	if p.pos >= total && len(buffer) > 0 {
+		return 0, io.EOF
+	}
+	n := min(len(buffer), total-p.pos)
+	for i := range buffer[:n] {
+		v := p.pos + i
+		buffer[i] = p.channels[v%len(p.channels)][v/len(p.channels)]
+	}
+	p.pos += n
+	return n, nil
+}
@@ -0,0 +1,107 @@
+package audio
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestNewPlanarFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		channels    [][]int32
+		bitDepth    int
+		expected    []int32
+		expectedErr bool
+	}{
+		{
+			name:     "16-bit stereo",
+			channels: [][]int32{{1, -32768, 5}, {-1, 32767, 6}},
+			bitDepth: 16,
+			expected: []int32{1, -1, -32768, 32767, 5, 6},
+		},
+		{
+			name:     "24-bit with 3 channels",
+			channels: [][]int32{{-8388608, 1}, {8388607, 2}, {0, 3}},
+			bitDepth: 24,
+			expected: []int32{-8388608, 8388607, 0, 1, 2, 3},
+		},
+		{
+			name:     "No samples",
+			channels: [][]int32{nil, nil},
+			bitDepth: 16,
+		},
+		{
+			name:        "Channels of different lengths",
+			channels:    [][]int32{{1, 2}, {3}},
+			bitDepth:    16,
+			expectedErr: true,
+		},
+		{
+			name:        "Sample out of range",
+			channels:    [][]int32{{0}, {128}},
+			bitDepth:    8,
+			expectedErr: true,
+		},
+		{
+			name:        "Unsupported bit depth",
+			channels:    [][]int32{{0}},
+			bitDepth:    0,
+			expectedErr: true,
+		},
+		{
+			name:        "No channels",
+			bitDepth:    16,
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPlanarFormat(tt.channels, 44100, tt.bitDepth)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if want := uint64(len(tt.channels[0])); p.TotalSamples() != want {
+				t.Errorf("expected %d total samples, got %d", want, p.TotalSamples())
+			}
+			if p.Channels() != len(tt.channels) || p.BitDepth() != tt.bitDepth || p.SampleRate() != 44100 {
+				t.Errorf("unexpected format: %d channels, %d bits, %d Hz", p.Channels(), p.BitDepth(), p.SampleRate())
+			}
+
+			// Reads of an odd size split inter-channel samples
+			if got := readAll(t, p, 5); len(got) != len(tt.expected) || (len(got) > 0 && !reflect.DeepEqual(got, tt.expected)) {
+				t.Errorf("expected samples %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPlanarFormatSeek(t *testing.T) {
+	p, err := NewPlanarFormat([][]int32{{1, 3, 5}, {2, 4, 6}}, 2, 16)
+	if err != nil {
+		t.Fatalf("NewPlanarFormat failed: %v", err)
+	}
+
+	if err := p.Seek(1); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	buffer := make([]int32, 2)
+	if n, err := p.ReadSamples(buffer); err != nil || n != 2 || buffer[0] != 3 || buffer[1] != 4 {
+		t.Errorf("expected [3 4] after seeking to sample 1, got %v (n=%d, err=%v)", buffer[:n], n, err)
+	}
+
+	if err := p.Seek(3); err != nil {
+		t.Fatalf("Seek to the end failed: %v", err)
+	}
+	if _, err := p.ReadSamples(buffer); err != io.EOF {
+		t.Errorf("expected io.EOF at the end, got %v", err)
+	}
+	if err := p.Seek(4); err == nil {
+		t.Errorf("expected an error seeking past the end")
+	}
+}
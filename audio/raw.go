@@ -0,0 +1,145 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// RawPCMFormat reads headerless integer PCM, with the stream parameters
+// supplied by the caller instead of a file header.
+type RawPCMFormat struct {
+	sampleRate   int
+	channels     int
+	bitDepth     int
+	byteOrder    binary.ByteOrder
+	signed8      bool // whether 8-bit samples are signed rather than offset by 128
+	totalSamples uint64
+
+	// File handling
+	file    *os.File
+	data    *io.LimitedReader // audio data, bounded to the whole frames in the file
+	partial []byte            // bytes of an incomplete sample carried between reads
+}
+
+// NewRawPCMFormat opens a headerless PCM file. Samples are interleaved signed
+// integers of bitDepth bits (8-bit samples are unsigned, as in WAV, unless
+// SetSigned8Bit says otherwise), stored little or big-endian. TotalSamples is
+// derived from the file size; a partial trailing frame is ignored.
+// file is left open
+func NewRawPCMFormat(path string, sampleRate, channels, bitDepth int, littleEndian bool) (*RawPCMFormat, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	if channels <= 0 {
+		return nil, fmt.Errorf("invalid number of channels: %d", channels)
+	}
+	switch bitDepth {
+	case 8, 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("unsupported bit depth: %d", bitDepth)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error reading file size: %w", err)
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if !littleEndian {
+		order = binary.BigEndian
+	}
+	frameSize := int64(channels * bitDepth / 8)
+	totalSamples := info.Size() / frameSize
+
+	return &RawPCMFormat{
+		sampleRate:   sampleRate,
+		channels:     channels,
+		bitDepth:     bitDepth,
+		byteOrder:    order,
+		totalSamples: uint64(totalSamples),
+		file:         file,
+		data:         &io.LimitedReader{R: file, N: totalSamples * frameSize},
+	}, nil
+}
+
+// SetSigned8Bit sets whether 8-bit samples are signed, as AIFF and many tools
+// writing headerless audio store them, rather than unsigned with 128 as zero,
+// as WAV stores them, which is the default. It has no effect at other bit
+// depths.
+func (r *RawPCMFormat) SetSigned8Bit(signed bool) {
+	r.signed8 = signed
+}
+
+// SampleRate returns the sample rate given when the file was opened.
+func (r *RawPCMFormat) SampleRate() int {
+	return r.sampleRate
+}
+
+// Channels returns the number of channels given when the file was opened.
+func (r *RawPCMFormat) Channels() int {
+	return r.channels
+}
+
+// BitDepth returns the bit depth given when the file was opened.
+func (r *RawPCMFormat) BitDepth() int {
+	return r.bitDepth
+}
+
+// TotalSamples returns the number of inter-channel samples in the file.
+func (r *RawPCMFormat) TotalSamples() uint64 {
+	return r.totalSamples
+}
+
+// Duration returns the playing time of the raw PCM file.
+func (r *RawPCMFormat) Duration() time.Duration {
+	return duration(r.totalSamples, r.sampleRate)
+}
+
+// Seek moves to the inter-channel sample at sampleIndex. Seeking to
+// TotalSamples is allowed and leaves nothing more to read.
+func (r *RawPCMFormat) Seek(sampleIndex uint64) error {
+	if sampleIndex > r.totalSamples {
+		return fmt.Errorf("seek to sample %d out of range: %d samples", sampleIndex, r.totalSamples)
+	}
+	frameSize := int64(r.channels * r.bitDepth / 8)
+	if _, err := r.file.Seek(int64(sampleIndex)*frameSize, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking to sample %d: %w", sampleIndex, err)
+	}
+	r.data.N = int64(r.totalSamples-sampleIndex) * frameSize
+	r.partial = r.partial[:0]
+	return nil
+}
+
+// ReadSamples reads audio samples into the provided buffer.
+func (r *RawPCMFormat) ReadSamples(buffer []int32) (int, error) {
+	bytesPerSample := r.bitDepth / 8
+	if len(buffer) == 0 {
+		return 0, nil
+	}
+
+	bytesBuffer := make([]byte, len(buffer)*bytesPerSample)
+	samplesRead, err := readWholeSamples(r.data, &r.partial, bytesBuffer, bytesPerSample)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < samplesRead; i++ {
+		buffer[i] = pcmToInt32(bytesBuffer[i*bytesPerSample:(i+1)*bytesPerSample], r.byteOrder, r.signed8)
+	}
+	return samplesRead, nil
+}
+
+// Close closes the raw PCM file.
+func (r *RawPCMFormat) Close() error {
+	if r.file != nil {
+		return r.file.Close()
+	}
+	return nil
+}
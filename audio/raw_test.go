@@ -0,0 +1,126 @@
+package audio
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewRawPCMFormat(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         []byte
+		channels     int
+		bitDepth     int
+		littleEndian bool
+		signed8      bool
+		expectedErr  bool
+		expected     []int32
+	}{
+		{
+			name:         "16-bit stereo little-endian",
+			data:         []byte{0x01, 0x00, 0xFF, 0xFF, 0x00, 0x80, 0xFF, 0x7F},
+			channels:     2,
+			bitDepth:     16,
+			littleEndian: true,
+			expected:     []int32{1, -1, -32768, 32767},
+		},
+		{
+			name:     "16-bit stereo big-endian",
+			data:     []byte{0x00, 0x01, 0xFF, 0xFF, 0x80, 0x00, 0x7F, 0xFF},
+			channels: 2,
+			bitDepth: 16,
+			expected: []int32{1, -1, -32768, 32767},
+		},
+		{
+			name:     "24-bit mono big-endian",
+			data:     []byte{0x00, 0x00, 0x01, 0xFF, 0xFF, 0xFE, 0x80, 0x00, 0x00},
+			channels: 1,
+			bitDepth: 24,
+			expected: []int32{1, -2, -8388608},
+		},
+		{
+			name:     "8-bit unsigned",
+			data:     []byte{0x00, 0x7F, 0x80, 0xFF},
+			channels: 1,
+			bitDepth: 8,
+			expected: []int32{-128, -1, 0, 127},
+		},
+		{
+			name:     "8-bit signed",
+			data:     []byte{0x00, 0x7F, 0x80, 0xFF},
+			channels: 1,
+			bitDepth: 8,
+			signed8:  true,
+			expected: []int32{0, 127, -128, -1},
+		},
+		{
+			name:         "Signedness ignored above 8 bits",
+			data:         []byte{0x00, 0x80, 0xFF, 0x7F},
+			channels:     1,
+			bitDepth:     16,
+			littleEndian: true,
+			signed8:      true,
+			expected:     []int32{-32768, 32767},
+		},
+		{
+			name:         "Partial trailing frame is ignored",
+			data:         []byte{0x01, 0x00, 0x02, 0x00, 0x03},
+			channels:     2,
+			bitDepth:     16,
+			littleEndian: true,
+			expected:     []int32{1, 2},
+		},
+		{
+			name:         "Trailing channel sample is ignored",
+			data:         []byte{0x01, 0x00, 0x02, 0x00, 0x03, 0x00, 0x04},
+			channels:     2,
+			bitDepth:     16,
+			littleEndian: true,
+			expected:     []int32{1, 2},
+		},
+		{
+			name:        "Unsupported bit depth",
+			data:        []byte{0x00},
+			channels:    1,
+			bitDepth:    12,
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.pcm")
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatalf("failed to write test file: %v", err)
+			}
+
+			raw, err := NewRawPCMFormat(path, 44100, tt.channels, tt.bitDepth, tt.littleEndian)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			defer raw.Close()
+			raw.SetSigned8Bit(tt.signed8)
+
+			frameSize := tt.channels * tt.bitDepth / 8
+			if want := uint64(len(tt.data) / frameSize); raw.TotalSamples() != want {
+				t.Errorf("expected %d total samples, got %d", want, raw.TotalSamples())
+			}
+
+			// Reads stop at the last whole frame, also after seeking back
+			for _, start := range []uint64{0, 1} {
+				if err := raw.Seek(start); err != nil {
+					t.Fatalf("Seek(%d) failed: %v", start, err)
+				}
+				expected := tt.expected[int(start)*tt.channels:]
+				if got := readAll(t, raw, len(tt.data)); len(got) != len(expected) || (len(expected) > 0 && !reflect.DeepEqual(got, expected)) {
+					t.Errorf("from sample %d: expected %v, got %v", start, expected, got)
+				}
+			}
+		})
+	}
+}
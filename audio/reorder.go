@@ -0,0 +1,114 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+)
+
+// reordered permutes the channels of a Format.
+type reordered struct {
+	Format
+	mapping []int   // source channel of each output channel
+	err     error   // invalid mapping, reported by ReadSamples
+	buffer  []int32 // interleaved source samples, starting with any incomplete one carried over
+	carried int     // values of an incomplete inter-channel sample at the start of buffer
+}
+
+// ReorderChannels returns a Format whose channel i is channel mapping[i] of
+// f, for bringing multichannel audio into the order FLAC requires. A 5.1 file
+// storing FL FR BL BR FC LFE, for instance, takes the mapping
+// []int{0, 1, 4, 5, 2, 3} to FLAC's FL FR FC LFE BL BR. mapping must hold
+// every channel of f exactly once; otherwise ReadSamples fails. The result
+// can be seeked if f can, and f is returned as is if mapping leaves every
+// channel in place.
+func ReorderChannels(f Format, mapping []int) Format {
+	r := &reordered{Format: f, mapping: append([]int(nil), mapping...)}
+	if len(mapping) != f.Channels() {
+		r.err = fmt.Errorf("channel mapping of %d entries for %d channels", len(mapping), f.Channels())
+		return r
+	}
+
+	seen := make([]bool, len(mapping))
+	identity := true
+	for i, ch := range mapping {
+		if ch < 0 || ch >= len(mapping) {
+			r.err = fmt.Errorf("channel mapping entry %d out of range: %d", i, ch)
+			return r
+		}
+		if seen[ch] {
+			r.err = fmt.Errorf("channel %d appears twice in the mapping", ch)
+			return r
+		}
+		seen[ch] = true
+		identity = identity && ch == i
+	}
+	if identity {
+		return f
+	}
+	return r
+}
+
+// ReadSamples reads whole inter-channel samples of the source into buffer
+// with their channels reordered. Values of an incomplete inter-channel sample
+// returned by a short read are held until the rest arrive.
+func (r *reordered) ReadSamples(buffer []int32) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if len(buffer) == 0 {
+		return 0, nil
+	}
+	channels := len(r.mapping)
+	size := len(buffer) / channels * channels
+	if size == 0 {
+		return 0, fmt.Errorf("buffer of %d values cannot hold a sample of %d channels", len(buffer), channels)
+	}
+	if cap(r.buffer) < size {
+		grown := make([]int32, size)
+		copy(grown, r.buffer[:r.carried])
+		r.buffer = grown
+	}
+	source := r.buffer[:size]
+
+	// Read until at least one whole sample is in, so a short read is never
+	// mistaken for the end of the stream
+	n := r.carried
+	for n < channels {
+		read, err := r.Format.ReadSamples(source[n:])
+		n += read
+		if err == io.EOF || (err == nil && read == 0) {
+			break
+		}
+		if err != nil {
+			r.carried = n
+			return 0, err
+		}
+	}
+
+	count := n / channels
+	for i := 0; i < count; i++ {
+		sample := source[i*channels : (i+1)*channels]
+		for ch, from := range r.mapping {
+			buffer[i*channels+ch] = sample[from]
+		}
+	}
+	r.carried = copy(source, source[count*channels:n])
+	if count == 0 {
+		return 0, io.EOF
+	}
+	return count * channels, nil
+}
+
+// Seek moves to the inter-channel sample at sampleIndex if the source
+// implements Seeker.
+func (r *reordered) Seek(sampleIndex uint64) error {
+	seeker, ok := r.Format.(Seeker)
+	if !ok {
+		return fmt.Errorf("source format cannot seek")
+	}
+	if err := seeker.Seek(sampleIndex); err != nil {
+		return err
+	}
+	r.carried = 0
+	return nil
+}
@@ -0,0 +1,88 @@
+package audio
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReorderChannels(t *testing.T) {
+	tests := []struct {
+		name     string
+		samples  []int32
+		channels int
+		mapping  []int
+		expected []int32
+	}{
+		{
+			name:     "Swap left and right",
+			samples:  []int32{1, -1, 2, -2, 3, -3},
+			channels: 2,
+			mapping:  []int{1, 0},
+			expected: []int32{-1, 1, -2, 2, -3, 3},
+		},
+		{
+			name:     "WAV 5.1 with the back pair second to FLAC order",
+			samples:  []int32{1, 2, 5, 6, 3, 4, 11, 12, 15, 16, 13, 14},
+			channels: 6,
+			mapping:  []int{0, 1, 4, 5, 2, 3},
+			expected: []int32{1, 2, 3, 4, 5, 6, 11, 12, 13, 14, 15, 16},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Reads of 5 values split inter-channel samples across calls
+			for _, max := range []int{len(tt.samples), 5} {
+				source, err := NewMemoryFormat(tt.samples, 44100, tt.channels, 16)
+				if err != nil {
+					t.Fatalf("NewMemoryFormat failed: %v", err)
+				}
+				f := ReorderChannels(&trickleFormat{MemoryFormat: source, max: max}, tt.mapping)
+				if f.Channels() != tt.channels || f.TotalSamples() != source.TotalSamples() {
+					t.Errorf("expected %d channels and %d samples, got %d and %d", tt.channels, source.TotalSamples(), f.Channels(), f.TotalSamples())
+				}
+				if got := readAll(t, f, 4*tt.channels); !reflect.DeepEqual(got, tt.expected) {
+					t.Errorf("reads of %d values: expected %v, got %v", max, tt.expected, got)
+				}
+
+				if err := f.(Seeker).Seek(1); err != nil {
+					t.Fatalf("Seek failed: %v", err)
+				}
+				if got := readAll(t, f, 4*tt.channels); !reflect.DeepEqual(got, tt.expected[tt.channels:]) {
+					t.Errorf("after Seek(1): expected %v, got %v", tt.expected[tt.channels:], got)
+				}
+			}
+		})
+	}
+}
+
+func TestReorderChannelsInvalid(t *testing.T) {
+	source, err := NewMemoryFormat([]int32{1, 2, 3, 4, 5, 6}, 44100, 3, 16)
+	if err != nil {
+		t.Fatalf("NewMemoryFormat failed: %v", err)
+	}
+	if same := ReorderChannels(source, []int{0, 1, 2}); same != Format(source) {
+		t.Errorf("expected an identity mapping to return the source as is")
+	}
+
+	tests := []struct {
+		name        string
+		mapping     []int
+		expectedErr string
+	}{
+		{name: "Too short", mapping: []int{1, 0}, expectedErr: "channel mapping of 2 entries for 3 channels"},
+		{name: "Too long", mapping: []int{0, 1, 2, 3}, expectedErr: "channel mapping of 4 entries for 3 channels"},
+		{name: "Out of range", mapping: []int{0, 3, 1}, expectedErr: "channel mapping entry 1 out of range: 3"},
+		{name: "Negative", mapping: []int{-1, 0, 1}, expectedErr: "channel mapping entry 0 out of range: -1"},
+		{name: "Duplicate", mapping: []int{2, 0, 2}, expectedErr: "channel 2 appears twice in the mapping"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReorderChannels(source, tt.mapping).ReadSamples(make([]int32, 6))
+			if err == nil || err.Error() != tt.expectedErr {
+				t.Errorf("expected error %q, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
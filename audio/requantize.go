@@ -0,0 +1,97 @@
+package audio
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// DitherType selects the noise added to samples before they are rounded to a
+// lower bit depth.
+type DitherType int
+
+const (
+	// NoDither rounds samples as they are. The rounding error follows the
+	// signal, which turns quiet passages into harmonic distortion.
+	NoDither DitherType = iota
+	// TPDF adds noise with a triangular probability density spanning two
+	// steps of the target depth, which leaves the rounding error independent
+	// of the signal at the cost of a slightly higher noise floor.
+	TPDF
+)
+
+// ditherSeed seeds the dither noise, so the same input always requantizes to
+// the same output.
+const ditherSeed = 1
+
+// requantized rounds the samples of a Format to another bit depth.
+type requantized struct {
+	Format
+	bits   int // target bit depth
+	dither DitherType
+	random *rand.Rand
+}
+
+// Requantize returns a Format scaling the samples of f to targetBits. Reducing
+// the bit depth adds the chosen dither, rounds to the nearest step of the
+// target depth and clamps samples the noise pushes out of range; increasing it
+// shifts samples left and is lossless. The sample rate, channels and total
+// sample count are those of f, and the result can be seeked if f can. f is
+// returned as is if it already has the target depth; a target depth outside
+// 1-32 bits or an unknown dither type makes ReadSamples fail.
+func Requantize(f Format, targetBits int, dither DitherType) Format {
+	if f.BitDepth() == targetBits {
+		return f
+	}
+	return &requantized{
+		Format: f,
+		bits:   targetBits,
+		dither: dither,
+		random: rand.New(rand.NewSource(ditherSeed)),
+	}
+}
+
+// BitDepth returns the target bit depth.
+func (r *requantized) BitDepth() int {
+	return r.bits
+}
+
+// ReadSamples reads samples from the source and requantizes them in place.
+func (r *requantized) ReadSamples(buffer []int32) (int, error) {
+	source := r.Format.BitDepth()
+	if r.bits < 1 || r.bits > 32 || source < 1 || source > 32 {
+		return 0, fmt.Errorf("cannot requantize from %d to %d bits", source, r.bits)
+	}
+	if r.dither != NoDither && r.dither != TPDF {
+		return 0, fmt.Errorf("unknown dither type %d", r.dither)
+	}
+
+	n, err := r.Format.ReadSamples(buffer)
+	if r.bits > source {
+		for i := range buffer[:n] {
+			buffer[i] <<= uint(r.bits - source)
+		}
+		return n, err
+	}
+
+	shift := uint(source - r.bits)
+	step := int64(1) << shift
+	lowest, highest := -int64(1)<<(r.bits-1), int64(1)<<(r.bits-1)-1
+	for i, s := range buffer[:n] {
+		v := int64(s) + step/2
+		if r.dither == TPDF {
+			// The sum of two uniform values is triangular over (-step, step)
+			v += r.random.Int63n(step) + r.random.Int63n(step) - (step - 1)
+		}
+		buffer[i] = int32(max(lowest, min(highest, v>>shift)))
+	}
+	return n, err
+}
+
+// Seek moves to the sample at sampleIndex if the source implements Seeker.
+func (r *requantized) Seek(sampleIndex uint64) error {
+	seeker, ok := r.Format.(Seeker)
+	if !ok {
+		return fmt.Errorf("source format cannot seek")
+	}
+	return seeker.Seek(sampleIndex)
+}
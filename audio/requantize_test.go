@@ -0,0 +1,140 @@
+package audio
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestRequantize(t *testing.T) {
+	tests := []struct {
+		name       string
+		samples    []int32
+		bitDepth   int
+		targetBits int
+		expected   []int32
+	}{
+		{
+			name:       "24 to 16 bits",
+			samples:    []int32{0, 127, 128, -128, -129, 256, 8388607, -8388608},
+			bitDepth:   24,
+			targetBits: 16,
+			expected:   []int32{0, 0, 1, 0, -1, 1, 32767, -32768},
+		},
+		{
+			name:       "16 to 8 bits",
+			samples:    []int32{1000, -1000, 32767, -32768},
+			bitDepth:   16,
+			targetBits: 8,
+			expected:   []int32{4, -4, 127, -128},
+		},
+		{
+			name:       "16 to 24 bits",
+			samples:    []int32{1, -1, 32767, -32768},
+			bitDepth:   16,
+			targetBits: 24,
+			expected:   []int32{256, -256, 8388352, -8388608},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewMemoryFormat(tt.samples, 44100, 1, tt.bitDepth)
+			if err != nil {
+				t.Fatalf("NewMemoryFormat failed: %v", err)
+			}
+			requantized := Requantize(source, tt.targetBits, NoDither)
+			if requantized.BitDepth() != tt.targetBits || requantized.TotalSamples() != source.TotalSamples() {
+				t.Errorf("expected %d bits and %d samples, got %d bits and %d samples",
+					tt.targetBits, source.TotalSamples(), requantized.BitDepth(), requantized.TotalSamples())
+			}
+			if got := readAll(t, requantized, 3); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// correlation returns the Pearson correlation coefficient of x and y.
+func correlation(x, y []float64) float64 {
+	var mx, my float64
+	for i := range x {
+		mx += x[i]
+		my += y[i]
+	}
+	mx /= float64(len(x))
+	my /= float64(len(y))
+	var sxy, sxx, syy float64
+	for i := range x {
+		sxy += (x[i] - mx) * (y[i] - my)
+		sxx += (x[i] - mx) * (x[i] - mx)
+		syy += (y[i] - my) * (y[i] - my)
+	}
+	return sxy / math.Sqrt(sxx*syy)
+}
+
+func TestRequantizeDither(t *testing.T) {
+	// A 24-bit sine only a couple of 16-bit steps high, where rounding error
+	// follows the signal most closely
+	const count = 1 << 16
+	samples := make([]int32, count)
+	for i := range samples {
+		samples[i] = int32(math.Round(600 * math.Sin(2*math.Pi*float64(i)/441)))
+	}
+
+	tests := []struct {
+		dither     DitherType
+		correlated bool
+	}{
+		{dither: NoDither, correlated: true},
+		{dither: TPDF, correlated: false},
+	}
+
+	for _, tt := range tests {
+		source, err := NewMemoryFormat(samples, 44100, 1, 24)
+		if err != nil {
+			t.Fatalf("NewMemoryFormat failed: %v", err)
+		}
+		got := readAll(t, Requantize(source, 16, tt.dither), 4096)
+
+		// The error, in 16-bit steps, against the signal and its square: a
+		// signal-dependent error correlates with one or the other
+		signal, squared, errs := make([]float64, count), make([]float64, count), make([]float64, count)
+		var mean float64
+		for i, s := range samples {
+			signal[i] = float64(s) / 256
+			squared[i] = signal[i] * signal[i]
+			errs[i] = float64(got[i]) - signal[i]
+			if math.Abs(errs[i]) >= 2 {
+				t.Fatalf("dither %d: sample %d rounded to %d, more than 2 steps from %.2f", tt.dither, i, got[i], signal[i])
+			}
+			mean += errs[i]
+		}
+		mean /= count
+
+		linear, quadratic := correlation(signal, errs), correlation(squared, errs)
+		if dependent := math.Abs(linear) > 0.05 || math.Abs(quadratic) > 0.05; dependent != tt.correlated {
+			t.Errorf("dither %d: expected correlated error: %v, got correlation %.3f with the signal and %.3f with its square",
+				tt.dither, tt.correlated, linear, quadratic)
+		}
+		if !tt.correlated && math.Abs(mean) > 0.05 {
+			t.Errorf("dither %d: expected an unbiased error, got a mean of %.3f steps", tt.dither, mean)
+		}
+	}
+}
+
+func TestRequantizeInvalid(t *testing.T) {
+	source, err := NewMemoryFormat([]int32{1, 2, 3}, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("NewMemoryFormat failed: %v", err)
+	}
+	if same := Requantize(source, 16, TPDF); same != Format(source) {
+		t.Errorf("expected a source already at the target depth to be returned as is")
+	}
+	if _, err := Requantize(source, 0, NoDither).ReadSamples(make([]int32, 3)); err == nil {
+		t.Errorf("expected an error requantizing to 0 bits")
+	}
+	if _, err := Requantize(source, 8, DitherType(9)).ReadSamples(make([]int32, 3)); err == nil {
+		t.Errorf("expected an error for an unknown dither type")
+	}
+}
@@ -0,0 +1,167 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// resampleChunk is the number of inter-channel samples the resampler reads
+// from its source at a time.
+const resampleChunk = 4096
+
+// resampled converts a Format to another sample rate.
+type resampled struct {
+	Format
+	rate     int // target sample rate
+	channels int
+
+	source []int32 // interleaved source samples from number base on, possibly ending in an incomplete one
+	base   uint64  // index of the first inter-channel sample in source
+	next   uint64  // index of the next output sample
+	eof    bool    // whether the source is exhausted
+	chunk  []int32 // buffer source samples are read into
+}
+
+// Resample returns a Format converting f to targetRate samples per second by
+// linear interpolation between neighbouring source samples, rounded to the
+// nearest integer. Each output sample n is taken at the source position
+// n*rate/targetRate, so the audio keeps its pitch and duration, and the total
+// sample count is scaled to match. The source is read a block at a time, the
+// samples still needed for interpolation kept across calls. The result can be
+// seeked if f can. f is returned as is if it already has the target rate; a
+// target rate that is not positive makes ReadSamples fail.
+//
+// Linear interpolation does not filter out frequencies above the new Nyquist
+// limit, so downsampling can alias.
+// TODO: replace it with a windowed-sinc filter.
+func Resample(f Format, targetRate int) Format {
+	if f.SampleRate() == targetRate {
+		return f
+	}
+	return &resampled{Format: f, rate: targetRate, channels: f.Channels()}
+}
+
+// SampleRate returns the target sample rate.
+func (r *resampled) SampleRate() int {
+	return r.rate
+}
+
+// TotalSamples returns the number of samples the source converts to: those
+// whose position falls within the source.
+func (r *resampled) TotalSamples() uint64 {
+	sourceRate := uint64(r.Format.SampleRate())
+	if r.rate <= 0 || sourceRate == 0 {
+		return 0
+	}
+	total := r.Format.TotalSamples() * uint64(r.rate)
+	return (total + sourceRate - 1) / sourceRate
+}
+
+// Duration returns the playing time of the converted samples.
+func (r *resampled) Duration() time.Duration {
+	return duration(r.TotalSamples(), r.rate)
+}
+
+// position returns the source position of output sample n as a whole sample
+// index and a fraction of remainder/r.rate towards the next.
+func (r *resampled) position(n uint64) (index, remainder uint64) {
+	p := n * uint64(r.Format.SampleRate())
+	return p / uint64(r.rate), p % uint64(r.rate)
+}
+
+// available returns the index one past the last whole source sample read.
+func (r *resampled) available() uint64 {
+	return r.base + uint64(len(r.source)/r.channels)
+}
+
+// fill reads the source until the sample at index has been read, or the
+// source runs out.
+func (r *resampled) fill(index uint64) error {
+	if r.chunk == nil {
+		r.chunk = make([]int32, resampleChunk*r.channels)
+	}
+	for !r.eof && r.available() <= index {
+		n, err := r.Format.ReadSamples(r.chunk)
+		r.source = append(r.source, r.chunk[:n]...)
+		if err == io.EOF || (err == nil && n == 0) {
+			r.eof = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadSamples fills buffer with whole interleaved samples at the target rate,
+// returning io.EOF once the source is exhausted.
+func (r *resampled) ReadSamples(buffer []int32) (int, error) {
+	if r.rate <= 0 || r.Format.SampleRate() <= 0 {
+		return 0, fmt.Errorf("cannot resample from %d Hz to %d Hz", r.Format.SampleRate(), r.rate)
+	}
+	if len(buffer) < r.channels {
+		return 0, nil
+	}
+
+	n := 0
+	for ; n+r.channels <= len(buffer); n += r.channels {
+		index, remainder := r.position(r.next)
+		if err := r.fill(index + 1); err != nil {
+			if n > 0 {
+				break // report the error on the next call
+			}
+			return 0, fmt.Errorf("error reading source: %w", err)
+		}
+		if index >= r.available() {
+			break
+		}
+
+		// Past the last source sample there is nothing to interpolate towards
+		from := int(index-r.base) * r.channels
+		to := from
+		if index+1 < r.available() {
+			to += r.channels
+		}
+		for ch := 0; ch < r.channels; ch++ {
+			a, b := int64(r.source[from+ch]), int64(r.source[to+ch])
+			buffer[n+ch] = int32(a + roundedQuotient((b-a)*int64(remainder), int64(r.rate)))
+		}
+		r.next++
+	}
+
+	// Drop the source samples no later output sample needs
+	if index, _ := r.position(r.next); index > r.base {
+		drop := min(index, r.available()) - r.base
+		r.source = r.source[:copy(r.source, r.source[int(drop)*r.channels:])]
+		r.base += drop
+	}
+
+	if n == 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// Seek moves to the output sample at sampleIndex if the source implements
+// Seeker, seeking the source to the sample it is interpolated from.
+func (r *resampled) Seek(sampleIndex uint64) error {
+	seeker, ok := r.Format.(Seeker)
+	if !ok {
+		return fmt.Errorf("source format cannot seek")
+	}
+	if sampleIndex > r.TotalSamples() {
+		return fmt.Errorf("seek to sample %d out of range: %d samples", sampleIndex, r.TotalSamples())
+	}
+	index, _ := r.position(sampleIndex)
+	if index > r.Format.TotalSamples() {
+		index = r.Format.TotalSamples()
+	}
+	if err := seeker.Seek(index); err != nil {
+		return err
+	}
+	r.source = r.source[:0]
+	r.base, r.next, r.eof = index, sampleIndex, false
+	return nil
+}
@@ -0,0 +1,156 @@
+package audio
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestResampleInterpolation(t *testing.T) {
+	tests := []struct {
+		name       string
+		samples    []int32
+		channels   int
+		sourceRate int
+		targetRate int
+		expected   []int32
+	}{
+		{
+			name:       "Doubled",
+			samples:    []int32{0, 100, 300},
+			channels:   1,
+			sourceRate: 22050,
+			targetRate: 44100,
+			expected:   []int32{0, 50, 100, 200, 300, 300},
+		},
+		{
+			name:       "Halved",
+			samples:    []int32{0, 1, 2, 3, 4},
+			channels:   1,
+			sourceRate: 44100,
+			targetRate: 22050,
+			expected:   []int32{0, 2, 4},
+		},
+		{
+			name:       "Stereo by three quarters",
+			samples:    []int32{0, 0, 4, -4, 8, -8, 12, -12},
+			channels:   2,
+			sourceRate: 32000,
+			targetRate: 24000,
+			expected:   []int32{0, 0, 5, -5, 11, -11},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, max := range []int{1, 3, len(tt.samples)} {
+				source, err := NewMemoryFormat(tt.samples, tt.sourceRate, tt.channels, 16)
+				if err != nil {
+					t.Fatalf("NewMemoryFormat failed: %v", err)
+				}
+				resampled := Resample(&trickleFormat{MemoryFormat: source, max: max}, tt.targetRate)
+				if resampled.SampleRate() != tt.targetRate {
+					t.Errorf("expected %d Hz, got %d", tt.targetRate, resampled.SampleRate())
+				}
+				if want := uint64(len(tt.expected) / tt.channels); resampled.TotalSamples() != want {
+					t.Errorf("expected %d samples, got %d", want, resampled.TotalSamples())
+				}
+				if got := readAll(t, resampled, 2*tt.channels); !reflect.DeepEqual(got, tt.expected) {
+					t.Errorf("reading %d values at a time: expected %v, got %v", max, tt.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestResampleSine(t *testing.T) {
+	const (
+		frequency = 1000.0
+		amplitude = 10000.0
+	)
+	tests := []struct {
+		sourceRate int
+		targetRate int
+	}{
+		{sourceRate: 48000, targetRate: 44100},
+		{sourceRate: 44100, targetRate: 48000},
+		{sourceRate: 44100, targetRate: 96000},
+		{sourceRate: 96000, targetRate: 8000},
+	}
+
+	for _, tt := range tests {
+		// A second of a stereo sine, inverted in the right channel
+		samples := make([]int32, 2*tt.sourceRate)
+		for i := 0; i < tt.sourceRate; i++ {
+			v := int32(math.Round(amplitude * math.Sin(2*math.Pi*frequency*float64(i)/float64(tt.sourceRate))))
+			samples[2*i], samples[2*i+1] = v, -v
+		}
+		source, err := NewMemoryFormat(samples, tt.sourceRate, 2, 16)
+		if err != nil {
+			t.Fatalf("NewMemoryFormat failed: %v", err)
+		}
+		resampled := Resample(source, tt.targetRate)
+		if resampled.TotalSamples() != uint64(tt.targetRate) || resampled.Duration() != source.Duration() {
+			t.Errorf("%d to %d Hz: expected %d samples lasting %v, got %d lasting %v", tt.sourceRate, tt.targetRate,
+				tt.targetRate, source.Duration(), resampled.TotalSamples(), resampled.Duration())
+		}
+
+		got := readAll(t, resampled, 4096)
+		if len(got) != 2*tt.targetRate {
+			t.Fatalf("%d to %d Hz: expected %d values, got %d", tt.sourceRate, tt.targetRate, 2*tt.targetRate, len(got))
+		}
+		// Every output sample sits on the same sine at the new rate, within
+		// the error of interpolating a straight line between source samples,
+		// up to those past the last source sample, which is held
+		step := 2 * math.Pi * frequency / float64(tt.sourceRate)
+		tolerance := amplitude*step*step/8 + 1
+		for i := 0; i < tt.targetRate; i++ {
+			if i*tt.sourceRate > (tt.sourceRate-1)*tt.targetRate {
+				break
+			}
+			want := amplitude * math.Sin(2*math.Pi*frequency*float64(i)/float64(tt.targetRate))
+			if diff := math.Abs(float64(got[2*i]) - want); diff > tolerance {
+				t.Fatalf("%d to %d Hz: sample %d is %d, expected %.0f within %.1f", tt.sourceRate, tt.targetRate, i, got[2*i], want, tolerance)
+			}
+			if got[2*i+1] != -got[2*i] {
+				t.Fatalf("%d to %d Hz: sample %d differs between channels: %d and %d", tt.sourceRate, tt.targetRate, i, got[2*i], got[2*i+1])
+			}
+		}
+	}
+}
+
+func TestResampleSeek(t *testing.T) {
+	source, err := NewMemoryFormat([]int32{0, 100, 200, 300, 400}, 22050, 1, 16)
+	if err != nil {
+		t.Fatalf("NewMemoryFormat failed: %v", err)
+	}
+	resampled := Resample(source, 44100)
+	readAll(t, resampled, 4)
+	if err := resampled.(Seeker).Seek(5); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if got := readAll(t, resampled, 4); !reflect.DeepEqual(got, []int32{250, 300, 350, 400, 400}) {
+		t.Errorf("expected [250 300 350 400 400] after seeking, got %v", got)
+	}
+	if err := resampled.(Seeker).Seek(11); err == nil {
+		t.Errorf("expected an error seeking past the end")
+	}
+
+	unseekable := struct{ Format }{source}
+	if resampled := Resample(unseekable, 44100); resampled.(Seeker).Seek(0) == nil {
+		t.Errorf("expected an error seeking a source that cannot seek")
+	}
+}
+
+func TestResampleInvalidRate(t *testing.T) {
+	source, err := NewMemoryFormat([]int32{1, 2, 3}, 44100, 1, 16)
+	if err != nil {
+		t.Fatalf("NewMemoryFormat failed: %v", err)
+	}
+	if same := Resample(source, 44100); same != Format(source) {
+		t.Errorf("expected a source already at the target rate to be returned as is")
+	}
+	if _, err := Resample(source, 0).ReadSamples(make([]int32, 4)); err == nil {
+		t.Errorf("expected an error resampling to 0 Hz")
+	}
+}
@@ -0,0 +1,83 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// trimmed plays a section of a seekable Format.
+type trimmed struct {
+	Format
+	seeker    Seeker
+	start     uint64 // index in the source of the first sample of the section
+	count     uint64 // inter-channel samples in the section
+	remaining uint64 // values left to read in the section
+}
+
+// Trim returns a Format playing numSamples inter-channel samples of f,
+// starting with the one at startSample, for encoding a segment of a long
+// recording. f must implement Seeker, and is seeked to startSample. A start
+// beyond the end of f is an error; a section running past the end of f is cut
+// short there. The result can itself be seeked, with indexes counted from the
+// start of the section.
+func Trim(f Format, startSample, numSamples uint64) (Format, error) {
+	seeker, ok := f.(Seeker)
+	if !ok {
+		return nil, fmt.Errorf("source format cannot seek")
+	}
+	total := f.TotalSamples()
+	if startSample > total {
+		return nil, fmt.Errorf("trim start %d out of range: %d samples", startSample, total)
+	}
+	if numSamples > total-startSample {
+		numSamples = total - startSample
+	}
+
+	t := &trimmed{Format: f, seeker: seeker, start: startSample, count: numSamples}
+	if err := t.Seek(0); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// TotalSamples returns the number of inter-channel samples in the section.
+func (t *trimmed) TotalSamples() uint64 {
+	return t.count
+}
+
+// Duration returns the playing time of the section.
+func (t *trimmed) Duration() time.Duration {
+	return duration(t.count, t.SampleRate())
+}
+
+// ReadSamples reads from the source, returning io.EOF once the section has
+// been read.
+func (t *trimmed) ReadSamples(buffer []int32) (int, error) {
+	if len(buffer) == 0 {
+		return 0, nil
+	}
+	if t.remaining == 0 {
+		return 0, io.EOF
+	}
+	if uint64(len(buffer)) > t.remaining {
+		buffer = buffer[:t.remaining]
+	}
+	n, err := t.Format.ReadSamples(buffer)
+	t.remaining -= uint64(n)
+	return n, err
+}
+
+// Seek moves to the inter-channel sample at sampleIndex, counted from the
+// start of the section. Seeking to TotalSamples is allowed and leaves nothing
+// more to read.
+func (t *trimmed) Seek(sampleIndex uint64) error {
+	if sampleIndex > t.count {
+		return fmt.Errorf("seek to sample %d out of range: %d samples", sampleIndex, t.count)
+	}
+	if err := t.seeker.Seek(t.start + sampleIndex); err != nil {
+		return err
+	}
+	t.remaining = (t.count - sampleIndex) * uint64(t.Channels())
+	return nil
+}
@@ -0,0 +1,71 @@
+package audio
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTrim(t *testing.T) {
+	source := rampFormat(t, 0, 3*8000)
+	f, err := Trim(source, 8000, 8000)
+	if err != nil {
+		t.Fatalf("Trim failed: %v", err)
+	}
+	if f.TotalSamples() != 8000 || f.Duration() != time.Second {
+		t.Errorf("expected 8000 samples lasting 1s, got %d lasting %v", f.TotalSamples(), f.Duration())
+	}
+	if got, want := readAll(t, f, 1001), rampFormat(t, 8000, 8000).samples; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the middle second of the input, got %d values starting with %v", len(got), got[:2])
+	}
+
+	if err := f.(Seeker).Seek(7990); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if got, want := readAll(t, f, 1001), rampFormat(t, 15990, 10).samples; !reflect.DeepEqual(got, want) {
+		t.Errorf("after Seek(7990): expected %v, got %v", want, got)
+	}
+	if err := f.(Seeker).Seek(8001); err == nil {
+		t.Errorf("expected an error seeking past the end of the section")
+	}
+}
+
+func TestTrimEdges(t *testing.T) {
+	tests := []struct {
+		name          string
+		start, count  uint64
+		expectedTotal uint64
+		expectedErr   string
+	}{
+		{name: "Whole input", start: 0, count: 100, expectedTotal: 100},
+		{name: "Past the remaining samples", start: 90, count: 50, expectedTotal: 10},
+		{name: "Start at the end", start: 100, count: 5, expectedTotal: 0},
+		{name: "Start beyond the end", start: 101, count: 5, expectedErr: "trim start 101 out of range: 100 samples"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Trim(rampFormat(t, 0, 100), tt.start, tt.count)
+			if tt.expectedErr != "" {
+				if err == nil || err.Error() != tt.expectedErr {
+					t.Errorf("expected error %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Trim failed: %v", err)
+			}
+			if f.TotalSamples() != tt.expectedTotal {
+				t.Errorf("expected %d samples, got %d", tt.expectedTotal, f.TotalSamples())
+			}
+			if got := readAll(t, f, 64); uint64(len(got)) != 2*tt.expectedTotal {
+				t.Errorf("expected %d values, got %d", 2*tt.expectedTotal, len(got))
+			}
+		})
+	}
+
+	stream := struct{ Format }{rampFormat(t, 0, 100)}
+	if _, err := Trim(stream, 0, 10); err == nil || err.Error() != "source format cannot seek" {
+		t.Errorf("expected an error for a source that cannot seek, got %v", err)
+	}
+}
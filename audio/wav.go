@@ -2,18 +2,69 @@ package audio
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"time"
 )
 
 const (
 	WAVHeaderSize = 44
+
+	// DefaultFloatBitDepth is the integer bit depth IEEE float samples are scaled to.
+	DefaultFloatBitDepth = 24
+)
+
+// ErrNoAudioData is returned by NewWAVFormat for a WAV file whose data chunk
+// holds no complete sample, such as a file that is only a header.
+var ErrNoAudioData = errors.New("no audio data")
+
+// Errors returned, possibly wrapped, by NewWAVFormat and NewWAVFormatReader.
+// ErrNotRIFF and ErrNotWAVE mean the input is not a WAV file at all, the
+// chunk errors a WAV file missing a chunk it needs, and ErrUnsupportedFormat
+// a WAV file holding audio in an encoding or layout that cannot be read.
+var (
+	ErrNotRIFF           = errors.New("not a valid RIFF file")
+	ErrNotWAVE           = errors.New("not a valid WAVE file")
+	ErrNoFmtChunk        = errors.New("fmt sub-chunk not found")
+	ErrNoDataChunk       = errors.New("data sub-chunk not found")
+	ErrUnsupportedFormat = errors.New("unsupported WAV audio format")
 )
 
+// WAV audio format codes, as found in the fmt chunk.
+const (
+	WAVFormatPCM        = 0x0001
+	WAVFormatIEEEFloat  = 0x0003
+	WAVFormatALaw       = 0x0006
+	WAVFormatMuLaw      = 0x0007
+	WAVFormatExtensible = 0xFFFE
+)
+
+// wavFormatNames names the audio formats that show up in error messages.
+var wavFormatNames = map[uint16]string{
+	WAVFormatPCM:        "PCM",
+	0x0002:              "Microsoft ADPCM",
+	WAVFormatIEEEFloat:  "IEEE float",
+	WAVFormatALaw:       "A-law",
+	WAVFormatMuLaw:      "mu-law",
+	0x0011:              "IMA ADPCM",
+	0x0055:              "MPEG Layer 3",
+	WAVFormatExtensible: "extensible",
+}
+
+// sizeInDS64 is the value an RF64 file stores in a 32-bit size field whose
+// real, 64-bit value is in the ds64 chunk.
+const sizeInDS64 = 0xFFFFFFFF
+
+// extensibleGUIDSuffix is the tail shared by the KSDATAFORMAT_SUBTYPE GUIDs of
+// WAVE_FORMAT_EXTENSIBLE; the first two bytes hold the actual format code.
+var extensibleGUIDSuffix = [14]byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
 type WAVFormat struct {
 	// RIFF chunk
-	ChunkID   [4]byte // Should be "RIFF"
+	ChunkID   [4]byte // Should be "RIFF", or "RF64" or "BW64" for files over 4 GiB
 	ChunkSize uint32  // 4 + (8 + SubChunk1Size) + (8 + SubChunk2Size)
 	Format    [4]byte // Should be "WAVE"
 
@@ -24,16 +75,39 @@ type WAVFormat struct {
 	NumChannels   uint16  // 1 for mono, 2 for stereo
 	Samplerate    uint32  // 8000, 44100, etc.
 	ByteRate      uint32  // SampleRate * NumChannels * BitsPerSample/8
-	BlockAlign    uint16  // NumChannels * BitsPerSample/8
-	BitsPerSample uint16  // 8 bits = 8, 16 bits = 16, etc.
+	BlockAlign    uint16  // NumChannels * bytes per sample container
+	BitsPerSample uint16  // 8 bits = 8, 16 bits = 16, 20 bits in a 3-byte container = 20, etc.
+
+	// fmt extension, present when Subchunk1Size > 16
+	ExtensionSize      uint16   // size of the extension that follows
+	ValidBitsPerSample uint16   // WAVE_FORMAT_EXTENSIBLE only
+	ChannelMask        uint32   // WAVE_FORMAT_EXTENSIBLE only
+	SubFormat          [16]byte // WAVE_FORMAT_EXTENSIBLE only: GUID of the actual format
 
 	// data sub-chunk
 	Subchunk2ID   [4]byte // Should be "data"
 	Subchunk2Size uint32  // NumSamples * NumChannels * BitsPerSample/8
 
+	// ds64 chunk, RF64 and BW64 files only: the 64-bit sizes of the RIFF and
+	// data chunks, whose 32-bit size fields then hold 0xFFFFFFFF
+	RIFFSize64  uint64
+	DataSize64  uint64
+	SampleCount uint64 // the 64-bit fact chunk sample count
+
+	// fact chunk, if any: the number of inter-channel samples, which
+	// TotalSamples prefers to the data chunk size
+	FactSampleLength uint32
+
 	// File handling
-	file       *os.File
+	r          io.ReadSeeker     // source of the WAV data
+	file       *os.File          // the file NewWAVFormat opened, closed by Close
+	data       *io.LimitedReader // audio data, bounded by the data chunk size
+	partial    []byte            // bytes of an incomplete sample carried between reads
 	dataOffset int64
+	hasFact    bool // whether FactSampleLength was read from a fact chunk
+
+	// floatBitDepth is the integer bit depth IEEE float samples are scaled to
+	floatBitDepth int
 }
 
 // NewWAVFormat opens a WAV file and reads its header.
@@ -48,59 +122,297 @@ func NewWAVFormat(path string) (*WAVFormat, error) {
 		return nil, fmt.Errorf("error opening file: %w", err)
 	}
 
-	wav := &WAVFormat{file: file}
-	if err := wav.readHeader(); err != nil {
+	wav, err := NewWAVFormatReader(file)
+	if err != nil {
 		file.Close()
 		return nil, err
 	}
+	wav.file = file
 
 	return wav, nil
 }
 
-// readHeader reads and validates the WAV file header.
+// NewWAVFormatReader reads a WAV header from r, which is parsed from its start,
+// such as a bytes.Reader over WAV data in memory or a file from an embed.FS.
+// Samples are read from r as they are needed, so it must stay usable for as
+// long as the WAVFormat is; Close does not close it.
+func NewWAVFormatReader(r io.ReadSeeker) (*WAVFormat, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error seeking to start: %w", err)
+	}
+
+	wav := &WAVFormat{r: r}
+	if err := wav.readHeader(); err != nil {
+		return nil, err
+	}
+	return wav, nil
+}
+
+// readHeader reads and validates the WAV file header. Chunks are visited in
+// file order by ID and size: fmt, fact and ds64 are parsed, unknown chunks
+// such as LIST, bext or JUNK are skipped, and reading stops at the start of the
+// data chunk.
 func (w *WAVFormat) readHeader() error {
 	// Read RIFF chunk
-	if err := binary.Read(w.file, binary.LittleEndian, &w.ChunkID); err != nil {
-		return fmt.Errorf("error reading ChunkID: %w", err)
+	if err := binary.Read(w.r, binary.LittleEndian, &w.ChunkID); err != nil {
+		return fmt.Errorf("%w: error reading ChunkID: %w", ErrNotRIFF, err)
+	}
+	if string(w.ChunkID[:]) != "RIFF" && !w.isRF64() {
+		return ErrNotRIFF
+	}
+
+	riffFields := []any{&w.ChunkSize, &w.Format}
+	for _, field := range riffFields {
+		if err := binary.Read(w.r, binary.LittleEndian, field); err != nil {
+			return fmt.Errorf("%w: error reading WAV header: %w", ErrNotWAVE, err)
+		}
+	}
+	if string(w.Format[:]) != "WAVE" {
+		return ErrNotWAVE
 	}
-	if string(w.ChunkID[:]) != "RIFF" {
-		return fmt.Errorf("not a valid RIFF file")
+
+	foundFmt := false
+	for {
+		var id [4]byte
+		var size uint32
+		if err := binary.Read(w.r, binary.LittleEndian, &id); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				if !foundFmt {
+					return ErrNoFmtChunk
+				}
+				return ErrNoDataChunk
+			}
+			return fmt.Errorf("error reading chunk ID: %w", err)
+		}
+		if err := binary.Read(w.r, binary.LittleEndian, &size); err != nil {
+			return fmt.Errorf("error reading %q chunk size: %w", id, err)
+		}
+
+		start, err := w.r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("error getting chunk offset: %w", err)
+		}
+
+		switch string(id[:]) {
+		case "fmt ":
+			w.Subchunk1ID, w.Subchunk1Size = id, size
+			if err := w.readFormat(); err != nil {
+				return err
+			}
+			foundFmt = true
+		case "fact":
+			if size < 4 {
+				return fmt.Errorf("fact chunk too short: %d bytes", size)
+			}
+			if err := binary.Read(w.r, binary.LittleEndian, &w.FactSampleLength); err != nil {
+				return fmt.Errorf("error reading fact chunk: %w", err)
+			}
+			w.hasFact = true
+		case "ds64":
+			if !w.isRF64() {
+				break
+			}
+			if err := w.readDS64(size); err != nil {
+				return err
+			}
+		case "data":
+			if !foundFmt {
+				return ErrNoFmtChunk
+			}
+			w.Subchunk2ID, w.Subchunk2Size = id, size
+			if w.audioSize() < uint64(w.BlockAlign) {
+				return fmt.Errorf("%w: data chunk of %d bytes holding %d samples", ErrNoAudioData, w.dataSize(), w.TotalSamples())
+			}
+
+			// Store the offset where the audio data begins, and stop reads
+			// at the end of the audio so padding and trailing chunks aren't
+			// read as samples
+			w.dataOffset = start
+			w.data = &io.LimitedReader{R: w.r, N: int64(w.audioSize())}
+			return nil
+		}
+
+		// Skip to the next chunk; chunk bodies are padded to an even size
+		next := start + int64(size) + int64(size%2)
+		if _, err := w.r.Seek(next, io.SeekStart); err != nil {
+			return fmt.Errorf("error skipping %q chunk: %w", id, err)
+		}
 	}
+}
+
+// isRF64 reports whether the file is an RF64 or BW64 file, whose chunk sizes
+// of 4 GiB or more are stored in a ds64 chunk.
+func (w *WAVFormat) isRF64() bool {
+	id := string(w.ChunkID[:])
+	return id == "RF64" || id == "BW64"
+}
 
-	headerFields := []any{
-		&w.ChunkSize, &w.Format,
-		&w.Subchunk1ID, &w.Subchunk1Size, &w.AudioFormat,
-		&w.NumChannels, &w.Samplerate, &w.ByteRate,
-		&w.BlockAlign, &w.BitsPerSample,
-		&w.Subchunk2ID, &w.Subchunk2Size,
+// readDS64 reads the body of the ds64 chunk of an RF64 file: the 64-bit RIFF
+// size, data size and sample count. The table of other chunk sizes that may
+// follow is left for the caller to skip.
+func (w *WAVFormat) readDS64(size uint32) error {
+	if size < 24 {
+		return fmt.Errorf("ds64 chunk too short: %d bytes", size)
+	}
+	ds64Fields := []any{&w.RIFFSize64, &w.DataSize64, &w.SampleCount}
+	for _, field := range ds64Fields {
+		if err := binary.Read(w.r, binary.LittleEndian, field); err != nil {
+			return fmt.Errorf("error reading ds64 chunk: %w", err)
+		}
 	}
+	return nil
+}
+
+// dataSize returns the size of the data chunk in bytes, taken from the ds64
+// chunk when the chunk's own size field defers to it.
+func (w *WAVFormat) dataSize() uint64 {
+	if w.isRF64() && w.Subchunk2Size == sizeInDS64 {
+		return w.DataSize64
+	}
+	return uint64(w.Subchunk2Size)
+}
 
-	for _, field := range headerFields {
-		if err := binary.Read(w.file, binary.LittleEndian, field); err != nil {
+// audioSize returns the number of bytes of audio in the data chunk: every
+// whole block of it, or only as many as the fact chunk's sample count covers.
+// A fact count the data chunk is too short for is ignored, as is a count of
+// 0, which some writers leave as a placeholder.
+func (w *WAVFormat) audioSize() uint64 {
+	size := w.dataSize() - w.dataSize()%uint64(w.BlockAlign)
+	if !w.hasFact {
+		return size
+	}
+	count := uint64(w.FactSampleLength)
+	if w.isRF64() && w.FactSampleLength == sizeInDS64 {
+		count = w.SampleCount
+	}
+	if count > 0 && count < size/uint64(w.BlockAlign) {
+		return count * uint64(w.BlockAlign)
+	}
+	return size
+}
+
+// readFormat reads the body of the fmt chunk, including any extension, and
+// checks the audio format is supported.
+func (w *WAVFormat) readFormat() error {
+	if w.Subchunk1Size < 16 {
+		return fmt.Errorf("fmt sub-chunk too short: %d bytes", w.Subchunk1Size)
+	}
+
+	formatFields := []any{
+		&w.AudioFormat, &w.NumChannels, &w.Samplerate,
+		&w.ByteRate, &w.BlockAlign, &w.BitsPerSample,
+	}
+	for _, field := range formatFields {
+		if err := binary.Read(w.r, binary.LittleEndian, field); err != nil {
 			return fmt.Errorf("error reading WAV header: %w", err)
 		}
 	}
 
-	if string(w.Format[:]) != "WAVE" {
-		return fmt.Errorf("not a valid WAVE file")
+	if w.Subchunk1Size > 16 {
+		if err := w.readFormatExtension(); err != nil {
+			return err
+		}
 	}
-	if string(w.Subchunk1ID[:]) != "fmt " {
-		return fmt.Errorf("fmt sub-chunk not found")
+	if err := w.checkAudioFormat(); err != nil {
+		return err
 	}
-	if string(w.Subchunk2ID[:]) != "data" {
-		return fmt.Errorf("data sub-chunk not found")
+	return w.checkLayout()
+}
+
+// checkLayout checks that the channel count, sample size and block alignment
+// are non-zero and agree with each other: a block holds one sample container
+// per channel, large enough for the sample size. Integer samples of a size
+// that is not a whole number of bytes, such as 12 or 20 bits, are stored in a
+// larger container of up to 4 bytes; floats fill theirs exactly. TotalSamples
+// and ReadSamples divide by these, so a corrupt fmt chunk must not get past here.
+func (w *WAVFormat) checkLayout() error {
+	switch {
+	case w.NumChannels == 0:
+		return fmt.Errorf("invalid WAV header: no channels")
+	case w.BitsPerSample == 0:
+		return fmt.Errorf("invalid WAV header: zero bits per sample")
+	case w.BlockAlign == 0:
+		return fmt.Errorf("invalid WAV header: block align is zero")
+	}
+	minContainer := (uint32(w.BitsPerSample) + 7) / 8
+	container := uint32(w.containerSize())
+	if uint32(w.BlockAlign)%uint32(w.NumChannels) != 0 || container < minContainer || (w.isFloat() && container != minContainer) {
+		return fmt.Errorf("invalid WAV header: block align %d does not match %d channels of %d bits, expected %d",
+			w.BlockAlign, w.NumChannels, w.BitsPerSample, uint32(w.NumChannels)*minContainer)
 	}
+	if !w.isFloat() && container > 4 {
+		return fmt.Errorf("%w: sample container of %d bytes for %d bits per sample", ErrUnsupportedFormat, container, w.BitsPerSample)
+	}
+	return nil
+}
 
-	// Store the offset where the audio data begins
-	dataOffset, err := w.file.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return fmt.Errorf("error getting data offset: %w", err)
+// containerSize returns the number of bytes each sample is stored in.
+func (w *WAVFormat) containerSize() int {
+	return int(w.BlockAlign) / int(w.NumChannels)
+}
+
+// readFormatExtension reads the fmt chunk past its first 16 bytes: the
+// extension size and, for WAVE_FORMAT_EXTENSIBLE, the valid bits, channel mask
+// and sub-format GUID. Anything else in the chunk is left for the caller to skip.
+func (w *WAVFormat) readFormatExtension() error {
+	remaining := int64(w.Subchunk1Size) - 16
+	if err := binary.Read(w.r, binary.LittleEndian, &w.ExtensionSize); err != nil {
+		return fmt.Errorf("error reading fmt extension: %w", err)
 	}
-	w.dataOffset = dataOffset
+	remaining -= 2
 
+	if w.AudioFormat == WAVFormatExtensible {
+		if w.ExtensionSize < 22 || remaining < 22 {
+			return fmt.Errorf("fmt extension too short for WAVE_FORMAT_EXTENSIBLE: %d bytes", w.ExtensionSize)
+		}
+		extensionFields := []any{&w.ValidBitsPerSample, &w.ChannelMask, &w.SubFormat}
+		for _, field := range extensionFields {
+			if err := binary.Read(w.r, binary.LittleEndian, field); err != nil {
+				return fmt.Errorf("error reading fmt extension: %w", err)
+			}
+		}
+	}
 	return nil
 }
 
+// formatCode returns the format the audio data is actually stored in, looking
+// through WAVE_FORMAT_EXTENSIBLE to its sub-format.
+func (w *WAVFormat) formatCode() uint16 {
+	if w.AudioFormat == WAVFormatExtensible {
+		return binary.LittleEndian.Uint16(w.SubFormat[:2])
+	}
+	return w.AudioFormat
+}
+
+// checkAudioFormat rejects audio formats other than integer PCM and 32 or 64-bit
+// IEEE float, the only ones ReadSamples can interpret.
+func (w *WAVFormat) checkAudioFormat() error {
+	if w.AudioFormat == WAVFormatExtensible && [14]byte(w.SubFormat[2:]) != extensibleGUIDSuffix {
+		return fmt.Errorf("%w: extensible with unknown sub-format %x", ErrUnsupportedFormat, w.SubFormat)
+	}
+
+	code := w.formatCode()
+	switch code {
+	case WAVFormatPCM:
+		return nil
+	case WAVFormatIEEEFloat:
+		if w.BitsPerSample != 32 && w.BitsPerSample != 64 {
+			return fmt.Errorf("%w: IEEE float at %d bits", ErrUnsupportedFormat, w.BitsPerSample)
+		}
+		w.floatBitDepth = DefaultFloatBitDepth
+		return nil
+	}
+
+	name, ok := wavFormatNames[code]
+	if !ok {
+		name = "unknown"
+	}
+	if w.AudioFormat == WAVFormatExtensible {
+		return fmt.Errorf("%w: extensible %d (%s)", ErrUnsupportedFormat, code, name)
+	}
+	return fmt.Errorf("%w: %d (%s)", ErrUnsupportedFormat, code, name)
+}
+
 // SampleRate returns the sample rate of the WAV file.
 func (w *WAVFormat) SampleRate() int {
 	return int(w.Samplerate)
@@ -111,66 +423,180 @@ func (w *WAVFormat) Channels() int {
 	return int(w.NumChannels)
 }
 
-// BitDepth returns the bit depth of the WAV file.
+// BitDepth returns the bit depth of the WAV file. For IEEE float files this is
+// the integer bit depth samples are scaled to, not the size of the floats.
 func (w *WAVFormat) BitDepth() int {
+	if w.isFloat() {
+		return w.floatBitDepth
+	}
 	return int(w.BitsPerSample)
 }
 
-// TotalSamples returns the total number of audio samples in the WAV file.
+// isFloat reports whether the audio data is stored as IEEE floats.
+func (w *WAVFormat) isFloat() bool {
+	return w.formatCode() == WAVFormatIEEEFloat
+}
+
+// SetFloatBitDepth sets the integer bit depth, between 8 and 32, that IEEE
+// float samples are scaled to. It defaults to DefaultFloatBitDepth and has no
+// effect on integer PCM files.
+func (w *WAVFormat) SetFloatBitDepth(bits int) error {
+	if !w.isFloat() {
+		return fmt.Errorf("not an IEEE float WAV file")
+	}
+	if bits < 8 || bits > 32 {
+		return fmt.Errorf("invalid float target bit depth %d: must be between 8 and 32", bits)
+	}
+	w.floatBitDepth = bits
+	return nil
+}
+
+// TotalSamples returns the total number of audio samples in the WAV file,
+// as the fact chunk records it if there is one.
 func (w *WAVFormat) TotalSamples() uint64 {
-	return uint64(w.Subchunk2Size) / uint64(w.BlockAlign)
+	return w.audioSize() / uint64(w.BlockAlign)
 }
 
-// ReadSamples reads audio samples into the provided buffer.
-func (w *WAVFormat) ReadSamples(buffer []int32) (int, error) {
-	// Calculate the number of bytes per sample based on bit depth.
-	bytesPerSample := w.BitDepth() / 8
-	samplesRead := 0
+// Duration returns the playing time of the WAV file.
+func (w *WAVFormat) Duration() time.Duration {
+	return duration(w.TotalSamples(), w.SampleRate())
+}
 
-	bytesBuffer := make([]byte, len(buffer)*bytesPerSample)
+// Seek moves to the inter-channel sample at sampleIndex. Seeking to
+// TotalSamples is allowed and leaves nothing more to read.
+func (w *WAVFormat) Seek(sampleIndex uint64) error {
+	if sampleIndex > w.TotalSamples() {
+		return fmt.Errorf("seek to sample %d out of range: %d samples", sampleIndex, w.TotalSamples())
+	}
+	offset := w.dataOffset + int64(sampleIndex)*int64(w.BlockAlign)
+	if _, err := w.r.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking to sample %d: %w", sampleIndex, err)
+	}
+	w.data.N = int64(w.audioSize()) - int64(sampleIndex)*int64(w.BlockAlign)
+	w.partial = w.partial[:0]
+	return nil
+}
 
-	n, err := w.file.Read(bytesBuffer)
-	if err != nil && err != io.EOF {
-		return 0, fmt.Errorf("error reading audio data: %w", err)
+// ReadSamples reads audio samples into the provided buffer. It keeps reading
+// until the buffer is full or the data chunk runs out, so short reads from the
+// file never split a sample; bytes of an incomplete sample are held for the
+// next call. Once the data chunk is exhausted it returns io.EOF, whatever
+// follows it in the file.
+func (w *WAVFormat) ReadSamples(buffer []int32) (int, error) {
+	// Calculate the number of bytes per sample based on the container size.
+	bytesPerSample := w.containerSize()
+	if len(buffer) == 0 {
+		return 0, nil
 	}
 
-	samplesRead = n / bytesPerSample
+	bytesBuffer := make([]byte, len(buffer)*bytesPerSample)
+	samplesRead, err := readWholeSamples(w.data, &w.partial, bytesBuffer, bytesPerSample)
+	if err != nil {
+		return 0, err
+	}
 
 	// Convert the raw byte data into 32-bit integer samples.
 	for i := 0; i < samplesRead; i++ {
 		sampleBytes := bytesBuffer[i*bytesPerSample : (i+1)*bytesPerSample]
-		buffer[i] = w.bytesToInt32(sampleBytes)
+		if w.isFloat() {
+			buffer[i] = w.floatToInt32(sampleBytes)
+		} else {
+			buffer[i] = w.bytesToInt32(sampleBytes)
+		}
+	}
+
+	return samplesRead, nil
+}
+
+// readWholeSamples fills bytesBuffer from r, reading until it is full or r runs
+// out, and returns the number of complete samples it holds, or io.EOF if r ends
+// before a complete sample. partial carries the bytes of an incomplete sample
+// from one call to the next; on a read error the bytes read so far are kept
+// there so nothing is lost if the caller retries.
+func readWholeSamples(r io.Reader, partial *[]byte, bytesBuffer []byte, bytesPerSample int) (int, error) {
+	// Start with whatever is left of a sample split by the previous read.
+	n := copy(bytesBuffer, *partial)
+	read, err := io.ReadFull(r, bytesBuffer[n:])
+	n += read
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		*partial = append((*partial)[:0], bytesBuffer[:n]...)
+		return 0, fmt.Errorf("error reading audio data: %w", err)
 	}
 
+	samplesRead := n / bytesPerSample
+	*partial = append((*partial)[:0], bytesBuffer[samplesRead*bytesPerSample:n]...)
+	if samplesRead == 0 && err != nil {
+		return 0, io.EOF
+	}
 	return samplesRead, nil
 }
 
-// bytesToInt32 converts a byte slice to a 32-bit integer based on the bit depth.
+// bytesToInt32 converts a sample container to a 32-bit integer at the file's
+// bit depth. Samples smaller than their container are stored in its high
+// bits, so the padding below them is shifted out, keeping the sign.
 func (w *WAVFormat) bytesToInt32(bytes []byte) int32 {
-	switch w.BitDepth() {
-	case 8:
+	return pcmToInt32(bytes, binary.LittleEndian, false) >> (8*len(bytes) - int(w.BitsPerSample))
+}
+
+// pcmToInt32 converts a 1 to 4-byte integer PCM sample in the given byte order
+// to a 32-bit integer. 8-bit samples are signed if signed8 is set, as in AIFF,
+// and otherwise unsigned and re-centred on zero, as in WAV.
+func pcmToInt32(bytes []byte, order binary.ByteOrder, signed8 bool) int32 {
+	switch len(bytes) {
+	case 1:
+		if signed8 {
+			return int32(int8(bytes[0]))
+		}
 		// convert the byte directly and adjust for unsigned range.
 		return int32(bytes[0]) - 128
-	case 16:
+	case 2:
 		// convert the byte slice to a 16-bit integer.
-		return int32(int16(binary.LittleEndian.Uint16(bytes)))
-	case 24:
+		return int32(int16(order.Uint16(bytes)))
+	case 3:
 		// manually construct the 32-bit integer and handle sign extension.
-		sample := int32(bytes[0]) | int32(bytes[1])<<8 | int32(bytes[2])<<16
+		b0, b2 := bytes[0], bytes[2]
+		if order == binary.BigEndian {
+			b0, b2 = b2, b0
+		}
+		sample := int32(b0) | int32(bytes[1])<<8 | int32(b2)<<16
 		if sample&0x800000 != 0 {
 			sample |= ^0xffffff // Sign extension for negative values.
 		}
 		return sample
-	case 32:
+	case 4:
 		// convert the byte slice to a 32-bit integer.
-		return int32(binary.LittleEndian.Uint32(bytes))
+		return int32(order.Uint32(bytes))
 	default:
 		// Return 0 for unsupported bit depths.
 		return 0
 	}
 }
 
-// Close closes the WAV file.
+// floatToInt32 converts a 4 or 8-byte IEEE float in [-1, 1] to an integer at
+// the float target bit depth. 1.0 maps to full-scale positive, -1.0 to
+// full-scale negative, and values beyond that range are clamped.
+func (w *WAVFormat) floatToInt32(bytes []byte) int32 {
+	var f float64
+	if len(bytes) == 8 {
+		f = math.Float64frombits(binary.LittleEndian.Uint64(bytes))
+	} else {
+		f = float64(math.Float32frombits(binary.LittleEndian.Uint32(bytes)))
+	}
+
+	scale := float64(int64(1) << (w.floatBitDepth - 1))
+	v := math.Round(f * scale)
+	switch {
+	case v >= scale:
+		return int32(scale - 1)
+	case v < -scale:
+		return int32(-scale)
+	default:
+		return int32(v)
+	}
+}
+
+// Close closes the WAV file opened by NewWAVFormat. A reader passed to
+// NewWAVFormatReader is left to its owner.
 func (w *WAVFormat) Close() error {
 	if w.file != nil {
 		return w.file.Close()
@@ -1,8 +1,17 @@
 package audio
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 const (
@@ -100,3 +109,860 @@ func TestNewWAVFormat(t *testing.T) {
 		})
 	}
 }
+
+// chunk returns a RIFF chunk with the given ID and body, padded to an even size.
+func chunk(id string, body []byte) []byte {
+	data := make([]byte, 8, 8+len(body)+1)
+	copy(data, id)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(body)))
+	data = append(data, body...)
+	if len(body)%2 == 1 {
+		data = append(data, 0)
+	}
+	return data
+}
+
+// fmtBody returns the body of a fmt chunk, followed by an optional extension.
+func fmtBody(format, channels uint16, sampleRate uint32, bitDepth uint16, extension []byte) []byte {
+	blockAlign := channels * ((bitDepth + 7) / 8)
+	body := binary.LittleEndian.AppendUint16(nil, format)
+	body = binary.LittleEndian.AppendUint16(body, channels)
+	body = binary.LittleEndian.AppendUint32(body, sampleRate)
+	body = binary.LittleEndian.AppendUint32(body, sampleRate*uint32(blockAlign))
+	body = binary.LittleEndian.AppendUint16(body, blockAlign)
+	body = binary.LittleEndian.AppendUint16(body, bitDepth)
+	return append(body, extension...)
+}
+
+// extensibleExtension returns a WAVE_FORMAT_EXTENSIBLE fmt extension for the given sub-format code.
+func extensibleExtension(subFormat uint16, validBits uint16) []byte {
+	ext := binary.LittleEndian.AppendUint16(nil, 22)
+	ext = binary.LittleEndian.AppendUint16(ext, validBits)
+	ext = binary.LittleEndian.AppendUint32(ext, 0x3) // front left, front right
+	ext = binary.LittleEndian.AppendUint16(ext, subFormat)
+	return append(ext, extensibleGUIDSuffix[:]...)
+}
+
+// riffWAV wraps chunks in a RIFF/WAVE header.
+func riffWAV(chunks ...[]byte) []byte {
+	body := []byte("WAVE")
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	return chunk("RIFF", body)
+}
+
+// writeTempWAV writes data to a temporary file and returns its path.
+func writeTempWAV(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.wav")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to write test WAV: %v", err)
+	}
+	return path
+}
+
+func TestNewWAVFormat8Bit(t *testing.T) {
+	// WAV stores 8-bit samples unsigned, 0x80 being silence
+	pcm := []byte{0x00, 0x7F, 0x80, 0x81, 0xFF}
+	data := riffWAV(chunk("fmt ", fmtBody(WAVFormatPCM, 1, 8000, 8, nil)), chunk("data", pcm))
+	wav, err := NewWAVFormatReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewWAVFormatReader failed: %v", err)
+	}
+	expected := []int32{-128, -1, 0, 1, 127}
+	if got := readAll(t, wav, 16); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestNewWAVFormatReader(t *testing.T) {
+	pcm := []byte{1, 0, 2, 0, 3, 0, 4, 0}
+	data := riffWAV(chunk("fmt ", fmtBody(WAVFormatPCM, 2, 44100, 16, nil)), chunk("data", pcm))
+
+	// Leave the reader somewhere other than its start
+	r := bytes.NewReader(data)
+	r.Seek(20, io.SeekStart)
+
+	wavFormat, err := NewWAVFormatReader(r)
+	if err != nil {
+		t.Fatalf("NewWAVFormatReader failed: %v", err)
+	}
+	if wavFormat.SampleRate() != 44100 || wavFormat.Channels() != 2 || wavFormat.BitDepth() != 16 {
+		t.Errorf("expected 44100 Hz, 2 channels, 16 bits, got %d Hz, %d channels, %d bits",
+			wavFormat.SampleRate(), wavFormat.Channels(), wavFormat.BitDepth())
+	}
+	if wavFormat.TotalSamples() != 2 {
+		t.Errorf("expected 2 total samples, got %d", wavFormat.TotalSamples())
+	}
+
+	buffer := make([]int32, 4)
+	if n, err := wavFormat.ReadSamples(buffer); err != nil || n != 4 || !reflect.DeepEqual(buffer, []int32{1, 2, 3, 4}) {
+		t.Errorf("expected to read samples [1 2 3 4], got %v (n=%d, err=%v)", buffer, n, err)
+	}
+	if err := wavFormat.Seek(1); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if n, err := wavFormat.ReadSamples(buffer); err != nil || n != 2 || buffer[0] != 3 {
+		t.Errorf("expected to read [3 4] after seeking, got %v (n=%d, err=%v)", buffer[:n], n, err)
+	}
+	if err := wavFormat.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+
+	if _, err := NewWAVFormatReader(bytes.NewReader([]byte("not a WAV file"))); err == nil {
+		t.Errorf("expected an error for data that is not a WAV file")
+	}
+}
+
+func TestNewWAVFormatAudioFormat(t *testing.T) {
+	pcm := []byte{1, 0, 2, 0, 3, 0, 4, 0}
+
+	tests := []struct {
+		name          string
+		fmtChunk      []byte
+		expectedErr   string
+		expectedDepth int
+	}{
+		{
+			name:          "PCM",
+			fmtChunk:      fmtBody(WAVFormatPCM, 2, 44100, 16, nil),
+			expectedDepth: 16,
+		},
+		{
+			name:        "Microsoft ADPCM",
+			fmtChunk:    fmtBody(0x0002, 2, 44100, 4, []byte{0, 0}),
+			expectedErr: "unsupported WAV audio format: 2 (Microsoft ADPCM)",
+		},
+		{
+			name:        "A-law",
+			fmtChunk:    fmtBody(WAVFormatALaw, 1, 8000, 8, []byte{0, 0}),
+			expectedErr: "unsupported WAV audio format: 6 (A-law)",
+		},
+		{
+			name:          "Extensible PCM",
+			fmtChunk:      fmtBody(WAVFormatExtensible, 2, 44100, 16, extensibleExtension(WAVFormatPCM, 16)),
+			expectedDepth: 16,
+		},
+		{
+			name:        "Extensible mu-law",
+			fmtChunk:    fmtBody(WAVFormatExtensible, 1, 8000, 8, extensibleExtension(WAVFormatMuLaw, 8)),
+			expectedErr: "unsupported WAV audio format: extensible 7 (mu-law)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTempWAV(t, riffWAV(chunk("fmt ", tt.fmtChunk), chunk("data", pcm)))
+
+			wavFormat, err := NewWAVFormat(path)
+			if tt.expectedErr != "" {
+				if err == nil || err.Error() != tt.expectedErr {
+					t.Fatalf("expected error %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewWAVFormat failed: %v", err)
+			}
+			defer wavFormat.Close()
+
+			if wavFormat.BitDepth() != tt.expectedDepth {
+				t.Errorf("expected bit depth %d, got %d", tt.expectedDepth, wavFormat.BitDepth())
+			}
+			buffer := make([]int32, 4)
+			n, err := wavFormat.ReadSamples(buffer)
+			if err != nil || n != 4 || buffer[3] != 4 {
+				t.Errorf("expected to read samples [1 2 3 4], got %v (n=%d, err=%v)", buffer, n, err)
+			}
+		})
+	}
+}
+
+func TestNewWAVFormatLayout(t *testing.T) {
+	pcm := []byte{1, 0, 2, 0, 3, 0, 4, 0}
+
+	// pcmFmt returns a PCM fmt chunk body with the layout fields given as is.
+	pcmFmt := func(channels, blockAlign, bitDepth uint16) []byte {
+		body := binary.LittleEndian.AppendUint16(nil, WAVFormatPCM)
+		body = binary.LittleEndian.AppendUint16(body, channels)
+		body = binary.LittleEndian.AppendUint32(body, 44100)
+		body = binary.LittleEndian.AppendUint32(body, 44100*uint32(blockAlign))
+		body = binary.LittleEndian.AppendUint16(body, blockAlign)
+		return binary.LittleEndian.AppendUint16(body, bitDepth)
+	}
+
+	tests := []struct {
+		name        string
+		fmtChunk    []byte
+		expectedErr string
+	}{
+		{
+			name:        "Zeroed fmt chunk",
+			fmtChunk:    make([]byte, 16),
+			expectedErr: "unsupported WAV audio format: 0 (unknown)",
+		},
+		{
+			name:        "PCM with zeroed layout",
+			fmtChunk:    pcmFmt(0, 0, 0),
+			expectedErr: "invalid WAV header: no channels",
+		},
+		{
+			name:        "Zero bits per sample",
+			fmtChunk:    pcmFmt(2, 4, 0),
+			expectedErr: "invalid WAV header: zero bits per sample",
+		},
+		{
+			name:        "20 bits in a 2-byte container",
+			fmtChunk:    pcmFmt(2, 4, 20),
+			expectedErr: "invalid WAV header: block align 4 does not match 2 channels of 20 bits, expected 6",
+		},
+		{
+			name:        "Block align not a multiple of the channels",
+			fmtChunk:    pcmFmt(2, 5, 16),
+			expectedErr: "invalid WAV header: block align 5 does not match 2 channels of 16 bits, expected 4",
+		},
+		{
+			name:        "5-byte container",
+			fmtChunk:    pcmFmt(1, 5, 40),
+			expectedErr: "unsupported WAV audio format: sample container of 5 bytes for 40 bits per sample",
+		},
+		{
+			name:        "Zero block align",
+			fmtChunk:    pcmFmt(2, 0, 16),
+			expectedErr: "invalid WAV header: block align is zero",
+		},
+		{
+			name:        "Block align for mono",
+			fmtChunk:    pcmFmt(2, 2, 16),
+			expectedErr: "invalid WAV header: block align 2 does not match 2 channels of 16 bits, expected 4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTempWAV(t, riffWAV(chunk("fmt ", tt.fmtChunk), chunk("data", pcm)))
+
+			wavFormat, err := NewWAVFormat(path)
+			if err == nil {
+				wavFormat.Close()
+			}
+			if err == nil || err.Error() != tt.expectedErr {
+				t.Fatalf("expected error %q, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestNewWAVFormatChunkOrdering(t *testing.T) {
+	pcm := []byte{1, 0, 2, 0, 3, 0, 4, 0}
+	fmtPCM := chunk("fmt ", fmtBody(WAVFormatPCM, 2, 44100, 16, nil))
+	list := chunk("LIST", append([]byte("INFO"), chunk("INAM", []byte("Title"))...))
+
+	tests := []struct {
+		name        string
+		chunks      [][]byte
+		expectedErr string
+	}{
+		{
+			name:   "LIST chunk before data",
+			chunks: [][]byte{fmtPCM, list, chunk("data", pcm)},
+		},
+		{
+			name:   "JUNK before fmt and odd-sized chunk before data",
+			chunks: [][]byte{chunk("JUNK", make([]byte, 28)), fmtPCM, chunk("bext", []byte{1, 2, 3}), chunk("data", pcm)},
+		},
+		{
+			name:   "18-byte fmt chunk",
+			chunks: [][]byte{chunk("fmt ", fmtBody(WAVFormatPCM, 2, 44100, 16, []byte{0, 0})), chunk("data", pcm)},
+		},
+		{
+			name:        "data before fmt",
+			chunks:      [][]byte{chunk("data", pcm), fmtPCM},
+			expectedErr: "fmt sub-chunk not found",
+		},
+		{
+			name:        "No data chunk",
+			chunks:      [][]byte{fmtPCM, list},
+			expectedErr: "data sub-chunk not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTempWAV(t, riffWAV(tt.chunks...))
+
+			wavFormat, err := NewWAVFormat(path)
+			if tt.expectedErr != "" {
+				if err == nil || err.Error() != tt.expectedErr {
+					t.Fatalf("expected error %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewWAVFormat failed: %v", err)
+			}
+			defer wavFormat.Close()
+
+			if wavFormat.TotalSamples() != 2 {
+				t.Errorf("expected 2 total samples, got %d", wavFormat.TotalSamples())
+			}
+			buffer := make([]int32, 4)
+			n, err := wavFormat.ReadSamples(buffer)
+			if err != nil || n != 4 || buffer[0] != 1 || buffer[3] != 4 {
+				t.Errorf("expected to read samples [1 2 3 4], got %v (n=%d, err=%v)", buffer, n, err)
+			}
+		})
+	}
+}
+
+func TestNewWAVFormatNoAudioData(t *testing.T) {
+	fmtPCM := chunk("fmt ", fmtBody(WAVFormatPCM, 2, 44100, 16, nil))
+
+	tests := []struct {
+		name   string
+		chunks [][]byte
+	}{
+		{name: "44-byte header only", chunks: [][]byte{fmtPCM, chunk("data", nil)}},
+		{name: "Less than one sample frame", chunks: [][]byte{fmtPCM, chunk("data", []byte{1, 0})}},
+		{name: "Empty data before a trailing chunk", chunks: [][]byte{fmtPCM, chunk("data", nil), chunk("LIST", []byte("INFO"))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTempWAV(t, riffWAV(tt.chunks...))
+			wavFormat, err := NewWAVFormat(path)
+			if !errors.Is(err, ErrNoAudioData) {
+				if wavFormat != nil {
+					wavFormat.Close()
+				}
+				t.Fatalf("expected ErrNoAudioData, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadSamples32Bit(t *testing.T) {
+	expected := []int32{math.MaxInt32, math.MinInt32, -1, 1}
+	var data []byte
+	for _, s := range expected {
+		data = binary.LittleEndian.AppendUint32(data, uint32(s))
+	}
+	path := writeTempWAV(t, riffWAV(chunk("fmt ", fmtBody(WAVFormatPCM, 2, 96000, 32, nil)), chunk("data", data)))
+
+	wavFormat, err := NewWAVFormat(path)
+	if err != nil {
+		t.Fatalf("NewWAVFormat failed: %v", err)
+	}
+	defer wavFormat.Close()
+
+	buffer := make([]int32, len(expected))
+	if n, err := wavFormat.ReadSamples(buffer); err != nil || n != len(expected) {
+		t.Fatalf("expected %d samples, got %d (err=%v)", len(expected), n, err)
+	}
+	if !reflect.DeepEqual(buffer, expected) {
+		t.Errorf("expected %v, got %v", expected, buffer)
+	}
+}
+
+func TestReadSamplesContainer(t *testing.T) {
+	tests := []struct {
+		name      string
+		bitDepth  uint16
+		container int
+		expected  []int32
+	}{
+		{name: "20 bits in 3 bytes", bitDepth: 20, container: 3, expected: []int32{1<<19 - 1, -1 << 19, 1, -1, 0, 12345}},
+		{name: "12 bits in 2 bytes", bitDepth: 12, container: 2, expected: []int32{1<<11 - 1, -1 << 11, 1, -1, 0, -1234}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Samples sit in the high bits of their container, zero padded below
+			var data []byte
+			for _, s := range tt.expected {
+				stored := uint32(s) << (8*tt.container - int(tt.bitDepth))
+				data = binary.LittleEndian.AppendUint32(data, stored)[:len(data)+tt.container]
+			}
+			path := writeTempWAV(t, riffWAV(chunk("fmt ", fmtBody(WAVFormatPCM, 2, 48000, tt.bitDepth, nil)), chunk("data", data)))
+
+			wavFormat, err := NewWAVFormat(path)
+			if err != nil {
+				t.Fatalf("NewWAVFormat failed: %v", err)
+			}
+			defer wavFormat.Close()
+
+			if wavFormat.BitDepth() != int(tt.bitDepth) || wavFormat.TotalSamples() != uint64(len(tt.expected)/2) {
+				t.Errorf("expected %d bits and %d samples, got %d bits and %d samples",
+					tt.bitDepth, len(tt.expected)/2, wavFormat.BitDepth(), wavFormat.TotalSamples())
+			}
+			buffer := make([]int32, len(tt.expected))
+			if n, err := wavFormat.ReadSamples(buffer); err != nil || n != len(tt.expected) {
+				t.Fatalf("expected %d samples, got %d (err=%v)", len(tt.expected), n, err)
+			}
+			if !reflect.DeepEqual(buffer, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, buffer)
+			}
+		})
+	}
+}
+
+func TestReadSamplesIEEEFloat(t *testing.T) {
+	values := []float64{1.0, -1.0, 0.5, 0, 1.5, -1.5}
+
+	tests := []struct {
+		name        string
+		floatBits   uint16
+		extensible  bool
+		targetDepth int
+		expected    []int32
+	}{
+		{
+			name:        "32-bit float to default 24-bit",
+			floatBits:   32,
+			targetDepth: DefaultFloatBitDepth,
+			expected:    []int32{8388607, -8388608, 4194304, 0, 8388607, -8388608},
+		},
+		{
+			name:        "64-bit float to default 24-bit",
+			floatBits:   64,
+			targetDepth: DefaultFloatBitDepth,
+			expected:    []int32{8388607, -8388608, 4194304, 0, 8388607, -8388608},
+		},
+		{
+			name:        "Extensible 32-bit float to 16-bit",
+			floatBits:   32,
+			extensible:  true,
+			targetDepth: 16,
+			expected:    []int32{32767, -32768, 16384, 0, 32767, -32768},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var data []byte
+			for _, v := range values {
+				if tt.floatBits == 64 {
+					data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+				} else {
+					data = binary.LittleEndian.AppendUint32(data, math.Float32bits(float32(v)))
+				}
+			}
+			fmtChunk := fmtBody(WAVFormatIEEEFloat, 1, 48000, tt.floatBits, []byte{0, 0})
+			if tt.extensible {
+				fmtChunk = fmtBody(WAVFormatExtensible, 1, 48000, tt.floatBits, extensibleExtension(WAVFormatIEEEFloat, tt.floatBits))
+			}
+			path := writeTempWAV(t, riffWAV(chunk("fmt ", fmtChunk), chunk("data", data)))
+
+			wavFormat, err := NewWAVFormat(path)
+			if err != nil {
+				t.Fatalf("NewWAVFormat failed: %v", err)
+			}
+			defer wavFormat.Close()
+
+			if tt.targetDepth != DefaultFloatBitDepth {
+				if err := wavFormat.SetFloatBitDepth(tt.targetDepth); err != nil {
+					t.Fatalf("SetFloatBitDepth failed: %v", err)
+				}
+			}
+			if wavFormat.BitDepth() != tt.targetDepth {
+				t.Errorf("expected bit depth %d, got %d", tt.targetDepth, wavFormat.BitDepth())
+			}
+			if wavFormat.TotalSamples() != uint64(len(values)) {
+				t.Errorf("expected %d total samples, got %d", len(values), wavFormat.TotalSamples())
+			}
+
+			buffer := make([]int32, len(values))
+			n, err := wavFormat.ReadSamples(buffer)
+			if err != nil {
+				t.Fatalf("ReadSamples failed: %v", err)
+			}
+			if n != len(values) {
+				t.Fatalf("expected %d samples, got %d", len(values), n)
+			}
+			for i, want := range tt.expected {
+				if buffer[i] != want {
+					t.Errorf("sample %d (%v): expected %d, got %d", i, values[i], want, buffer[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDuration(t *testing.T) {
+	wavFormat, err := NewWAVFormat(sampleWavPath)
+	if err != nil {
+		t.Fatalf("NewWAVFormat failed: %v", err)
+	}
+	defer wavFormat.Close()
+
+	got := wavFormat.Duration()
+	if got <= 0 {
+		t.Fatalf("expected a positive duration, got %v", got)
+	}
+	want := time.Duration(wavFormat.TotalSamples()) * time.Second / time.Duration(wavFormat.SampleRate())
+	if got != want {
+		t.Errorf("expected duration %v, got %v", want, got)
+	}
+
+	tests := []struct {
+		name         string
+		totalSamples uint64
+		sampleRate   int
+		expected     time.Duration
+	}{
+		{"One second", 44100, 44100, time.Second},
+		{"Fractional", 22050, 44100, 500 * time.Millisecond},
+		{"Unknown sample rate", 44100, 0, 0},
+		{"Full 36-bit sample count", 1<<36 - 1, 44100, 1558264*time.Second + 778571428*time.Nanosecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := duration(tt.totalSamples, tt.sampleRate); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSeek(t *testing.T) {
+	wavFormat, err := NewWAVFormat(sampleWavPath)
+	if err != nil {
+		t.Fatalf("NewWAVFormat failed: %v", err)
+	}
+	defer wavFormat.Close()
+
+	var _ Seeker = wavFormat
+
+	first := make([]int32, 4096)
+	n, err := wavFormat.ReadSamples(first)
+	if err != nil || n != len(first) {
+		t.Fatalf("ReadSamples failed: read %d, err: %v", n, err)
+	}
+
+	if err := wavFormat.Seek(0); err != nil {
+		t.Fatalf("Seek(0) failed: %v", err)
+	}
+	again := make([]int32, len(first))
+	if n, err := wavFormat.ReadSamples(again); err != nil || n != len(again) {
+		t.Fatalf("ReadSamples after seek failed: read %d, err: %v", n, err)
+	}
+	if !reflect.DeepEqual(first, again) {
+		t.Errorf("expected identical samples after seeking back to 0")
+	}
+
+	// Seeking into the middle lands on an inter-channel sample boundary.
+	channels := wavFormat.Channels()
+	if err := wavFormat.Seek(100); err != nil {
+		t.Fatalf("Seek(100) failed: %v", err)
+	}
+	middle := make([]int32, channels)
+	if _, err := wavFormat.ReadSamples(middle); err != nil {
+		t.Fatalf("ReadSamples after seek failed: %v", err)
+	}
+	if !reflect.DeepEqual(middle, first[100*channels:101*channels]) {
+		t.Errorf("expected sample 100 to be %v, got %v", first[100*channels:101*channels], middle)
+	}
+
+	if err := wavFormat.Seek(wavFormat.TotalSamples()); err != nil {
+		t.Errorf("expected seeking to the end to succeed, got: %v", err)
+	}
+	if err := wavFormat.Seek(wavFormat.TotalSamples() + 1); err == nil {
+		t.Errorf("expected an error seeking past the end")
+	}
+}
+
+// failOnceReader returns err once, after failAfter bytes have been read.
+type failOnceReader struct {
+	r         io.Reader
+	failAfter int
+	err       error
+	read      int
+}
+
+func (f *failOnceReader) Read(p []byte) (int, error) {
+	if f.err != nil && f.read >= f.failAfter {
+		err := f.err
+		f.err = nil
+		return 0, err
+	}
+	if f.err != nil && f.read+len(p) > f.failAfter {
+		p = p[:f.failAfter-f.read]
+	}
+	n, err := f.r.Read(p)
+	f.read += n
+	return n, err
+}
+
+func TestReadSamplesPartialReads(t *testing.T) {
+	expected := []int32{1, -1, 8388607, -8388608, 0x123456, -0x123456}
+	var data []byte
+	for _, v := range expected {
+		data = append(data, byte(v), byte(v>>8), byte(v>>16))
+	}
+	path := writeTempWAV(t, riffWAV(chunk("fmt ", fmtBody(WAVFormatPCM, 2, 44100, 24, nil)), chunk("data", data)))
+
+	tests := []struct {
+		name   string
+		reader func(io.Reader) io.Reader
+		chunk  int
+	}{
+		{
+			name:   "One byte at a time",
+			reader: iotest.OneByteReader,
+			chunk:  len(expected),
+		},
+		{
+			name: "Error mid-sample",
+			reader: func(r io.Reader) io.Reader {
+				return &failOnceReader{r: iotest.OneByteReader(r), failAfter: 4, err: errors.New("transient")}
+			},
+			chunk: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wavFormat, err := NewWAVFormat(path)
+			if err != nil {
+				t.Fatalf("NewWAVFormat failed: %v", err)
+			}
+			defer wavFormat.Close()
+			wavFormat.data.R = tt.reader(wavFormat.file)
+
+			var got []int32
+			buffer := make([]int32, tt.chunk)
+			for attempts := 0; len(got) < len(expected) && attempts < 10; attempts++ {
+				n, err := wavFormat.ReadSamples(buffer)
+				got = append(got, buffer[:n]...)
+				if err == io.EOF {
+					break
+				}
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("expected samples %v, got %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestReadSamplesTrailingChunks(t *testing.T) {
+	expected := []int32{1, -1, 2, -2, 3, -3}
+	var data []byte
+	for _, v := range expected {
+		data = binary.LittleEndian.AppendUint16(data, uint16(v))
+	}
+	info := chunk("LIST", append([]byte("INFOINAM"), 0x06, 0, 0, 0, 't', 'i', 't', 'l', 'e', 0))
+	path := writeTempWAV(t, riffWAV(chunk("fmt ", fmtBody(WAVFormatPCM, 2, 44100, 16, nil)), chunk("data", data), info))
+
+	wavFormat, err := NewWAVFormat(path)
+	if err != nil {
+		t.Fatalf("NewWAVFormat failed: %v", err)
+	}
+	defer wavFormat.Close()
+
+	var got []int32
+	buffer := make([]int32, 4)
+	for {
+		n, err := wavFormat.ReadSamples(buffer)
+		got = append(got, buffer[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadSamples failed: %v", err)
+		}
+	}
+	if want := wavFormat.TotalSamples() * uint64(wavFormat.Channels()); uint64(len(got)) != want {
+		t.Fatalf("expected %d samples, got %d", want, len(got))
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected samples %v, got %v", expected, got)
+	}
+
+	// Seeking back re-opens the data chunk.
+	if err := wavFormat.Seek(2); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	n, err := wavFormat.ReadSamples(buffer)
+	if err != nil || n != 2 || buffer[0] != 3 || buffer[1] != -3 {
+		t.Errorf("expected [3 -3] after seeking to the last sample, got %v (err: %v)", buffer[:n], err)
+	}
+	if _, err := wavFormat.ReadSamples(buffer); err != io.EOF {
+		t.Errorf("expected io.EOF at the end of the data chunk, got: %v", err)
+	}
+}
+
+func TestNewWAVFormatRF64(t *testing.T) {
+	const dataSize = 6 * 3600 * 48000 * 2 * 3 // 6 hours of 48 kHz stereo 24-bit audio
+	ds64 := binary.LittleEndian.AppendUint64(nil, dataSize+100)
+	ds64 = binary.LittleEndian.AppendUint64(ds64, dataSize)
+	ds64 = binary.LittleEndian.AppendUint64(ds64, dataSize/6)
+	ds64 = binary.LittleEndian.AppendUint32(ds64, 0) // no table entries
+
+	// Only the start of the audio is present; the header claims the rest
+	pcm := []byte{1, 0, 0, 2, 0, 0, 3, 0, 0, 4, 0, 0}
+	data := chunk("data", pcm)
+	binary.LittleEndian.PutUint32(data[4:], sizeInDS64)
+	file := riffWAV(chunk("ds64", ds64), chunk("fmt ", fmtBody(WAVFormatPCM, 2, 48000, 24, nil)), data)
+	copy(file, "RF64")
+	binary.LittleEndian.PutUint32(file[4:], sizeInDS64)
+
+	wavFormat, err := NewWAVFormatReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("NewWAVFormatReader failed: %v", err)
+	}
+	if want := uint64(dataSize / 6); wavFormat.TotalSamples() != want {
+		t.Errorf("expected %d total samples, got %d", want, wavFormat.TotalSamples())
+	}
+	if wavFormat.Duration() != 6*time.Hour {
+		t.Errorf("expected a duration of 6h, got %v", wavFormat.Duration())
+	}
+	buffer := make([]int32, 4)
+	if n, err := wavFormat.ReadSamples(buffer); err != nil || n != 4 || !reflect.DeepEqual(buffer, []int32{1, 2, 3, 4}) {
+		t.Errorf("expected to read samples [1 2 3 4], got %v (n=%d, err=%v)", buffer, n, err)
+	}
+
+	// A ds64 chunk in a plain RIFF file is skipped like any unknown chunk
+	file = riffWAV(chunk("ds64", ds64), chunk("fmt ", fmtBody(WAVFormatPCM, 2, 48000, 24, nil)), chunk("data", pcm))
+	wavFormat, err = NewWAVFormatReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("NewWAVFormatReader failed: %v", err)
+	}
+	if wavFormat.TotalSamples() != 2 {
+		t.Errorf("expected 2 total samples in a RIFF file, got %d", wavFormat.TotalSamples())
+	}
+}
+
+func TestNewWAVFormatFact(t *testing.T) {
+	// Four stereo 16-bit samples, the last being padding when the fact chunk says so
+	pcm := []byte{1, 0, 2, 0, 3, 0, 4, 0, 5, 0, 6, 0, 0, 0, 0, 0}
+	format := chunk("fmt ", fmtBody(WAVFormatPCM, 2, 44100, 16, nil))
+
+	tests := []struct {
+		name        string
+		fact        []byte
+		expected    []int32
+		expectedErr string
+	}{
+		{
+			name:     "Fact count below data size",
+			fact:     binary.LittleEndian.AppendUint32(nil, 3),
+			expected: []int32{1, 2, 3, 4, 5, 6},
+		},
+		{
+			name:     "Fact count matching data size",
+			fact:     binary.LittleEndian.AppendUint32(nil, 4),
+			expected: []int32{1, 2, 3, 4, 5, 6, 0, 0},
+		},
+		{
+			name:     "Fact count past data size ignored",
+			fact:     binary.LittleEndian.AppendUint32(nil, 10),
+			expected: []int32{1, 2, 3, 4, 5, 6, 0, 0},
+		},
+		{
+			name:     "Placeholder fact count of zero ignored",
+			fact:     binary.LittleEndian.AppendUint32(nil, 0),
+			expected: []int32{1, 2, 3, 4, 5, 6, 0, 0},
+		},
+		{
+			name:        "Fact chunk too short",
+			fact:        []byte{3, 0},
+			expectedErr: "fact chunk too short: 2 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wavFormat, err := NewWAVFormatReader(bytes.NewReader(riffWAV(format, chunk("fact", tt.fact), chunk("data", pcm))))
+			if tt.expectedErr != "" {
+				if err == nil || err.Error() != tt.expectedErr {
+					t.Fatalf("expected error %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewWAVFormatReader failed: %v", err)
+			}
+
+			total := uint64(len(tt.expected) / 2)
+			if wavFormat.TotalSamples() != total {
+				t.Errorf("expected %d total samples, got %d", total, wavFormat.TotalSamples())
+			}
+			if got := readAll(t, wavFormat, 3); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected samples %v, got %v", tt.expected, got)
+			}
+
+			// Seeking is bounded by the same count
+			if err := wavFormat.Seek(total - 1); err != nil {
+				t.Fatalf("Seek failed: %v", err)
+			}
+			if got := readAll(t, wavFormat, 4); !reflect.DeepEqual(got, tt.expected[len(tt.expected)-2:]) {
+				t.Errorf("expected %v after seeking to the last sample, got %v", tt.expected[len(tt.expected)-2:], got)
+			}
+			if err := wavFormat.Seek(total + 1); err == nil {
+				t.Errorf("expected an error seeking past sample %d", total)
+			}
+		})
+	}
+}
+
+func TestReadSamplesTrailingFragment(t *testing.T) {
+	// Two 3-channel 16-bit samples, then 4 bytes holding only 2 channels of a third
+	pcm := []byte{1, 0, 2, 0, 3, 0, 4, 0, 5, 0, 6, 0, 7, 0, 8, 0}
+	file := riffWAV(chunk("fmt ", fmtBody(WAVFormatPCM, 3, 44100, 16, nil)), chunk("data", pcm))
+	wavFormat, err := NewWAVFormatReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("NewWAVFormatReader failed: %v", err)
+	}
+	if wavFormat.TotalSamples() != 2 {
+		t.Errorf("expected 2 total samples, got %d", wavFormat.TotalSamples())
+	}
+	if got := readAll(t, wavFormat, 4); !reflect.DeepEqual(got, []int32{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("expected only whole samples [1 2 3 4 5 6], got %v", got)
+	}
+}
+
+func TestNewWAVFormatSentinelErrors(t *testing.T) {
+	pcm := []byte{1, 0, 2, 0}
+	fmtPCM := chunk("fmt ", fmtBody(WAVFormatPCM, 2, 44100, 16, nil))
+	notWAVE := riffWAV(fmtPCM, chunk("data", pcm))
+	copy(notWAVE[8:], "AVI ")
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{name: "Empty input", data: nil, expected: ErrNotRIFF},
+		{name: "Text file", data: []byte("just some text, not audio"), expected: ErrNotRIFF},
+		{name: "RIFF but not WAVE", data: notWAVE, expected: ErrNotWAVE},
+		{name: "RIFF cut short", data: []byte("RIFF\x04\x00"), expected: ErrNotWAVE},
+		{name: "No fmt chunk", data: riffWAV(chunk("LIST", []byte("INFO"))), expected: ErrNoFmtChunk},
+		{name: "data before fmt", data: riffWAV(chunk("data", pcm), fmtPCM), expected: ErrNoFmtChunk},
+		{name: "No data chunk", data: riffWAV(fmtPCM), expected: ErrNoDataChunk},
+		{name: "ADPCM", data: riffWAV(chunk("fmt ", fmtBody(0x0002, 2, 44100, 4, nil)), chunk("data", pcm)), expected: ErrUnsupportedFormat},
+		{
+			name:     "Extensible mu-law",
+			data:     riffWAV(chunk("fmt ", fmtBody(WAVFormatExtensible, 2, 44100, 8, extensibleExtension(WAVFormatMuLaw, 8))), chunk("data", pcm)),
+			expected: ErrUnsupportedFormat,
+		},
+		{name: "16-bit float", data: riffWAV(chunk("fmt ", fmtBody(WAVFormatIEEEFloat, 2, 44100, 16, nil)), chunk("data", pcm)), expected: ErrUnsupportedFormat},
+		{name: "No samples", data: riffWAV(fmtPCM, chunk("data", nil)), expected: ErrNoAudioData},
+	}
+
+	sentinels := []error{ErrNotRIFF, ErrNotWAVE, ErrNoFmtChunk, ErrNoDataChunk, ErrUnsupportedFormat, ErrNoAudioData}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWAVFormatReader(bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, err)
+			}
+			for _, other := range sentinels {
+				if other != tt.expected && errors.Is(err, other) {
+					t.Errorf("expected only %v, but error %v also matches %v", tt.expected, err, other)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// WAVWriter writes interleaved integer samples to a PCM WAV file with the
+// canonical 44-byte header. Samples are stored little-endian in the fewest
+// whole bytes that hold them, in the high bits of their container for sizes
+// such as 20 bits, and unsigned when they fit in a byte, as WAV readers
+// expect.
+//
+// The sizes in the header are only known once every sample is written. If the
+// underlying writer is an io.Seeker, Close seeks back and fills them in;
+// otherwise they are written as 0xFFFFFFFF, the usual marker of a WAV stream
+// of unknown length, and readers must read the data to its end.
+type WAVWriter struct {
+	w         io.Writer
+	seeker    io.Seeker // w, if it can seek
+	start     int64     // offset of the header in w
+	channels  int
+	bitDepth  int
+	container int    // bytes per sample
+	dataSize  uint64 // bytes of samples written so far
+	buf       []byte
+	closed    bool
+}
+
+// NewWAVWriter writes the header of a WAV file holding channels channels of
+// bitDepth-bit samples at rate samples per second to w, and returns a
+// WAVWriter to write the samples with.
+func NewWAVWriter(w io.Writer, rate, channels, bitDepth int) (*WAVWriter, error) {
+	if rate <= 0 || uint64(rate) > math.MaxUint32 {
+		return nil, fmt.Errorf("invalid sample rate: %d", rate)
+	}
+	if channels <= 0 || channels > math.MaxUint16 {
+		return nil, fmt.Errorf("invalid number of channels: %d", channels)
+	}
+	if bitDepth < 1 || bitDepth > 32 {
+		return nil, fmt.Errorf("unsupported bit depth: %d", bitDepth)
+	}
+
+	ww := &WAVWriter{w: w, channels: channels, bitDepth: bitDepth, container: (bitDepth + 7) / 8}
+	if blockAlign := channels * ww.container; blockAlign > math.MaxUint16 || uint64(rate)*uint64(blockAlign) > math.MaxUint32 {
+		return nil, fmt.Errorf("%d channels of %d bits at %d Hz do not fit a WAV header", channels, bitDepth, rate)
+	}
+	if seeker, ok := w.(io.Seeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			ww.seeker, ww.start = seeker, start
+		}
+	}
+
+	if _, err := w.Write(ww.header(rate)); err != nil {
+		return nil, fmt.Errorf("error writing WAV header: %w", err)
+	}
+	return ww, nil
+}
+
+// header returns the 44-byte WAV header, its sizes left as 0xFFFFFFFF for a
+// writer that cannot seek and 0 for one that can, to be patched by Close.
+func (ww *WAVWriter) header(rate int) []byte {
+	riffSize, dataSize := uint32(math.MaxUint32), uint32(math.MaxUint32)
+	if ww.seeker != nil {
+		riffSize, dataSize = WAVHeaderSize-8, 0
+	}
+	blockAlign := ww.channels * ww.container
+
+	header := make([]byte, 0, WAVHeaderSize)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, riffSize)
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)
+	header = binary.LittleEndian.AppendUint16(header, WAVFormatPCM)
+	header = binary.LittleEndian.AppendUint16(header, uint16(ww.channels))
+	header = binary.LittleEndian.AppendUint32(header, uint32(rate))
+	header = binary.LittleEndian.AppendUint32(header, uint32(rate*blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, uint16(blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, uint16(ww.bitDepth))
+	header = append(header, "data"...)
+	return binary.LittleEndian.AppendUint32(header, dataSize)
+}
+
+// WriteSamples writes interleaved samples, which must be whole inter-channel
+// samples fitting in the writer's bit depth; bits above it are dropped.
+func (ww *WAVWriter) WriteSamples(samples []int32) error {
+	if ww.closed {
+		return fmt.Errorf("write to closed WAV writer")
+	}
+	if len(samples)%ww.channels != 0 {
+		return fmt.Errorf("%d samples do not divide into %d channels", len(samples), ww.channels)
+	}
+	size := uint64(len(samples) * ww.container)
+	if ww.dataSize+size+(ww.dataSize+size)%2 > math.MaxUint32-(WAVHeaderSize-8) {
+		return fmt.Errorf("WAV data chunk would exceed 4 GiB")
+	}
+
+	shift := uint(8*ww.container - ww.bitDepth)
+	ww.buf = ww.buf[:0]
+	for _, s := range samples {
+		v := uint32(s) << shift
+		if ww.container == 1 {
+			v += 0x80
+		}
+		for i := 0; i < ww.container; i++ {
+			ww.buf = append(ww.buf, byte(v>>(8*i)))
+		}
+	}
+	if _, err := ww.w.Write(ww.buf); err != nil {
+		return fmt.Errorf("error writing samples: %w", err)
+	}
+	ww.dataSize += size
+	return nil
+}
+
+// Close pads the data chunk to an even size and, if the underlying writer can
+// seek, fills in the sizes in the header, leaving the writer positioned after
+// the data. It does not close the underlying writer.
+func (ww *WAVWriter) Close() error {
+	if ww.closed {
+		return nil
+	}
+	ww.closed = true
+
+	if ww.dataSize%2 == 1 {
+		if _, err := ww.w.Write([]byte{0}); err != nil {
+			return fmt.Errorf("error writing pad byte: %w", err)
+		}
+	}
+	if ww.seeker == nil {
+		return nil
+	}
+
+	riffSize := uint32(WAVHeaderSize - 8 + ww.dataSize + ww.dataSize%2)
+	patches := []struct {
+		offset int64
+		value  uint32
+	}{
+		{offset: 4, value: riffSize},
+		{offset: WAVHeaderSize - 4, value: uint32(ww.dataSize)},
+	}
+	for _, p := range patches {
+		if _, err := ww.seeker.Seek(ww.start+p.offset, io.SeekStart); err != nil {
+			return fmt.Errorf("error seeking to WAV header: %w", err)
+		}
+		if _, err := ww.w.Write(binary.LittleEndian.AppendUint32(nil, p.value)); err != nil {
+			return fmt.Errorf("error patching WAV header: %w", err)
+		}
+	}
+	end := ww.start + WAVHeaderSize + int64(ww.dataSize+ww.dataSize%2)
+	if _, err := ww.seeker.Seek(end, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking past WAV data: %w", err)
+	}
+	return nil
+}
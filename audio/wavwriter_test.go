@@ -0,0 +1,130 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWAVWriterRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels int
+		bitDepth int
+		samples  []int32
+	}{
+		{name: "8-bit mono with an odd data size", channels: 1, bitDepth: 8, samples: []int32{-128, -1, 0, 1, 127}},
+		{name: "16-bit stereo", channels: 2, bitDepth: 16, samples: []int32{-32768, 32767, 1, -1, 0, 1000}},
+		{name: "20-bit stereo", channels: 2, bitDepth: 20, samples: []int32{-524288, 524287, 1, -1}},
+		{name: "24-bit with 3 channels", channels: 3, bitDepth: 24, samples: []int32{-8388608, 8388607, 0, 5, 6, 7}},
+		{name: "32-bit mono", channels: 1, bitDepth: 32, samples: []int32{-2147483648, 2147483647, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out.wav")
+			file, err := os.Create(path)
+			if err != nil {
+				t.Fatalf("failed to create output: %v", err)
+			}
+			defer file.Close()
+
+			w, err := NewWAVWriter(file, 48000, tt.channels, tt.bitDepth)
+			if err != nil {
+				t.Fatalf("NewWAVWriter failed: %v", err)
+			}
+			// Write in two calls, split between inter-channel samples
+			split := len(tt.samples) / tt.channels / 2 * tt.channels
+			for _, part := range [][]int32{tt.samples[:split], tt.samples[split:]} {
+				if err := w.WriteSamples(part); err != nil {
+					t.Fatalf("WriteSamples failed: %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			wavFormat, err := NewWAVFormat(path)
+			if err != nil {
+				t.Fatalf("NewWAVFormat failed: %v", err)
+			}
+			defer wavFormat.Close()
+			if wavFormat.SampleRate() != 48000 || wavFormat.Channels() != tt.channels || wavFormat.BitDepth() != tt.bitDepth {
+				t.Errorf("expected 48000 Hz, %d channels and %d bits, got %d Hz, %d channels and %d bits",
+					tt.channels, tt.bitDepth, wavFormat.SampleRate(), wavFormat.Channels(), wavFormat.BitDepth())
+			}
+			if want := uint64(len(tt.samples) / tt.channels); wavFormat.TotalSamples() != want {
+				t.Errorf("expected %d total samples, got %d", want, wavFormat.TotalSamples())
+			}
+			if got := readAll(t, wavFormat, 4*tt.channels); !reflect.DeepEqual(got, tt.samples) {
+				t.Errorf("expected samples %v, got %v", tt.samples, got)
+			}
+
+			// The file ends right after the padded data chunk
+			dataSize := int64(len(tt.samples) * ((tt.bitDepth + 7) / 8))
+			if info, err := file.Stat(); err != nil || info.Size() != WAVHeaderSize+dataSize+dataSize%2 {
+				t.Errorf("expected a %d-byte file, got %v (%v)", WAVHeaderSize+dataSize+dataSize%2, info, err)
+			}
+		})
+	}
+}
+
+func TestWAVWriterStream(t *testing.T) {
+	var out bytes.Buffer
+	w, err := NewWAVWriter(&out, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("NewWAVWriter failed: %v", err)
+	}
+	samples := []int32{1, -1, 2, -2, 3, -3}
+	if err := w.WriteSamples(samples); err != nil {
+		t.Fatalf("WriteSamples failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data := out.Bytes()
+	if riffSize, dataSize := binary.LittleEndian.Uint32(data[4:]), binary.LittleEndian.Uint32(data[40:]); riffSize != 0xFFFFFFFF || dataSize != 0xFFFFFFFF {
+		t.Errorf("expected unknown sizes 0xFFFFFFFF in a streamed header, got RIFF %#x and data %#x", riffSize, dataSize)
+	}
+	wavFormat, err := NewWAVFormatReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewWAVFormatReader failed: %v", err)
+	}
+	if got := readAll(t, wavFormat, 4); !reflect.DeepEqual(got, samples) {
+		t.Errorf("expected samples %v, got %v", samples, got)
+	}
+}
+
+func TestWAVWriterErrors(t *testing.T) {
+	invalid := []struct {
+		name                     string
+		rate, channels, bitDepth int
+	}{
+		{name: "No channels", rate: 44100, bitDepth: 16},
+		{name: "Zero sample rate", channels: 2, bitDepth: 16},
+		{name: "33-bit depth", rate: 44100, channels: 2, bitDepth: 33},
+	}
+	for _, tt := range invalid {
+		if _, err := NewWAVWriter(&bytes.Buffer{}, tt.rate, tt.channels, tt.bitDepth); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	w, err := NewWAVWriter(&bytes.Buffer{}, 44100, 2, 16)
+	if err != nil {
+		t.Fatalf("NewWAVWriter failed: %v", err)
+	}
+	if err := w.WriteSamples([]int32{1, 2, 3}); err == nil {
+		t.Errorf("expected an error writing a partial inter-channel sample")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := w.WriteSamples([]int32{1, 2}); err == nil {
+		t.Errorf("expected an error writing after Close")
+	}
+}
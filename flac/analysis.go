@@ -0,0 +1,98 @@
+package flac
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WithAnalysisWriter writes a description of every frame to w as it is
+// encoded, showing the choices the encoder made, like the reference encoder's
+// --analyze. Each frame takes one line, followed by one tab-indented line per
+// subframe:
+//
+//	frame=0 offset=8272 bytes=9871 blocksize=4096 channel_assignment=MID_SIDE
+//		subframe=0 type=LPC bits=52416 wasted_bits=0 order=8 qlp_precision=15 shift=13 partition_order=4 rice_parameters=9,9,8,10,... written_bits=52416
+//		subframe=1 type=FIXED bits=26535 wasted_bits=0 order=2 partition_order=3 rice_parameters=6,escape:7,... written_bits=26535
+//
+// offset is the frame's position in bytes from the start of the stream, bits
+// the size the encoder planned for the subframe and written_bits the number of
+// bits actually written for it; the two only differ if the size accounting is
+// wrong. type is CONSTANT, VERBATIM, FIXED or LPC;
+// order appears for FIXED and LPC subframes, the LPC coefficient precision and
+// shift for LPC ones and the partition order and Rice parameters, an escaped
+// partition showing its raw sample width, for both. Fields are only ever
+// added to the end of a line. A nil writer disables the analysis.
+func WithAnalysisWriter(w io.Writer) Option {
+	return func(e *Encoder) error {
+		e.analysis = w
+		return nil
+	}
+}
+
+// channelAssignmentNames names the channel assignments in analysis output.
+var channelAssignmentNames = map[int]string{
+	channelLeftSide:  "LEFT_SIDE",
+	channelSideRight: "SIDE_RIGHT",
+	channelMidSide:   "MID_SIDE",
+}
+
+// writeAnalysis describes a frame of blockSize samples per channel, coded as
+// planned, to the analysis writer. subframeBits holds the size of each
+// subframe as buildFrame wrote it.
+func (e *Encoder) writeAnalysis(frame []byte, blockSize, assignment int, plans []subframePlan, subframeBits []int64) error {
+	name, ok := channelAssignmentNames[assignment]
+	if !ok {
+		name = "INDEPENDENT"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "frame=%d offset=%d bytes=%d blocksize=%d channel_assignment=%s\n",
+		e.frameNumber, e.headerBytes+e.frameBytes, len(frame), blockSize, name)
+	for ch, plan := range plans {
+		fmt.Fprintf(&b, "\tsubframe=%d type=%s bits=%d wasted_bits=%d",
+			ch, subframeTypeName(plan.subframeType), plan.bits, plan.sf.wastedBits)
+		if p := plan.prediction; plan.subframeType != subframeTypeConstant && plan.subframeType != subframeTypeVerbatim {
+			fmt.Fprintf(&b, " order=%d", p.order)
+			if p.coefficients != nil {
+				fmt.Fprintf(&b, " qlp_precision=%d shift=%d", e.lpcPrecision, p.shift)
+			}
+			fmt.Fprintf(&b, " partition_order=%d rice_parameters=%s", p.coding.partitionOrder, riceParameterList(p.coding))
+		}
+		fmt.Fprintf(&b, " written_bits=%d\n", subframeBits[ch])
+	}
+
+	if _, err := io.WriteString(e.analysis, b.String()); err != nil {
+		return fmt.Errorf("error writing analysis: %w", err)
+	}
+	return nil
+}
+
+// subframeTypeName names a subframe type in analysis output.
+func subframeTypeName(subframeType int) string {
+	switch {
+	case subframeType == subframeTypeConstant:
+		return "CONSTANT"
+	case subframeType == subframeTypeVerbatim:
+		return "VERBATIM"
+	case subframeType&subframeTypeLPC != 0:
+		return "LPC"
+	default:
+		return "FIXED"
+	}
+}
+
+// riceParameterList lists the Rice parameter of each partition, separated by
+// commas, showing escaped partitions as "escape:" and their raw sample width.
+func riceParameterList(rc residualCoding) string {
+	params := make([]string, len(rc.partitions))
+	for i, c := range rc.partitions {
+		if c.escaped {
+			params[i] = "escape:" + strconv.Itoa(c.rawBits)
+		} else {
+			params[i] = strconv.Itoa(c.param)
+		}
+	}
+	return strings.Join(params, ",")
+}
@@ -0,0 +1,59 @@
+package flac
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWithAnalysisWriter(t *testing.T) {
+	const blocks = 4
+	samples := sineSamples(blocks*DefaultMinBlockSize-100, 2)
+	var analysis bytes.Buffer
+	encodeToBuffer(t, newTestFormat(44100, 2, 16, samples...), WithAnalysisWriter(&analysis))
+
+	var frames, subframes int
+	for _, line := range strings.Split(strings.TrimSuffix(analysis.String(), "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "frame="):
+			frames++
+		case strings.HasPrefix(line, "\tsubframe="):
+			subframes++
+			if !strings.Contains(line, " type=") || !strings.Contains(line, " wasted_bits=") {
+				t.Errorf("subframe line missing fields: %q", line)
+			}
+			var planned, written string
+			for _, field := range strings.Fields(line) {
+				if v, ok := strings.CutPrefix(field, "bits="); ok {
+					planned = v
+				}
+				if v, ok := strings.CutPrefix(field, "written_bits="); ok {
+					written = v
+				}
+			}
+			if planned == "" || planned != written {
+				t.Errorf("expected the planned bits to match the written bits: %q", line)
+			}
+			if strings.Contains(line, "type=FIXED") || strings.Contains(line, "type=LPC") {
+				if !strings.Contains(line, " order=") || !strings.Contains(line, " rice_parameters=") {
+					t.Errorf("predicted subframe line missing fields: %q", line)
+				}
+			}
+		default:
+			t.Errorf("unexpected analysis line %q", line)
+		}
+	}
+	if frames != blocks {
+		t.Errorf("expected %d frame lines, got %d", blocks, frames)
+	}
+	if subframes != 2*blocks {
+		t.Errorf("expected %d subframe lines, got %d", 2*blocks, subframes)
+	}
+}
+
+func TestRiceParameterList(t *testing.T) {
+	rc := residualCoding{partitions: []riceCoding{{param: 3}, {escaped: true, rawBits: 7}, {param: 0}}}
+	if got := riceParameterList(rc); got != "3,escape:7,0" {
+		t.Errorf("expected \"3,escape:7,0\", got %q", got)
+	}
+}
@@ -0,0 +1,41 @@
+package flac
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+// benchmarkSeconds is the length of the generated audio each benchmark encodes.
+const benchmarkSeconds = 10
+
+// benchmarkEncode encodes a generated 16-bit stereo sine wave to io.Discard
+// b.N times, reporting throughput in bytes of PCM input.
+func benchmarkEncode(b *testing.B, opts ...Option) {
+	samples := sineSamples(44100*benchmarkSeconds, 2)
+	b.SetBytes(int64(len(samples) * 2))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		input := newTestFormat(44100, 2, 16, samples...)
+		encoder, err := NewEncoderWriter(input, io.Discard, opts...)
+		if err != nil {
+			b.Fatalf("NewEncoderWriter failed: %v", err)
+		}
+		if err := encoder.Encode(); err != nil {
+			b.Fatalf("Encode failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	b.Run("Default", func(b *testing.B) {
+		benchmarkEncode(b)
+	})
+	for level := 0; level <= MaxCompressionLevel; level++ {
+		b.Run(fmt.Sprintf("Level%d", level), func(b *testing.B) {
+			benchmarkEncode(b, WithCompressionLevel(level))
+		})
+	}
+}
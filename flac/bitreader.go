@@ -0,0 +1,114 @@
+package flac
+
+import (
+	"bufio"
+	"io"
+	"math/bits"
+)
+
+// BitReader reads values of arbitrary bit width, most significant bit first,
+// from an underlying io.Reader. It is the counterpart of BitWriter.
+//
+// Every byte it consumes is also appended to a record, which the decoder
+// resets at the start of each frame so it can check the frame's CRCs.
+type BitReader struct {
+	r      io.ByteReader
+	cur    byte   // current byte, of which the low n bits are unread
+	n      uint   // number of unread bits in cur
+	record []byte // bytes consumed since the last resetRecord
+}
+
+// NewBitReader returns a BitReader reading from r.
+func NewBitReader(r io.Reader) *BitReader {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &BitReader{r: br}
+}
+
+// fill loads the next byte into cur. A stream ending mid-value is reported as
+// io.ErrUnexpectedEOF; io.EOF is returned only on a byte boundary.
+func (br *BitReader) fill() error {
+	b, err := br.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	br.cur, br.n = b, 8
+	br.record = append(br.record, b)
+	return nil
+}
+
+// ReadBits reads n bits, n being at most 64, and returns them as the low bits
+// of the result.
+func (br *BitReader) ReadBits(n uint) (uint64, error) {
+	var v uint64
+	for read := uint(0); n > 0; read++ {
+		if br.n == 0 {
+			if err := br.fill(); err != nil {
+				if err == io.EOF && read > 0 {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+		}
+		take := br.n
+		if take > n {
+			take = n
+		}
+		bits := uint64(br.cur>>(br.n-take)) & (1<<take - 1)
+		v = v<<take | bits
+		br.n -= take
+		n -= take
+	}
+	return v, nil
+}
+
+// ReadSignedBits reads an n-bit two's complement value and sign extends it.
+func (br *BitReader) ReadSignedBits(n uint) (int64, error) {
+	v, err := br.ReadBits(n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	return int64(v<<(64-n)) >> (64 - n), nil
+}
+
+// ReadUnary reads zero bits up to and including the next one bit and returns
+// the number of zeros.
+func (br *BitReader) ReadUnary() (uint64, error) {
+	var count uint64
+	for {
+		if br.n == 0 {
+			if err := br.fill(); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+		}
+		rest := br.cur << (8 - br.n)
+		if rest == 0 {
+			count += uint64(br.n)
+			br.n = 0
+			continue
+		}
+		zeros := uint(bits.LeadingZeros8(rest))
+		count += uint64(zeros)
+		br.n -= zeros + 1
+		return count, nil
+	}
+}
+
+// Align discards the unread bits of the current byte.
+func (br *BitReader) Align() {
+	br.n = 0
+}
+
+// resetRecord clears the record of consumed bytes, keeping a partially read
+// current byte in it.
+func (br *BitReader) resetRecord() {
+	br.record = br.record[:0]
+	if br.n > 0 {
+		br.record = append(br.record, br.cur)
+	}
+}
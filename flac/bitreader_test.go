@@ -0,0 +1,94 @@
+package flac
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestBitReader(t *testing.T) {
+	type read struct {
+		kind     string // "bits", "signed" or "unary"
+		n        uint
+		expected int64
+	}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		reads       []read
+		expectedErr error
+	}{
+		{
+			name: "Interleaved 3-bit and 13-bit reads",
+			data: []byte{0xBA, 0xBC, 0x60, 0x01},
+			reads: []read{
+				{kind: "bits", n: 3, expected: 0b101},
+				{kind: "bits", n: 13, expected: 0x1ABC},
+				{kind: "bits", n: 3, expected: 0b011},
+				{kind: "bits", n: 13, expected: 0x0001},
+			},
+		},
+		{
+			name: "Signed values are sign extended",
+			data: []byte{0xF8, 0x7F},
+			reads: []read{
+				{kind: "signed", n: 5, expected: -1},
+				{kind: "signed", n: 3, expected: 0},
+				{kind: "signed", n: 8, expected: 127},
+			},
+		},
+		{
+			name: "Unary codes across bytes",
+			data: []byte{0x10, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02},
+			reads: []read{
+				{kind: "unary", expected: 3},
+				{kind: "unary", expected: 74},
+				{kind: "bits", n: 1, expected: 0},
+			},
+		},
+		{
+			name:        "Stream ending mid-value",
+			data:        []byte{0xFF},
+			reads:       []read{{kind: "bits", n: 12}},
+			expectedErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:        "Stream ending on a byte boundary",
+			data:        []byte{0xFF},
+			reads:       []read{{kind: "bits", n: 8, expected: 0xFF}, {kind: "bits", n: 8}},
+			expectedErr: io.EOF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := NewBitReader(bytes.NewReader(tt.data))
+			var err error
+			for i, r := range tt.reads {
+				var got int64
+				switch r.kind {
+				case "bits":
+					var v uint64
+					v, err = br.ReadBits(r.n)
+					got = int64(v)
+				case "signed":
+					got, err = br.ReadSignedBits(r.n)
+				case "unary":
+					var v uint64
+					v, err = br.ReadUnary()
+					got = int64(v)
+				}
+				if err != nil {
+					break
+				}
+				if got != r.expected {
+					t.Errorf("read %d: expected %d, got %d", i, r.expected, got)
+				}
+			}
+			if err != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
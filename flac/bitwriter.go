@@ -0,0 +1,93 @@
+package flac
+
+import "io"
+
+// bitWriterBufferSize is the number of completed bytes held before they are written out.
+const bitWriterBufferSize = 4096
+
+// BitWriter writes values of arbitrary bit width, most significant bit first,
+// to an underlying io.Writer. Completed bytes are buffered and only reach the
+// writer once the buffer fills or Flush is called.
+//
+// Errors are sticky: once a write fails every later call returns the same
+// error, so callers may check only the result of Flush.
+type BitWriter struct {
+	w     io.Writer
+	buf   []byte // completed bytes not yet written to w
+	cur   byte   // partially filled byte
+	n     uint   // number of bits used in cur
+	count int64  // total number of bits written, including flush padding
+	err   error
+}
+
+// NewBitWriter returns a BitWriter writing to w.
+func NewBitWriter(w io.Writer) *BitWriter {
+	return &BitWriter{w: w, buf: make([]byte, 0, bitWriterBufferSize)}
+}
+
+// WriteBits writes the n low bits of value, n being at most 64.
+func (bw *BitWriter) WriteBits(value uint64, n uint) error {
+	if bw.err != nil {
+		return bw.err
+	}
+	bw.count += int64(n)
+	for n > 0 {
+		take := 8 - bw.n
+		if take > n {
+			take = n
+		}
+		n -= take
+		bits := (value >> n) & (1<<take - 1)
+		bw.cur |= byte(bits << (8 - bw.n - take))
+		bw.n += take
+		if bw.n == 8 {
+			bw.emit()
+		}
+	}
+	return bw.err
+}
+
+// BitsWritten returns the number of bits written so far, counting the zero
+// bits Flush pads the final byte with.
+func (bw *BitWriter) BitsWritten() int64 {
+	return bw.count
+}
+
+// WriteUnary writes n zero bits followed by a single one bit.
+func (bw *BitWriter) WriteUnary(n uint) error {
+	for ; n >= 64; n -= 64 {
+		bw.WriteBits(0, 64)
+	}
+	return bw.WriteBits(1, n+1)
+}
+
+// Flush pads the final partial byte with zero bits and writes all buffered bytes.
+func (bw *BitWriter) Flush() error {
+	if bw.err != nil {
+		return bw.err
+	}
+	if bw.n > 0 {
+		bw.count += int64(8 - bw.n)
+		bw.emit()
+	}
+	bw.drain()
+	return bw.err
+}
+
+// emit moves the current byte into the buffer, draining it when full.
+func (bw *BitWriter) emit() {
+	bw.buf = append(bw.buf, bw.cur)
+	bw.cur, bw.n = 0, 0
+	if len(bw.buf) >= bitWriterBufferSize {
+		bw.drain()
+	}
+}
+
+// drain writes the buffered bytes to the underlying writer.
+func (bw *BitWriter) drain() {
+	if bw.err != nil || len(bw.buf) == 0 {
+		return
+	}
+	_, bw.err = bw.w.Write(bw.buf)
+	bw.buf = bw.buf[:0]
+}
@@ -0,0 +1,100 @@
+package flac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBitWriter(t *testing.T) {
+	type write struct {
+		unary bool
+		value uint64
+		n     uint
+	}
+
+	tests := []struct {
+		name          string
+		writes        []write
+		expected      []byte
+		expectedCount int64
+	}{
+		{
+			name: "Interleaved 3-bit and 13-bit writes",
+			writes: []write{
+				{value: 0b101, n: 3},
+				{value: 0x1ABC, n: 13},
+				{value: 0b011, n: 3},
+				{value: 0x0001, n: 13},
+			},
+			expected:      []byte{0xBA, 0xBC, 0x60, 0x01},
+			expectedCount: 32,
+		},
+		{
+			name:          "Flush zero-pads a single bit",
+			writes:        []write{{value: 1, n: 1}},
+			expected:      []byte{0x80},
+			expectedCount: 8,
+		},
+		{
+			name: "Flush zero-pads after whole bytes",
+			writes: []write{
+				{value: 0xFFFF, n: 16},
+				{value: 0b101, n: 3},
+			},
+			expected:      []byte{0xFF, 0xFF, 0xA0},
+			expectedCount: 24,
+		},
+		{
+			name:          "Only the low bits of value are written",
+			writes:        []write{{value: 0xFFF0, n: 8}},
+			expected:      []byte{0xF0},
+			expectedCount: 8,
+		},
+		{
+			name:          "Unary code",
+			writes:        []write{{unary: true, n: 3}},
+			expected:      []byte{0x10},
+			expectedCount: 8,
+		},
+		{
+			name:          "Unary code longer than 64 bits",
+			writes:        []write{{unary: true, n: 70}},
+			expected:      []byte{0, 0, 0, 0, 0, 0, 0, 0, 0x02},
+			expectedCount: 72,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			bw := NewBitWriter(&buf)
+			var written int64
+			for _, w := range tt.writes {
+				var err error
+				if w.unary {
+					err = bw.WriteUnary(w.n)
+					written += int64(w.n) + 1
+				} else {
+					err = bw.WriteBits(w.value, w.n)
+					written += int64(w.n)
+				}
+				if err != nil {
+					t.Fatalf("write failed: %v", err)
+				}
+				if bw.BitsWritten() != written {
+					t.Fatalf("expected %d bits written before flushing, got %d", written, bw.BitsWritten())
+				}
+			}
+			if err := bw.Flush(); err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+
+			if !bytes.Equal(buf.Bytes(), tt.expected) {
+				t.Errorf("expected bytes %x, got %x", tt.expected, buf.Bytes())
+			}
+			if bw.BitsWritten() != tt.expectedCount {
+				t.Errorf("expected %d bits written, got %d", tt.expectedCount, bw.BitsWritten())
+			}
+		})
+	}
+}
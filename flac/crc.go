@@ -0,0 +1,65 @@
+package flac
+
+const (
+	crc8Polynomial  = 0x07   // x^8 + x^2 + x^1 + x^0
+	crc16Polynomial = 0x8005 // x^16 + x^15 + x^2 + x^0
+)
+
+var (
+	crc8Table  = makeCRC8Table()
+	crc16Table = makeCRC16Table()
+)
+
+// makeCRC8Table precomputes the CRC-8 of every byte value.
+func makeCRC8Table() [256]byte {
+	var table [256]byte
+	for i := range table {
+		crc := byte(i)
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ crc8Polynomial
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+// makeCRC16Table precomputes the CRC-16 of every byte value in the high byte.
+func makeCRC16Table() [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ crc16Polynomial
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+// crc8 returns the CRC-8 FLAC stores at the end of each frame header. It covers
+// the whole header from the sync code on and starts from 0.
+func crc8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc = crc8Table[crc^b]
+	}
+	return crc
+}
+
+// crc16 returns the CRC-16 FLAC stores at the end of each frame. It covers the
+// whole frame, header and padding included, and starts from 0.
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
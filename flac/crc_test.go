@@ -0,0 +1,50 @@
+package flac
+
+import "testing"
+
+// The frame of example file 1 in the FLAC specification, Appendix D.1: a
+// header ending in CRC-8 0xbf and two verbatim subframes followed by CRC-16 0xaa9a.
+var (
+	referenceFrameHeader = []byte{0xff, 0xf8, 0x69, 0x18, 0x00, 0x00}
+	referenceFrame       = []byte{0xff, 0xf8, 0x69, 0x18, 0x00, 0x00, 0xbf, 0x03, 0x58, 0xfd, 0x03, 0x12, 0x8b}
+)
+
+func TestCRC8(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected byte
+	}{
+		{"Empty", nil, 0x00},
+		{"Check string", []byte("123456789"), 0xf4},
+		{"Reference frame header", referenceFrameHeader, 0xbf},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := crc8(tt.data); got != tt.expected {
+				t.Errorf("expected %#02x, got %#02x", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCRC16(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected uint16
+	}{
+		{"Empty", nil, 0x0000},
+		{"Check string", []byte("123456789"), 0xfee8},
+		{"Reference frame", referenceFrame, 0xaa9a},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := crc16(tt.data); got != tt.expected {
+				t.Errorf("expected %#04x, got %#04x", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package flac
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// StreamInfo holds the fields of a STREAMINFO metadata block.
+type StreamInfo struct {
+	MinBlockSize int
+	MaxBlockSize int
+	MinFrameSize int // 0 if unknown
+	MaxFrameSize int // 0 if unknown
+	SampleRate   int
+	Channels     int
+	BitDepth     int
+	TotalSamples uint64 // inter-channel samples, 0 if unknown
+	MD5          [16]byte
+}
+
+// parseStreamInfo unpacks the 34-byte body of a STREAMINFO block.
+func parseStreamInfo(block []byte) (StreamInfo, error) {
+	if len(block) != StreamInfoSize {
+		return StreamInfo{}, fmt.Errorf("invalid STREAMINFO size %d", len(block))
+	}
+
+	br := NewBitReader(bytes.NewReader(block))
+	var fields [8]uint64
+	for i, width := range []uint{16, 16, 24, 24, 20, 3, 5, 36} {
+		fields[i], _ = br.ReadBits(width)
+	}
+	info := StreamInfo{
+		MinBlockSize: int(fields[0]),
+		MaxBlockSize: int(fields[1]),
+		MinFrameSize: int(fields[2]),
+		MaxFrameSize: int(fields[3]),
+		SampleRate:   int(fields[4]),
+		Channels:     int(fields[5]) + 1,
+		BitDepth:     int(fields[6]) + 1,
+		TotalSamples: fields[7],
+	}
+	copy(info.MD5[:], block[18:])
+	return info, nil
+}
+
+// Decoder decodes a FLAC stream back to PCM samples. It implements
+// audio.Format, so decoded audio can be fed straight back into an Encoder.
+type Decoder struct {
+	br   *BitReader
+	info StreamInfo
+	tags map[string]string // from the VORBIS_COMMENT block, names upper-cased
+
+	// pending holds decoded interleaved samples not yet returned by ReadSamples
+	pending []int32
+
+	// md5hash accumulates the decoded samples for checking against the
+	// STREAMINFO signature once the stream ends
+	md5hash hash.Hash
+
+	frames  uint64 // frames decoded so far
+	samples uint64 // inter-channel samples decoded so far
+}
+
+// Frame is one decoded frame of a FLAC stream, as returned by
+// Decoder.NextFrame.
+type Frame struct {
+	Number      uint64  // position of the frame in the stream, counted from 0
+	FirstSample uint64  // index of the frame's first inter-channel sample in the stream
+	BlockSize   int     // samples per channel
+	Samples     []int32 // BlockSize interleaved inter-channel samples
+}
+
+// NewDecoder reads the "fLaC" marker and the metadata blocks from r, leaving
+// it positioned at the first frame. Metadata blocks other than STREAMINFO and
+// VORBIS_COMMENT are skipped.
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	d := &Decoder{br: NewBitReader(r), md5hash: md5.New()}
+
+	marker := make([]byte, len(FlacMarker))
+	for i := range marker {
+		b, err := d.br.ReadBits(8)
+		if err != nil {
+			return nil, fmt.Errorf("error reading stream marker: %w", err)
+		}
+		marker[i] = byte(b)
+	}
+	if string(marker) != FlacMarker {
+		return nil, fmt.Errorf("not a FLAC stream")
+	}
+
+	if err := d.readMetadata(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// IsFLAC reports whether r starts with the "fLaC" marker. A reader with a Peek
+// method, such as a *bufio.Reader, is only peeked at, so it can be handed on
+// to NewDecoder; any other reader has the marker's 4 bytes consumed. A reader
+// holding fewer than 4 bytes is not FLAC and is not an error.
+func IsFLAC(r io.Reader) (bool, error) {
+	var marker []byte
+	var err error
+	if peeker, ok := r.(interface{ Peek(n int) ([]byte, error) }); ok {
+		marker, err = peeker.Peek(len(FlacMarker))
+	} else {
+		marker = make([]byte, len(FlacMarker))
+		var n int
+		n, err = io.ReadFull(r, marker)
+		marker = marker[:n]
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading stream marker: %w", err)
+	}
+	return string(marker) == FlacMarker, nil
+}
+
+// readMetadata reads metadata blocks up to and including the one flagged as
+// last. STREAMINFO must come first.
+func (d *Decoder) readMetadata() error {
+	for first := true; ; first = false {
+		header, err := d.br.ReadBits(32)
+		if err != nil {
+			return fmt.Errorf("error reading metadata block header: %w", err)
+		}
+		last := header>>24&LastMetadataBlock != 0
+		blockType := int(header >> 24 & 0x7F)
+		length := int(header & 0xFFFFFF)
+
+		if first && blockType != metadataStreamInfo {
+			return fmt.Errorf("first metadata block is type %d, not STREAMINFO", blockType)
+		}
+
+		block := make([]byte, length)
+		for i := range block {
+			b, err := d.br.ReadBits(8)
+			if err != nil {
+				return fmt.Errorf("error reading metadata block: %w", err)
+			}
+			block[i] = byte(b)
+		}
+
+		switch blockType {
+		case metadataStreamInfo:
+			if d.info, err = parseStreamInfo(block); err != nil {
+				return err
+			}
+		case metadataVorbisComment:
+			if d.tags, err = parseVorbisComment(block); err != nil {
+				return fmt.Errorf("error reading VORBIS_COMMENT block: %w", err)
+			}
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// StreamInfo returns the stream's STREAMINFO block.
+func (d *Decoder) StreamInfo() StreamInfo {
+	return d.info
+}
+
+// Tags returns the stream's Vorbis comments with their names upper-cased, or
+// nil if it has no VORBIS_COMMENT block.
+func (d *Decoder) Tags() map[string]string {
+	return d.tags
+}
+
+// SampleRate returns the sample rate from STREAMINFO.
+func (d *Decoder) SampleRate() int {
+	return d.info.SampleRate
+}
+
+// Channels returns the number of channels from STREAMINFO.
+func (d *Decoder) Channels() int {
+	return d.info.Channels
+}
+
+// BitDepth returns the bit depth from STREAMINFO.
+func (d *Decoder) BitDepth() int {
+	return d.info.BitDepth
+}
+
+// TotalSamples returns the total number of inter-channel samples from
+// STREAMINFO, 0 meaning unknown.
+func (d *Decoder) TotalSamples() uint64 {
+	return d.info.TotalSamples
+}
+
+// Duration returns the playing time of the stream, 0 if its length is unknown.
+func (d *Decoder) Duration() time.Duration {
+	if d.info.SampleRate == 0 {
+		return 0
+	}
+	rate := uint64(d.info.SampleRate)
+	seconds, rest := d.info.TotalSamples/rate, d.info.TotalSamples%rate
+	return time.Duration(seconds)*time.Second + time.Duration(rest)*time.Second/time.Duration(rate)
+}
+
+// ReadSamples decodes interleaved samples into buffer, decoding frames as
+// needed. It returns io.EOF once the stream is exhausted, or, if the decoded
+// audio does not match the MD5 signature in STREAMINFO, an error wrapping
+// ErrMD5Mismatch instead. A frame whose CRC-16 does not match its contents
+// fails with an error wrapping ErrFrameCRCMismatch.
+func (d *Decoder) ReadSamples(buffer []int32) (int, error) {
+	n := 0
+	for n < len(buffer) {
+		if len(d.pending) == 0 {
+			frame, err := d.NextFrame()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return n, err
+			}
+			d.pending = frame.Samples
+		}
+		copied := copy(buffer[n:], d.pending)
+		d.pending = d.pending[copied:]
+		n += copied
+	}
+	if n == 0 && len(buffer) > 0 {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+// NextFrame decodes the next frame of the stream, for callers that work a
+// frame at a time, such as a player decoding on demand. It reports errors as
+// ReadSamples does, checking the MD5 signature once it returns io.EOF.
+// Samples of a frame that ReadSamples has only partly returned are dropped.
+func (d *Decoder) NextFrame() (*Frame, error) {
+	d.pending = nil
+	info, samples, err := d.decodeFrame()
+	if err == io.EOF {
+		if err := d.checkMD5(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d.md5hash != nil {
+		writeMD5Samples(d.md5hash, samples, d.info.BitDepth)
+	}
+
+	// The header numbers the frame by its position in the stream, or by its
+	// first sample with a variable blocking strategy
+	frame := &Frame{Number: info.number, FirstSample: d.samples, BlockSize: info.blockSize, Samples: samples}
+	if info.variable {
+		frame.Number, frame.FirstSample = d.frames, info.number
+	}
+	d.frames++
+	d.samples += uint64(frame.BlockSize)
+	return frame, nil
+}
+
+// decodeFrame decodes the next frame and returns its header and its samples
+// interleaved.
+func (d *Decoder) decodeFrame() (frameInfo, []int32, error) {
+	info, err := d.readFrameHeader()
+	if err == io.EOF {
+		return frameInfo{}, nil, io.EOF
+	}
+	if err != nil {
+		return frameInfo{}, nil, fmt.Errorf("error reading frame header: %w", err)
+	}
+	// Samples are interleaved and returned by the STREAMINFO format, so a
+	// frame of another cannot be decoded into the stream
+	if info.channels != d.info.Channels || info.bitDepth != d.info.BitDepth {
+		return frameInfo{}, nil, fmt.Errorf("frame %d has %d channels of %d bits, STREAMINFO has %d channels of %d bits",
+			info.number, info.channels, info.bitDepth, d.info.Channels, d.info.BitDepth)
+	}
+
+	channels := make([][]int32, info.channels)
+	for ch := range channels {
+		bitDepth := info.bitDepth
+		if sideChannel(info.assignment) == ch {
+			bitDepth++
+		}
+		if channels[ch], err = readSubframe(d.br, info.blockSize, bitDepth); err != nil {
+			return frameInfo{}, nil, fmt.Errorf("error reading subframe %d of frame %d: %w", ch, info.number, err)
+		}
+	}
+	if info.channels == 2 {
+		channels[0], channels[1] = restoreStereo(info.assignment, channels[0], channels[1])
+	}
+
+	// Frame footer: zero padding to a byte boundary, then the CRC-16 of
+	// everything before it
+	d.br.Align()
+	want := crc16(d.br.record)
+	got, err := d.br.ReadBits(16)
+	if err != nil {
+		return frameInfo{}, nil, fmt.Errorf("error reading frame footer: %w", err)
+	}
+	if uint16(got) != want {
+		return frameInfo{}, nil, fmt.Errorf("%w in frame %d: got %#04x, want %#04x", ErrFrameCRCMismatch, info.number, got, want)
+	}
+
+	samples := make([]int32, 0, info.blockSize*info.channels)
+	for i := 0; i < info.blockSize; i++ {
+		for ch := range channels {
+			samples = append(samples, channels[ch][i])
+		}
+	}
+	return info, samples, nil
+}
+
+// checkMD5 compares the signature of the samples decoded so far with the one
+// in STREAMINFO. A zero signature means the encoder did not compute one and
+// is not checked.
+func (d *Decoder) checkMD5() error {
+	if d.md5hash == nil || d.info.MD5 == [16]byte{} {
+		return nil
+	}
+	var sum [16]byte
+	copy(sum[:], d.md5hash.Sum(nil))
+	if sum != d.info.MD5 {
+		return fmt.Errorf("%w: decoded audio has signature %x, STREAMINFO has %x", ErrMD5Mismatch, sum, d.info.MD5)
+	}
+	return nil
+}
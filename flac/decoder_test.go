@@ -0,0 +1,473 @@
+package flac
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"testing/iotest"
+
+	"github.com/nooooaaaaah/soundcompression/audio"
+)
+
+// readAllSamples reads every interleaved sample from f.
+func readAllSamples(t *testing.T, f audio.Format) []int32 {
+	t.Helper()
+	var all []int32
+	buffer := make([]int32, 1000*f.Channels())
+	for {
+		n, err := f.ReadSamples(buffer)
+		all = append(all, buffer[:n]...)
+		if err == io.EOF || (err == nil && n == 0) {
+			return all
+		}
+		if err != nil {
+			t.Fatalf("ReadSamples failed: %v", err)
+		}
+	}
+}
+
+// encodeToBuffer encodes input into memory.
+func encodeToBuffer(t *testing.T, input audio.Format, opts ...Option) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	encoder, err := NewEncoderWriter(input, &out, opts...)
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	if err := encoder.Encode(); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestDecodeSampleWAV(t *testing.T) {
+	input, err := audio.NewWAVFormat("../sample.wav")
+	if err != nil {
+		t.Fatalf("failed to create audio format: %v", err)
+	}
+	defer input.Close()
+	original := readAllSamples(t, input)
+
+	input.Seek(0)
+	encoded := encodeToBuffer(t, input)
+
+	decoder, err := NewDecoder(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if decoder.SampleRate() != input.SampleRate() || decoder.Channels() != input.Channels() ||
+		decoder.BitDepth() != input.BitDepth() || decoder.TotalSamples() != input.TotalSamples() {
+		t.Errorf("expected stream info %d Hz, %d channels, %d bits, %d samples, got %+v",
+			input.SampleRate(), input.Channels(), input.BitDepth(), input.TotalSamples(), decoder.StreamInfo())
+	}
+
+	decoded := readAllSamples(t, decoder)
+	if len(decoded) != len(original) {
+		t.Fatalf("expected %d decoded samples, got %d", len(original), len(decoded))
+	}
+	for i := range original {
+		if decoded[i] != original[i] {
+			t.Fatalf("sample %d: expected %d, got %d", i, original[i], decoded[i])
+		}
+	}
+}
+
+func TestNextFrame(t *testing.T) {
+	samples := sineSamples(3*DefaultMinBlockSize+1000, 2)
+	decoder, err := NewDecoder(bytes.NewReader(encodeToBuffer(t, newTestFormat(44100, 2, 16, samples...))))
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+
+	expectedSizes := []int{DefaultMinBlockSize, DefaultMinBlockSize, DefaultMinBlockSize, 1000}
+	var decoded []int32
+	var first uint64
+	for i, size := range expectedSizes {
+		frame, err := decoder.NextFrame()
+		if err != nil {
+			t.Fatalf("frame %d: NextFrame failed: %v", i, err)
+		}
+		if frame.Number != uint64(i) || frame.FirstSample != first || frame.BlockSize != size {
+			t.Errorf("frame %d: expected number %d, first sample %d and block size %d, got %d, %d and %d",
+				i, i, first, size, frame.Number, frame.FirstSample, frame.BlockSize)
+		}
+		if len(frame.Samples) != frame.BlockSize*2 {
+			t.Errorf("frame %d: expected %d samples, got %d", i, frame.BlockSize*2, len(frame.Samples))
+		}
+		decoded = append(decoded, frame.Samples...)
+		first += uint64(frame.BlockSize)
+	}
+	if frame, err := decoder.NextFrame(); err != io.EOF {
+		t.Fatalf("expected io.EOF after the last frame, got %+v, %v", frame, err)
+	}
+	if !reflect.DeepEqual(decoded, samples) {
+		t.Errorf("decoded samples differ from the input")
+	}
+}
+
+func TestNextFrameVariableBlockSize(t *testing.T) {
+	samples := sineSamples(5*DefaultMinBlockSize+300, 2)
+	decoder, err := NewDecoder(bytes.NewReader(encodeToBuffer(t, newTestFormat(44100, 2, 16, samples...), WithVariableBlockSize(true))))
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+
+	// The headers number frames by their first sample, which NextFrame
+	// reports as FirstSample rather than as Number
+	var decoded []int32
+	for i := uint64(0); ; i++ {
+		frame, err := decoder.NextFrame()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("frame %d: NextFrame failed: %v", i, err)
+		}
+		if frame.Number != i || frame.FirstSample != uint64(len(decoded)/2) || len(frame.Samples) != frame.BlockSize*2 {
+			t.Errorf("frame %d: expected number %d and first sample %d, got %d and %d with %d samples of block size %d",
+				i, i, len(decoded)/2, frame.Number, frame.FirstSample, len(frame.Samples), frame.BlockSize)
+		}
+		decoded = append(decoded, frame.Samples...)
+	}
+	if !reflect.DeepEqual(decoded, samples) {
+		t.Errorf("decoded samples differ from the input")
+	}
+}
+
+func TestIsFLAC(t *testing.T) {
+	flacData := encodeToBuffer(t, newTestFormat(44100, 2, 16, sineSamples(1000, 2)...))
+	wavData, err := os.ReadFile("../sample.wav")
+	if err != nil {
+		t.Fatalf("failed to read sample: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected bool
+	}{
+		{name: "FLAC stream", data: flacData, expected: true},
+		{name: "WAV file", data: wavData},
+		{name: "Marker only", data: []byte(FlacMarker), expected: true},
+		{name: "Short reader", data: []byte("fLa")},
+		{name: "Empty reader"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A plain reader has exactly the marker consumed
+			r := bytes.NewReader(tt.data)
+			got, err := IsFLAC(r)
+			if err != nil || got != tt.expected {
+				t.Errorf("expected %v, got %v, %v", tt.expected, got, err)
+			}
+			if consumed, want := len(tt.data)-r.Len(), min(len(tt.data), len(FlacMarker)); consumed != want {
+				t.Errorf("expected %d bytes consumed, got %d", want, consumed)
+			}
+
+			// A bufio.Reader is only peeked at
+			br := bufio.NewReader(bytes.NewReader(tt.data))
+			if got, err := IsFLAC(br); err != nil || got != tt.expected {
+				t.Errorf("bufio.Reader: expected %v, got %v, %v", tt.expected, got, err)
+			}
+			if rest, _ := io.ReadAll(br); !bytes.Equal(rest, tt.data) {
+				t.Errorf("bufio.Reader: expected nothing consumed, %d of %d bytes left", len(rest), len(tt.data))
+			}
+		})
+	}
+
+	// A peeked stream still decodes
+	br := bufio.NewReader(bytes.NewReader(flacData))
+	if ok, err := IsFLAC(br); !ok || err != nil {
+		t.Fatalf("expected a FLAC stream, got %v, %v", ok, err)
+	}
+	if _, err := NewDecoder(br); err != nil {
+		t.Errorf("NewDecoder failed after IsFLAC: %v", err)
+	}
+
+	failing := iotest.ErrReader(errors.New("disk on fire"))
+	if _, err := IsFLAC(failing); err == nil {
+		t.Errorf("expected the read error to be returned")
+	}
+}
+
+// mapSamples returns f applied to every sample.
+func mapSamples(samples []int32, f func(int32) int32) []int32 {
+	out := make([]int32, len(samples))
+	for i, s := range samples {
+		out[i] = f(s)
+	}
+	return out
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels int
+		bitDepth int
+		samples  []int32
+	}{
+		{
+			name:     "Mono 16-bit",
+			channels: 1,
+			bitDepth: 16,
+			samples:  sineSamples(5000, 1),
+		},
+		{
+			name:     "Stereo 16-bit with a short last block",
+			channels: 2,
+			bitDepth: 16,
+			samples:  sineSamples(DefaultMinBlockSize+123, 2),
+		},
+		{
+			name:     "Stereo 24-bit",
+			channels: 2,
+			bitDepth: 24,
+			samples:  mapSamples(sineSamples(5000, 2), func(s int32) int32 { return s*300 + 7 }),
+		},
+		{
+			name:     "Stereo 20-bit",
+			channels: 2,
+			bitDepth: 20,
+			samples:  mapSamples(sineSamples(5000, 2), func(s int32) int32 { return s*15 + 3 }),
+		},
+		{
+			name:     "Stereo 8-bit",
+			channels: 2,
+			bitDepth: 8,
+			samples:  mapSamples(sineSamples(3000, 2), func(s int32) int32 { return s / 100 }),
+		},
+		{
+			name:     "Wasted bits",
+			channels: 2,
+			bitDepth: 16,
+			samples:  mapSamples(sineSamples(3000, 2), func(s int32) int32 { return s &^ 0xFF }),
+		},
+		{
+			name:     "Full-scale noise",
+			channels: 3,
+			bitDepth: 16,
+			samples:  mapSamples(sineSamples(2000, 3), func(s int32) int32 { return int32(int16(s * 7919)) }),
+		},
+		{
+			name:     "Silence",
+			channels: 2,
+			bitDepth: 16,
+			samples:  make([]int32, 2*1000),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeToBuffer(t, newTestFormat(44100, tt.channels, tt.bitDepth, tt.samples...))
+
+			decoder, err := NewDecoder(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if got := decoder.TotalSamples(); got != uint64(len(tt.samples)/tt.channels) {
+				t.Errorf("expected %d total samples, got %d", len(tt.samples)/tt.channels, got)
+			}
+			decoded := readAllSamples(t, decoder)
+			if !reflect.DeepEqual(decoded, tt.samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+}
+
+func TestDecodeFixedOrderBeyondBlockSize(t *testing.T) {
+	// A frame of 1 sample whose fixed subframe claims 4 warm-up samples, with
+	// both CRCs valid so only the order gives it away
+	encoder, err := NewEncoderWriter(newTestFormat(44100, 1, 16, 0), &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	header, err := encoder.frameHeader(1, 0)
+	if err != nil {
+		t.Fatalf("frameHeader failed: %v", err)
+	}
+	frame := bytes.NewBuffer(header)
+	bw := NewBitWriter(frame)
+	bw.WriteBits((subframeTypeFixed|4)<<1, 8)
+	for i := 0; i < 4; i++ {
+		bw.WriteBits(0, 16)
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	crc := crc16(frame.Bytes())
+	frame.Write([]byte{byte(crc >> 8), byte(crc)})
+
+	decoder := &Decoder{
+		br:   NewBitReader(frame),
+		info: StreamInfo{SampleRate: 44100, Channels: 1, BitDepth: 16},
+	}
+	_, _, err = decoder.decodeFrame()
+	expected := "error reading subframe 0 of frame 0: fixed order 4 exceeds block size 1"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestReadSubframe(t *testing.T) {
+	type field struct {
+		value uint64
+		n     uint
+	}
+
+	tests := []struct {
+		name      string
+		fields    []field
+		blockSize int
+		bitDepth  int
+		expected  []int32
+	}{
+		{
+			name:      "Constant",
+			fields:    []field{{subframeTypeConstant << 1, 8}, {uint64(uint16(0xFFF6)), 16}},
+			blockSize: 4,
+			bitDepth:  16,
+			expected:  []int32{-10, -10, -10, -10},
+		},
+		{
+			name:      "Verbatim with 2 wasted bits",
+			fields:    []field{{subframeTypeVerbatim<<1 | 1, 8}, {1, 2}, {0x3F, 6}, {0x01, 6}, {0x20, 6}},
+			blockSize: 3,
+			bitDepth:  8,
+			expected:  []int32{-4, 4, -128},
+		},
+		{
+			// Order 1 LPC predicting s[i] = s[i-1] * 2 >> 1, with a zero residual
+			name: "LPC",
+			fields: []field{
+				{(subframeTypeLPC | 0) << 1, 8},
+				{100, 16},  // warm-up sample
+				{3 - 1, 4}, // coefficient precision minus one
+				{1, 5},     // shift
+				{2, 3},     // coefficient
+				// residual escaped with 0 raw bits
+				{riceMethod4Bit, 2}, {0, 4}, {riceEscape4Bit, 4}, {0, 5},
+			},
+			blockSize: 4,
+			bitDepth:  16,
+			expected:  []int32{100, 100, 100, 100},
+		},
+		{
+			name: "Fixed order 2 with two partitions",
+			fields: []field{
+				{(subframeTypeFixed | 2) << 1, 8},
+				{1, 8}, {2, 8}, // warm-up samples
+				{riceMethod4Bit, 2}, {1, 4},
+				{0, 4}, {0b1, 1}, // partition 0: residual 0 after the warm-up samples
+				{1, 4}, {0b10, 2}, {0b010, 3}, {0b11, 2}, // partition 1: residuals 0, 1, -1 with parameter 1
+			},
+			blockSize: 6,
+			bitDepth:  8,
+			expected:  []int32{1, 2, 3, 4, 6, 7},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			bw := NewBitWriter(&buf)
+			for _, f := range tt.fields {
+				bw.WriteBits(f.value, f.n)
+			}
+			if err := bw.Flush(); err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+
+			samples, err := readSubframe(NewBitReader(&buf), tt.blockSize, tt.bitDepth)
+			if err != nil {
+				t.Fatalf("readSubframe failed: %v", err)
+			}
+			if !reflect.DeepEqual(samples, tt.expected) {
+				t.Errorf("expected samples %v, got %v", tt.expected, samples)
+			}
+		})
+	}
+}
+
+func TestDecodeCorruption(t *testing.T) {
+	samples := sineSamples(3*DefaultMinBlockSize+100, 2)
+	encoded := encodeToBuffer(t, newTestFormat(44100, 2, 16, samples...))
+	// The MD5 signature fills the last 16 bytes of STREAMINFO
+	md5Offset := len(FlacMarker) + 4 + StreamInfoSize - 16
+
+	tests := []struct {
+		name     string
+		offset   int
+		expected error // nil if any decoding error will do
+	}{
+		{name: "Frame CRC-16", offset: len(encoded) - 1, expected: ErrFrameCRCMismatch},
+		{name: "STREAMINFO MD5", offset: md5Offset, expected: ErrMD5Mismatch},
+		{name: "Frame body", offset: len(encoded) - 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			corrupted := bytes.Clone(encoded)
+			corrupted[tt.offset] ^= 0x10
+
+			decoder, err := NewDecoder(bytes.NewReader(corrupted))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			buffer := make([]int32, 1000)
+			for err == nil {
+				_, err = decoder.ReadSamples(buffer)
+			}
+			if err == io.EOF {
+				t.Fatalf("expected the corruption to be detected, decoded to the end")
+			}
+			if tt.expected != nil && !errors.Is(err, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestDecodeFrameFormatMismatch(t *testing.T) {
+	encoded := encodeToBuffer(t, newTestFormat(44100, 2, 16, sineSamples(DefaultMinBlockSize, 2)...))
+	// Channels and bit depth share STREAMINFO bytes 12 and 13
+	infoOffset := len(FlacMarker) + 4
+
+	tests := []struct {
+		name     string
+		patch    map[int]byte // STREAMINFO byte offset to the bits flipped in it
+		channels int
+		bitDepth int
+	}{
+		{name: "Channels", patch: map[int]byte{12: 0x02}, channels: 1, bitDepth: 16},
+		{name: "Bit depth", patch: map[int]byte{12: 0x01, 13: 0x80}, channels: 2, bitDepth: 24},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched := bytes.Clone(encoded)
+			for offset, bits := range tt.patch {
+				patched[infoOffset+offset] ^= bits
+			}
+			decoder, err := NewDecoder(bytes.NewReader(patched))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if info := decoder.StreamInfo(); info.Channels != tt.channels || info.BitDepth != tt.bitDepth {
+				t.Fatalf("expected STREAMINFO patched to %d channels of %d bits, got %d of %d", tt.channels, tt.bitDepth, info.Channels, info.BitDepth)
+			}
+
+			_, err = decoder.ReadSamples(make([]int32, 1000))
+			expected := fmt.Sprintf("frame 0 has 2 channels of 16 bits, STREAMINFO has %d channels of %d bits", tt.channels, tt.bitDepth)
+			if err == nil || err.Error() != expected {
+				t.Errorf("expected error %q, got %v", expected, err)
+			}
+		})
+	}
+}
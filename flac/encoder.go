@@ -1,13 +1,16 @@
 package flac
 
 import (
-	"encoding/binary"
+	"bytes"
+	"context"
+	"crypto/md5"
 	"fmt"
+	"hash"
 	"io"
+	"log/slog"
 	"math"
 	"os"
-
-	"log"
+	"time"
 
 	"github.com/nooooaaaaah/soundcompression/audio"
 )
@@ -15,37 +18,215 @@ import (
 const (
 	FlacMarker          = "fLaC"
 	StreamInfoSize      = 34
+	LastMetadataBlock   = 0x80 // flag in the first header byte of the final metadata block
 	DefaultMinBlockSize = 4096
 	DefaultMaxBlockSize = 4096
+	MinBlockSize        = 16
+	MaxBlockSize        = 65535
+
+	// Rice partition orders: a residual is split into up to 2^order partitions.
+	DefaultMaxPartitionOrder = 5
+	MaxPartitionOrder        = 15
+
+	// maxFrameSizeField is the largest frame size STREAMINFO's 24-bit fields hold.
+	maxFrameSizeField = 1<<24 - 1
+
+	// maxTotalSamples is the largest sample count STREAMINFO's 36-bit field holds.
+	maxTotalSamples = 1<<36 - 1
+
+	// maxSampleRate is the largest rate in Hz STREAMINFO's 20-bit field holds.
+	maxSampleRate = 1<<20 - 1
 )
 
 type Encoder struct {
-	input        audio.Format
-	output       *os.File
-	minBlockSize int
-	maxBlockSize int
-	md5sum       []byte
-	logging      bool
+	input             audio.Format
+	output            io.Writer // seeked back to patch STREAMINFO if it is also an io.Seeker
+	outputPath        string    // path of the output file, when the encoder created it
+	minBlockSize      int       // samples per channel in a block, not bytes
+	maxBlockSize      int       // samples per channel in a block, not bytes
+	variableBlockSize bool      // number frames by their first sample rather than by position
+	observedBlocks    bool      // write the block sizes used rather than the configured bounds to STREAMINFO
+	maxPartitionOrder int
+	partitionSearch   bool // try every partition order up to the maximum rather than only the maximum
+	exhaustiveRice    bool // try every Rice parameter rather than estimating one
+	stereoMode        stereoMode
+	verify            bool // decode each frame after encoding it and compare
+	exactLength       bool // fail if the input's length differs from its TotalSamples
+	outputBitDepth    int  // bits per sample to encode at, 0 for the input's
+	maxLPCOrder       int  // highest LPC order tried, 0 for fixed predictors only
+	predictorMode     PredictorMode
+	lpcPrecision      int // bits per quantized LPC coefficient
+	apodization       apodization
+	window            []float64 // apodization window for the current block size
+	md5sum            []byte
+	md5hash           hash.Hash
+	buffer            []int32 // interleaved samples of the block being read, kept across Reset
+	frameNumber       uint64
+	samplesDone       uint64
+	logging           bool         // whether a logger is set, so log arguments need building
+	logger            *slog.Logger // never nil; discards everything unless set
+	progress          func(samplesDone, samplesTotal uint64)
+	tags              map[string]string // Vorbis comments, written after STREAMINFO
+	gapless           *gaplessInfo      // delay and padding to record, nil for none
+	pictures          []picture
+	applications      []application
+	seekInterval      float64 // seconds between seek points, 0 for no seek table
+	seekTable         *seekTable
+	moreMetadata      bool   // whether metadata blocks follow STREAMINFO
+	frameBytes        uint64 // bytes of frames written so far
+	headerBytes       uint64 // bytes of the marker and metadata blocks
+	started           time.Time
+	elapsed           time.Duration // time the last Encode took
+	minFrameSize      int           // smallest frame written, in bytes
+	maxFrameSize      int           // largest frame written, in bytes
+	minBlockSeen      int           // smallest block written, in samples per channel
+	maxBlockSeen      int           // largest block written, in samples per channel
+	flushInterval     time.Duration // time between periodic Flush calls, 0 for none
+	analysis          io.Writer     // where frames are described as they are encoded, nil for nowhere
+	lastFlush         time.Time
+	resuming          bool // Encode continues the stream ResumeEncoder read back rather than starting one
+
+	// streamStart is the output offset of the "fLaC" marker, used to seek back
+	// and patch STREAMINFO. When the output cannot seek, pending buffers the
+	// whole stream until STREAMINFO is final.
+	streamStart int64
+	pending     *bytes.Buffer
 }
 
 // NewEncoder initializes a new Encoder instance for encoding audio data into the FLAC format.
-// It takes an audio input format and an output file path as parameters.
-// Returns a pointer to the Encoder instance and an error if any occurs during file creation.
-func NewEncoder(input audio.Format, outputPath string, logging bool) (*Encoder, error) {
+// It takes an audio input format, an output file path and any options as parameters.
+// Returns a pointer to the Encoder instance and an error if the input format is unsupported,
+// if an option is invalid or if any occurs during file creation. The input and options are
+// validated before the output file is created, so a failure leaves no file behind.
+func NewEncoder(input audio.Format, outputPath string, opts ...Option) (*Encoder, error) {
+	encoder, err := NewEncoderWriter(input, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+
 	outputFile, err := os.Create(outputPath)
 	if err != nil {
 		return nil, fmt.Errorf("error creating output file: %w", err)
 	}
+	encoder.output = outputFile
+	encoder.outputPath = outputPath
+	return encoder, nil
+}
+
+// NewEncoderWriter initializes a new Encoder that writes the FLAC stream to w
+// instead of a file, such as a pipe, a network connection or an HTTP response.
+// If w is not an io.Seeker the stream is buffered in memory until STREAMINFO is
+// final, with its MD5 signature, frame sizes and seek table, and is written
+// out in one go once Encode finishes. The buffer grows to the size of the
+// whole FLAC stream, typically half to two thirds of the PCM input, so for
+// long inputs prefer a file or another io.WriteSeeker. Closing the Encoder
+// does not close w. An input reporting 0 total
+// samples, such as a live source, is encoded as a stream of unknown length.
+func NewEncoderWriter(input audio.Format, w io.Writer, opts ...Option) (*Encoder, error) {
+	if err := validateFormat(input); err != nil {
+		return nil, err
+	}
 
-	// Enforce the requriemnts of a flac encoder
+	encoder := &Encoder{
+		input:             input,
+		output:            w,
+		minBlockSize:      DefaultMinBlockSize,
+		maxBlockSize:      DefaultMaxBlockSize,
+		maxPartitionOrder: DefaultMaxPartitionOrder,
+		partitionSearch:   true,
+		maxLPCOrder:       DefaultMaxLPCOrder,
+		lpcPrecision:      DefaultLPCPrecision,
+		logger:            discardLogger,
+	}
+	encoder.apodization, _ = parseApodization(DefaultApodization)
+	for _, opt := range opts {
+		if err := opt(encoder); err != nil {
+			return nil, fmt.Errorf("invalid encoder option: %w", err)
+		}
+	}
 
-	return &Encoder{
-		input:        input,
-		output:       outputFile,
-		minBlockSize: DefaultMinBlockSize,
-		maxBlockSize: DefaultMaxBlockSize,
-		logging:      logging,
-	}, nil
+	if err := encoder.validateBlockSize(); err != nil {
+		return nil, err
+	}
+	var err error
+	if encoder.input, err = encoder.requantizeInput(input); err != nil {
+		return nil, fmt.Errorf("invalid encoder option: %w", err)
+	}
+	return encoder, nil
+}
+
+// requantizeInput returns input as it is to be encoded: reduced to the bit
+// depth set with WithOutputBitDepth, with TPDF dither, if that is lower than
+// the input's own. A higher one is an error.
+func (e *Encoder) requantizeInput(input audio.Format) (audio.Format, error) {
+	if e.outputBitDepth == 0 {
+		return input, nil
+	}
+	if e.outputBitDepth > input.BitDepth() {
+		return nil, fmt.Errorf("output bit depth %d exceeds the input's %d bits", e.outputBitDepth, input.BitDepth())
+	}
+	return audio.Requantize(input, e.outputBitDepth, audio.TPDF), nil
+}
+
+// validateFormat checks that the input has 1-8 channels, 4-32 bits per sample,
+// a sample rate of 1 Hz to 2^20-1 Hz and a total length below 2^36 samples,
+// the ranges STREAMINFO and the frame header can hold.
+func validateFormat(input audio.Format) error {
+	bitDepth, channels := input.BitDepth(), input.Channels()
+	if bitDepth < 4 || bitDepth > 32 || channels < 1 || channels > 8 {
+		return fmt.Errorf("%w: %d channels at %d bits per sample", ErrUnsupportedFormat, channels, bitDepth)
+	}
+	if rate := input.SampleRate(); rate < 1 || rate > maxSampleRate {
+		return fmt.Errorf("%w: sample rate of %d Hz does not fit STREAMINFO's 20 bits", ErrUnsupportedFormat, rate)
+	}
+	if total := input.TotalSamples(); total > maxTotalSamples {
+		return fmt.Errorf("%w: %d total samples do not fit STREAMINFO's 36 bits", ErrUnsupportedFormat, total)
+	}
+	return nil
+}
+
+// validateBlockSize checks that the block sizes are within the 16-65535
+// samples per channel FLAC allows. The limits are counts of samples whatever
+// the input's bit depth and channel count, not sizes in bytes.
+func (e *Encoder) validateBlockSize() error {
+	if e.minBlockSize < MinBlockSize {
+		return fmt.Errorf("block size %d is too small: need at least %d samples per channel", e.minBlockSize, MinBlockSize)
+	}
+	if e.maxBlockSize < e.minBlockSize || e.maxBlockSize > MaxBlockSize {
+		return fmt.Errorf("invalid maximum block size %d: must be between %d and %d samples per channel", e.maxBlockSize, e.minBlockSize, MaxBlockSize)
+	}
+	return nil
+}
+
+// Reset rebinds the Encoder to a new input and output, keeping its options and
+// buffers, so one Encoder can encode file after file. Nothing of the previous
+// stream carries over: its MD5 signature, frame count, frame sizes, seek table
+// and stats all start afresh. A file the Encoder created with NewEncoder is closed
+// first and an error closing it is returned once the Encoder is rebound; as
+// with NewEncoderWriter, w itself is never closed by the Encoder.
+func (e *Encoder) Reset(input audio.Format, w io.Writer) error {
+	if err := validateFormat(input); err != nil {
+		return err
+	}
+	input, err := e.requantizeInput(input)
+	if err != nil {
+		return err
+	}
+	closeErr := e.Close()
+
+	e.input = input
+	e.output = w
+	e.outputPath = ""
+	e.md5sum = nil
+	e.frameNumber, e.samplesDone = 0, 0
+	e.frameBytes, e.headerBytes = 0, 0
+	e.minFrameSize, e.maxFrameSize = 0, 0
+	e.minBlockSeen, e.maxBlockSeen = 0, 0
+	e.elapsed = 0
+	e.seekTable = nil
+	e.pending = nil
+	e.resuming = false
+	return closeErr
 }
 
 /*
@@ -53,86 +234,170 @@ Encoder is responsible for encoding raw audio data into the FLAC format.
 
 The Encoder struct contains:
   - input: an audio.Format interface representing the audio data to be encoded.
-  - output: a file where the encoded FLAC data will be written.
-  - minBlockSize and maxBlockSize: parameters that define the minimum and maximum block sizes for encoding.
+  - output: the file or writer where the encoded FLAC data will be written.
+  - minBlockSize and maxBlockSize: the minimum and maximum block sizes for encoding, in samples per channel.
   - md5sum: a byte slice to store the MD5 checksum of the unencoded audio data.
-  - verbose: a boolean flag to enable verbose logging.
+  - logger: where log messages go, set with WithLogger or WithLogging.
 
 The Encode method is the main function that handles the encoding process. It performs the following steps:
  1. Writes the stream header, including the FLAC marker and STREAMINFO metadata block.
  2. Creates a buffer to hold audio samples.
- 3. Reads audio samples from the input in blocks and encodes each block.
- 4. Writes the stream footer to finalize the FLAC file.
+ 3. Reads audio samples from the input in full blocks, feeds them to the MD5 hash and encodes each block. The last block may be short; its frame header records its true size.
+ 4. Writes the stream footer, which patches STREAMINFO with the final MD5 signature and finalizes the FLAC file.
 
 Usage:
- 1. Create an Encoder instance using NewEncoder by providing the audio input format and output file path.
- 2. Call the Encode method to start the encoding process.
- 3. Close the Encoder to ensure the output file is properly closed.
+ 1. Create an Encoder instance using NewEncoder by providing the audio input format and output file path, or NewEncoderWriter to write to any io.Writer.
+ 2. Call the Encode method to start the encoding process, or EncodeContext to be able to cancel it.
+ 3. Close the Encoder to ensure the output file is properly closed, or Reset it to encode another input with the same options.
 */
 func (e *Encoder) Encode() error {
+	return e.EncodeContext(context.Background())
+}
+
+// EncodeContext encodes like Encode, checking ctx between blocks. If ctx is
+// cancelled it stops and returns the context's error, discarding the partially
+// written stream so it cannot be mistaken for a complete file: a file created
+// by NewEncoder is closed and removed, a seekable output is truncated back to
+// where the stream started, and a buffered stream is never written out. Other
+// failures are returned as an *EncodingError naming the stage that failed.
+func (e *Encoder) EncodeContext(ctx context.Context) error {
 	if e.logging {
-		log.Println("Starting encoding process")
+		e.logger.Info("Starting encoding process")
 	}
 
-	// Write the stream header
-	err := e.writeStreamHeader()
-	if err != nil {
-		return fmt.Errorf("error writing stream header: %w", err)
+	// A resumed encode carries on after the frames ResumeEncoder read back;
+	// any other starts a new stream
+	if e.resuming {
+		e.resuming = false
+	} else {
+		e.beginStream()
+		if err := e.writeStreamHeader(); err != nil {
+			return NewEncodingError(StageStreamHeader, err)
+		}
 	}
 
-	// Create a buffer to hold audio samples
-	buffer := make([]int32, e.minBlockSize*e.input.Channels())
+	// Create a buffer to hold audio samples, reusing the last stream's if it is large enough
+	size := e.minBlockSize * e.input.Channels()
+	if cap(e.buffer) < size {
+		e.buffer = make([]int32, size)
+	}
+	buffer := e.buffer[:size]
 	for {
-		// Read samples from the input
-		n, err := e.input.ReadSamples(buffer)
-		if err == io.EOF {
-			break // End of file reached
+		if err := ctx.Err(); err != nil {
+			e.abort()
+			return err
 		}
+
+		// Read a whole block from the input; only the last may be short
+		n, err := e.readBlock(buffer)
 		if err != nil {
-			return fmt.Errorf("error reading input: %w", err)
+			return NewEncodingError(StageRead, err)
+		}
+		if n == 0 {
+			break // End of file reached
 		}
 
+		e.updateMD5(buffer[:n])
+
 		// Encode the block of samples
 		err = e.encodeBlock(buffer[:n])
 		if err != nil {
-			return fmt.Errorf("error encoding block: %w", err)
+			return NewEncodingError(StageBlock, err)
 		}
 
 		if e.logging {
-			log.Printf("Encoded block of %d samples", n)
+			e.logger.Debug("Encoded block", "samples", n)
+		}
+
+		e.samplesDone += uint64(n / e.input.Channels())
+		if e.progress != nil {
+			e.progress(e.samplesDone, e.input.TotalSamples())
 		}
+
+		if e.flushInterval > 0 && e.pending == nil && time.Since(e.lastFlush) >= e.flushInterval {
+			if err := e.Flush(); err != nil {
+				return NewEncodingError(StageFlush, err)
+			}
+		}
+	}
+
+	if total := e.input.TotalSamples(); e.exactLength && total > 0 && e.samplesDone != total {
+		return NewEncodingError(StageRead, fmt.Errorf("%w: read %d samples, expected %d", ErrLengthMismatch, e.samplesDone, total))
 	}
 
 	// Write the stream footer
-	err = e.writeStreamFooter()
-	if err != nil {
-		return fmt.Errorf("error writing stream footer: %w", err)
+	if err := e.writeStreamFooter(); err != nil {
+		return NewEncodingError(StageStreamFooter, err)
 	}
+	e.elapsed = time.Since(e.started)
 
 	if e.logging {
-		log.Println("Finished encoding process")
+		e.logger.Info("Finished encoding process")
 	}
 
 	return nil
 }
 
+// readBlock fills buffer from the input, reading as many times as it takes,
+// so that every frame but the last holds a full block even when the input
+// returns fewer samples than asked for. Samples returned together with io.EOF
+// are counted like any others. It returns the number of samples read, short
+// only at the end of the input, and 0 once the input is exhausted. buffer
+// holds whole inter-channel samples, and reads may split one across calls, but
+// an input ending partway through one is an ErrPartialSample rather than a
+// block whose channels disagree on its length.
+func (e *Encoder) readBlock(buffer []int32) (int, error) {
+	n := 0
+	for n < len(buffer) {
+		read, err := e.input.ReadSamples(buffer[n:])
+		n += read
+		if err == io.EOF || (err == nil && read == 0) {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+	if channels := e.input.Channels(); n%channels != 0 {
+		return n, fmt.Errorf("%w: %d of %d channels read", ErrPartialSample, n%channels, channels)
+	}
+	return n, nil
+}
+
 /*
-writeStreamHeader writes the initial FLAC stream header, which includes the FLAC marker and the STREAMINFO metadata block. This header is essential for any FLAC file as it signals the beginning of the FLAC stream and provides the decoder with necessary information about the audio data.
+writeStreamHeader writes the initial FLAC stream header, which includes the FLAC marker and the metadata blocks. This header is essential for any FLAC file as it signals the beginning of the FLAC stream and provides the decoder with necessary information about the audio data.
 
 The function performs the following steps:
 
  1. Writes the FLAC marker "fLaC" to the output file, which is a mandatory identifier for FLAC streams.
  2. Calls writeStreamInfo to write the STREAMINFO metadata block, which contains crucial information about the audio stream, such as block sizes, sample rate, and MD5 checksum.
+ 3. Writes the optional metadata blocks: a SEEKTABLE if WithSeekTable was given, whose points are filled in once the frames are written, a VORBIS_COMMENT block holding the tags set with WithTags, a PICTURE block for each WithPicture and an APPLICATION block for each WithApplication. Only the final block carries the last-metadata-block flag.
 
 If any error occurs during these steps, the function returns the error to ensure proper error handling.
 */
 func (e *Encoder) writeStreamHeader() error {
 	if e.logging {
-		log.Println("Writing stream header")
+		e.logger.Debug("Writing stream header")
 	}
 
+	// A seek table needs to know how many points to reserve
+	e.seekTable = nil
+	if e.seekInterval > 0 {
+		if total := e.input.TotalSamples(); total > 0 {
+			e.seekTable = newSeekTable(e.seekInterval, e.input.SampleRate(), total)
+		} else if e.logging {
+			e.logger.Warn("Total samples unknown, skipping seek table")
+		}
+	}
+
+	blocks, err := e.metadataBlocks()
+	if err != nil {
+		return err
+	}
+	e.moreMetadata = len(blocks) > 0
+
 	// marker for flac metadata
-	_, err := e.output.Write([]byte("fLaC"))
+	_, err = e.sink().Write([]byte(FlacMarker))
 	if err != nil {
 		return err
 	}
@@ -143,7 +408,22 @@ func (e *Encoder) writeStreamHeader() error {
 		return err
 	}
 
-	// TODO more metadata blocks
+	// Write the other metadata blocks, flagging the final one as last
+	offset := int64(len(FlacMarker) + 4 + StreamInfoSize)
+	for i, b := range blocks {
+		if e.logging {
+			e.logger.Debug("Writing metadata block", "type", b.blockType)
+		}
+		header := metadataBlockHeader(b.blockType, len(b.body), i == len(blocks)-1)
+		if _, err := e.sink().Write(append(header, b.body...)); err != nil {
+			return err
+		}
+		if b.blockType == metadataSeekTable {
+			e.seekTable.offset = offset + int64(len(header))
+		}
+		offset += int64(len(header) + len(b.body))
+	}
+	e.headerBytes = uint64(offset)
 
 	return nil
 }
@@ -151,167 +431,541 @@ func (e *Encoder) writeStreamHeader() error {
 /*
 The writeStreamInfo function is responsible for writing the STREAMINFO metadata block, which is a mandatory block in the FLAC format. This block contains essential information about the audio stream, such as block sizes, sample rate, and MD5 checksum. The function performs the following steps:
 
- 1. Writes the metadata block header indicating a STREAMINFO block with a size of 34 bytes.
- 2. Creates a 34-byte array to store STREAMINFO data.
- 3. Fills the array with the minimum and maximum block sizes.
- 4. Writes the sample rate, left-shifted by 4 bits for alignment.
- 5. Encodes the number of channels and bits per sample into a single byte.
- 6. Writes the total number of samples.
- 7. Copies the MD5 checksum of the unencoded audio data into the array.
- 8. Writes the STREAMINFO block to the output file.
+ 1. Validates the block sizes against the 16-65535 range the format allows.
+ 2. Writes the metadata block header indicating a STREAMINFO block with a size of 34 bytes.
+ 3. Packs the minimum and maximum block and frame sizes.
+ 4. Packs the 20-bit sample rate, 3-bit channel count minus one, 5-bit bits per sample minus one and 36-bit total sample count into bytes 10-17.
+ 5. Appends the MD5 checksum of the unencoded audio data as bytes 18-33.
+ 6. Writes the STREAMINFO block to the output file.
+
+The block itself is built by streamInfoBlock so that patchMetadata can rewrite it once the MD5 signature is known.
 
 This function is crucial because the STREAMINFO block provides the decoder with all the necessary parameters to correctly interpret the audio data. Without this information, the decoder would not know how to process the audio stream.
 */
 func (e *Encoder) writeStreamInfo() error {
 	if e.logging {
-		log.Println("Writing STREAMINFO metadata block")
+		e.logger.Debug("Writing STREAMINFO metadata block")
 	}
 
-	// STREAMINFO block should be 34 bytes long and contain the following:
-	// - Minimum block size (2 bytes)
-	// - Maximum block size (2 bytes)
-	// - Minimum frame size (3 bytes)
-	// - Maximum frame size (3 bytes)
-	// - Sample rate (20 bits, left-shifted by 4 bits for alignment)
-	// - Number of channels (3 bits) and bits per sample (5 bits)
-	// - Total number of samples (36 bits)
-	// - MD5 signature of the unencoded audio data (16 bytes)
-
-	// Write the metadata block header for STREAMINFO with size 34 bytes
-	_, err := e.output.Write([]byte{0x00, 0x00, 0x00, 0x22})
+	block, err := e.streamInfoBlock(e.input.TotalSamples())
 	if err != nil {
 		return err
 	}
 
-	// Create a byte array for STREAMINFO block, which is 34 bytes long
-	streamInfo := make([]byte, 34)
+	// Write the STREAMINFO block to the output
+	_, err = e.sink().Write(block)
+	return err
+}
 
-	// Write the minimum block size (2 bytes)
-	binary.BigEndian.PutUint16(streamInfo[0:2], uint16(e.minBlockSize))
+// streamInfoBlock returns the STREAMINFO metadata block, including its 4-byte
+// header, reporting totalSamples samples per channel.
+func (e *Encoder) streamInfoBlock(totalSamples uint64) ([]byte, error) {
+	if e.minBlockSize < MinBlockSize || e.minBlockSize > MaxBlockSize {
+		return nil, fmt.Errorf("invalid minimum block size %d: must be between %d and %d", e.minBlockSize, MinBlockSize, MaxBlockSize)
+	}
+	if e.maxBlockSize < e.minBlockSize || e.maxBlockSize > MaxBlockSize {
+		return nil, fmt.Errorf("invalid maximum block size %d: must be between %d and %d", e.maxBlockSize, e.minBlockSize, MaxBlockSize)
+	}
 
-	// Write the maximum block size (2 bytes)
-	binary.BigEndian.PutUint16(streamInfo[2:4], uint16(e.maxBlockSize))
+	// STREAMINFO block should be 34 bytes long and contain the following:
+	// - Minimum block size (16 bits)
+	// - Maximum block size (16 bits)
+	// - Minimum frame size (24 bits)
+	// - Maximum frame size (24 bits)
+	// - Sample rate (20 bits)
+	// - Number of channels minus one (3 bits)
+	// - Bits per sample minus one (5 bits)
+	// - Total number of samples (36 bits), 0 when the input cannot tell its length
+	// - MD5 signature of the unencoded audio data (128 bits)
+
+	streamInfo := bytes.NewBuffer(make([]byte, 0, 4+StreamInfoSize))
+
+	// Metadata block header for STREAMINFO with size 34 bytes, flagged as the
+	// last block unless others follow
+	streamInfo.Write(metadataBlockHeader(metadataStreamInfo, StreamInfoSize, !e.moreMetadata))
+
+	bw := NewBitWriter(streamInfo)
+
+	// Block sizes (16 bits each): the configured bounds, or those of the
+	// blocks written so far if asked for, the minimum kept within 16-65535
+	minBlockSize, maxBlockSize := e.minBlockSize, e.maxBlockSize
+	if e.observedBlocks && e.maxBlockSeen > 0 {
+		minBlockSize, maxBlockSize = max(e.minBlockSeen, MinBlockSize), max(e.maxBlockSeen, MinBlockSize)
+	}
+	bw.WriteBits(uint64(minBlockSize), 16)
+	bw.WriteBits(uint64(maxBlockSize), 16)
+
+	// Frame sizes (24 bits each), 0 meaning unknown: before any frame is
+	// written, or if a frame is too large for the field
+	minFrameSize, maxFrameSize := e.minFrameSize, e.maxFrameSize
+	if maxFrameSize > maxFrameSizeField {
+		minFrameSize, maxFrameSize = 0, 0
+	}
+	bw.WriteBits(uint64(minFrameSize), 24)
+	bw.WriteBits(uint64(maxFrameSize), 24)
+
+	// Sample rate, channels, bits per sample and total samples share bytes 10-17
+	bw.WriteBits(uint64(e.input.SampleRate()), 20)
+	bw.WriteBits(uint64(e.input.Channels()-1), 3)
+	bw.WriteBits(uint64(e.input.BitDepth()-1), 5)
+	bw.WriteBits(totalSamples, 36)
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
 
-	// Write the sample rate (20 bits, left-shifted by 4 bits for alignment)
-	binary.BigEndian.PutUint32(streamInfo[10:14], uint32(e.input.SampleRate())<<4)
+	// MD5 signature of the unencoded audio data (16 bytes), zero if not yet known
+	var md5sum [16]byte
+	copy(md5sum[:], e.md5sum)
+	streamInfo.Write(md5sum[:])
 
-	// Write the number of channels (3 bits) and bits per sample (5 bits)
-	streamInfo[14] = byte(e.input.Channels()-1)<<4 | byte(e.input.BitDepth()-1)
+	return streamInfo.Bytes(), nil
+}
 
-	// Write the total number of samples (36 bits)
-	binary.BigEndian.PutUint64(streamInfo[18:26], uint64(e.input.TotalSamples()))
+// beginStream records where the stream starts in the output so STREAMINFO can
+// be patched later. Outputs that cannot seek, such as pipes or plain writers,
+// get the whole stream buffered in memory instead.
+func (e *Encoder) beginStream() {
+	if e.md5hash == nil {
+		e.md5hash = md5.New()
+	} else {
+		e.md5hash.Reset()
+	}
+	e.md5sum = nil
+	e.frameNumber = 0
+	e.samplesDone = 0
+	e.frameBytes, e.headerBytes = 0, 0
+	e.minFrameSize, e.maxFrameSize = 0, 0
+	e.minBlockSeen, e.maxBlockSeen = 0, 0
+	e.pending = nil
+	e.started, e.elapsed = time.Now(), 0
+	e.lastFlush = e.started
+
+	if seeker, ok := e.output.(io.Seeker); ok {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			e.streamStart = offset
+			return
+		}
+	}
 
-	// Write the MD5 signature of the unencoded audio data (16 bytes)
-	copy(streamInfo[18:], e.md5sum)
+	if e.logging {
+		e.logger.Info("Output is not seekable, buffering stream")
+	}
+	e.pending = new(bytes.Buffer)
+}
 
-	// Write the STREAMINFO block to the output
-	_, err = e.output.Write(streamInfo)
+// abort discards a partially written stream after a cancelled encode.
+func (e *Encoder) abort() {
+	if e.logging {
+		e.logger.Warn("Encoding cancelled, discarding partial output")
+	}
+
+	if e.outputPath != "" {
+		e.pending = nil
+		e.Close()
+		os.Remove(e.outputPath)
+		e.outputPath = ""
+		return
+	}
+
+	// Nothing of a buffered stream has reached the output yet
+	if e.pending != nil {
+		e.pending = nil
+		return
+	}
+
+	if truncater, ok := e.output.(interface{ Truncate(size int64) error }); ok {
+		if truncater.Truncate(e.streamStart) == nil {
+			e.output.(io.Seeker).Seek(e.streamStart, io.SeekStart)
+		}
+	}
+}
+
+// sink returns the writer stream bytes go to: the pending buffer when the
+// output cannot seek, otherwise the output itself.
+func (e *Encoder) sink() io.Writer {
+	if e.pending != nil {
+		return e.pending
+	}
+	return e.output
+}
+
+// updateMD5 feeds interleaved samples into the MD5 hash using the layout the
+// format defines: each sample signed, little-endian, in the fewest whole bytes
+// that hold the bit depth.
+func (e *Encoder) updateMD5(samples []int32) {
+	writeMD5Samples(e.md5hash, samples, e.input.BitDepth())
+}
+
+// writeMD5Samples writes interleaved samples to h in the layout the MD5
+// signature covers. The decoder uses it to check the signature.
+func writeMD5Samples(h hash.Hash, samples []int32, bitDepth int) {
+	bytesPerSample := (bitDepth + 7) / 8
+	buf := make([]byte, len(samples)*bytesPerSample)
+	for i, sample := range samples {
+		for b := 0; b < bytesPerSample; b++ {
+			buf[i*bytesPerSample+b] = byte(sample >> (8 * b))
+		}
+	}
+	h.Write(buf)
+}
+
+// patchMetadata rewrites the STREAMINFO block, reporting totalSamples samples
+// per channel, and the seek table if there is one, with their current values.
+// A seekable output is rewritten in place; a buffered stream is edited in
+// memory and then written out to the output.
+func (e *Encoder) patchMetadata(totalSamples uint64) error {
+	if e.logging {
+		e.logger.Debug("Patching metadata blocks")
+	}
+
+	block, err := e.streamInfoBlock(totalSamples)
+	if err != nil {
+		return err
+	}
+	type patch struct {
+		offset int64 // from the start of the stream
+		data   []byte
+	}
+	patches := []patch{{int64(len(FlacMarker)), block}}
+	if e.seekTable != nil {
+		patches = append(patches, patch{e.seekTable.offset, e.seekTable.block()})
+	}
+
+	if e.pending != nil {
+		for _, p := range patches {
+			copy(e.pending.Bytes()[p.offset:], p.data)
+		}
+		_, err := e.pending.WriteTo(e.output)
+		e.pending = nil
+		return err
+	}
+
+	seeker := e.output.(io.Seeker)
+	for _, p := range patches {
+		if _, err := seeker.Seek(e.streamStart+p.offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := e.output.Write(p.data); err != nil {
+			return err
+		}
+	}
+	_, err = seeker.Seek(0, io.SeekEnd)
 	return err
 }
 
+/*
+writeStreamFooter finalizes the FLAC stream once the last block has been encoded. FLAC has no footer as such: the stream simply ends after the last frame. What is left to do at this point is to make the header describe the finished stream.
+
+The function performs the following steps:
+ 1. Finalizes the MD5 signature of the unencoded audio data.
+ 2. Patches the STREAMINFO block with it and the smallest and largest frame sizes seen, along with the seek table's points, either by seeking back or, when the output cannot seek, by editing the buffered stream.
+ 3. Writes any buffered stream bytes out to the output.
+*/
 func (e *Encoder) writeStreamFooter() error {
 	if e.logging {
-		log.Println("Writing stream footer")
+		e.logger.Debug("Writing stream footer")
 	}
-	return fmt.Errorf("not implemented")
+
+	e.md5sum = e.md5hash.Sum(nil)
+	if err := e.patchMetadata(e.input.TotalSamples()); err != nil {
+		return fmt.Errorf("error patching metadata: %w", err)
+	}
+	return nil
+}
+
+// Flush makes the stream written so far a valid FLAC stream on its own, so
+// that a long encode cut short by a crash still leaves a playable file. It
+// patches STREAMINFO to describe the frames written up to now, with their
+// sample count, frame sizes and MD5 signature, along with the seek table,
+// then syncs the output to stable storage if it has a Sync method, as an
+// *os.File does. Frames written after the last Flush are not covered by the
+// patched STREAMINFO until the next Flush or the end of the encode.
+//
+// Flush is meant to be called while Encode runs, such as from a WithProgress
+// callback; WithFlushInterval calls it periodically. It fails for an output
+// that cannot seek, whose stream is buffered in memory until the end.
+func (e *Encoder) Flush() error {
+	if e.md5hash == nil {
+		return fmt.Errorf("no stream to flush")
+	}
+	if e.pending != nil {
+		return fmt.Errorf("cannot flush a stream buffered for an output that cannot seek")
+	}
+	if e.logging {
+		e.logger.Debug("Flushing stream", "samples", e.samplesDone)
+	}
+
+	// Sum leaves the hash running, so the final signature still covers every sample
+	e.md5sum = e.md5hash.Sum(nil)
+	if err := e.patchMetadata(e.samplesDone); err != nil {
+		return fmt.Errorf("error patching metadata: %w", err)
+	}
+	e.lastFlush = time.Now()
+	if syncer, ok := e.output.(interface{ Sync() error }); ok {
+		if err := syncer.Sync(); err != nil {
+			return fmt.Errorf("error syncing output: %w", err)
+		}
+	}
+	return nil
 }
 
 /*
-encodeBlock is responsible for encoding a block of audio samples. Currently, this function simply writes the raw PCM data to the output file in little-endian format. This is a placeholder implementation and does not perform actual FLAC encoding.
+encodeBlock encodes a block of interleaved audio samples as one FLAC frame and writes it to the output.
 
-The purpose of this function is to provide a starting point for the encoding process. In a complete implementation, this function would handle the compression and encoding of audio samples according to the FLAC specification. For now, it allows the rest of the encoding pipeline to be tested with raw audio data.
+The function performs the following steps:
+ 1. Splits the block into channels. Stereo blocks are decorrelated into whichever of left/right, left/side, side/right or mid/side is estimated to code smallest, or, with exhaustive stereo decorrelation, actually codes smallest.
+ 2. Writes the frame header: sync code, blocking strategy, block size, sample rate, channel assignment, sample size, the UTF-8 coded frame number and the header's CRC-8.
+ 3. Encodes each channel as a subframe: a constant subframe if every sample is the same, otherwise shifting out wasted bits and predicting the samples with the best fixed or LPC predictor, or storing them verbatim if prediction would not make them smaller.
+ 4. Pads the frame to a whole byte and appends the CRC-16 of the whole frame.
+ 5. With WithVerify, decodes the frame again and checks it against the block.
+ 6. With WithAnalysisWriter, describes the frame and the coding of each subframe, then writes the frame out.
 */
 func (e *Encoder) encodeBlock(samples []int32) error {
 	if e.logging {
-		log.Printf("Encoding block of %d samples", len(samples))
+		e.logger.Debug("Encoding block", "samples", len(samples))
 	}
 
-	// For now, just write raw PCM data
-	for _, sample := range samples {
-		err := binary.Write(e.output, binary.LittleEndian, sample)
-		if err != nil {
-			return fmt.Errorf("error writing sample: %w", err)
+	channelSamples := deinterleave(samples, e.input.Channels())
+	blockSize := len(channelSamples[0])
+	assignment, plans := e.planBlock(channelSamples)
+
+	frame, subframeBits, err := e.buildFrame(blockSize, assignment, plans)
+	if err != nil {
+		return err
+	}
+	if e.verify {
+		if err := e.verifyFrame(frame, samples[:blockSize*len(channelSamples)]); err != nil {
+			return err
 		}
 	}
-	return nil
+	if e.analysis != nil {
+		if err := e.writeAnalysis(frame, blockSize, assignment, plans, subframeBits); err != nil {
+			return err
+		}
+	}
+
+	e.countFrame(blockSize, len(frame))
+	_, err = e.sink().Write(frame)
+	return err
 }
 
-/*
-predictSamples is intended to perform linear predictive coding (LPC) on the input samples. LPC is a tool used in audio signal processing to represent the spectral envelope of a digital signal of speech in compressed form, using the information of a linear predictive model.
+// countFrame records a frame of blockSize samples per channel and size bytes
+// starting at the current sample: its seek points, its sizes for STREAMINFO
+// and its place in the stream.
+func (e *Encoder) countFrame(blockSize, size int) {
+	if e.seekTable != nil {
+		e.seekTable.addFrame(e.samplesDone, blockSize, e.frameBytes)
+	}
+
+	if e.minBlockSeen == 0 || blockSize < e.minBlockSeen {
+		e.minBlockSeen = blockSize
+	}
+	if blockSize > e.maxBlockSeen {
+		e.maxBlockSeen = blockSize
+	}
+	if e.minFrameSize == 0 || size < e.minFrameSize {
+		e.minFrameSize = size
+	}
+	if size > e.maxFrameSize {
+		e.maxFrameSize = size
+	}
+
+	e.frameNumber++
+	e.frameBytes += uint64(size)
+}
 
-The function should perform the following steps:
+// planBlock chooses the channel assignment of a block and the coding of each
+// of its subframes, one subframe per channel. Mono and 3 to 8 channel blocks
+// always code their channels independently, with the channel count minus one
+// as the assignment. Only stereo blocks may be decorrelated, and a side
+// channel needs one bit more than the input has; 32-bit input leaves no room
+// for that.
+func (e *Encoder) planBlock(channelSamples [][]int32) (int, []subframePlan) {
+	channels := len(channelSamples)
+	assignment := channels - 1
+	bitDepths := make([]int, channels)
+	for ch := range bitDepths {
+		bitDepths[ch] = e.input.BitDepth()
+	}
+	if channels == 2 && e.input.BitDepth() < 32 {
+		switch e.stereoMode {
+		case stereoExhaustive:
+			return e.planStereo(channelSamples[0], channelSamples[1], e.input.BitDepth())
+		case stereoAdaptive:
+			assignment, channelSamples[0], channelSamples[1] = e.decorrelateStereo(channelSamples[0], channelSamples[1])
+			if side := sideChannel(assignment); side >= 0 {
+				bitDepths[side]++
+			}
+		}
+	}
+
+	plans := make([]subframePlan, channels)
+	for ch, channel := range channelSamples {
+		plans[ch] = e.planSubframe(channel, bitDepths[ch])
+	}
+	return assignment, plans
+}
 
- 1. Calculate the LPC coefficients for the given block of samples. These coefficients represent the filter that can predict the next sample based on previous samples.
- 2. Generate the predicted samples using the LPC coefficients. This involves applying the filter to the previous samples to predict the next sample.
- 3. Calculate the residuals, which are the differences between the actual samples and the predicted samples. These residuals are what will be encoded in the FLAC stream.
+// buildFrame writes a frame of blockSize samples per channel, coded as
+// planned: the header, each subframe, zero padding to a whole byte and the
+// CRC-16 of everything before it. It also returns the number of bits each
+// subframe took as written, which should match its plan.
+func (e *Encoder) buildFrame(blockSize, assignment int, plans []subframePlan) ([]byte, []int64, error) {
+	header, err := e.frameHeader(blockSize, assignment)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error writing frame header: %w", err)
+	}
+
+	var frame bytes.Buffer
+	frame.Write(header)
+	bw := NewBitWriter(&frame)
+	subframeBits := make([]int64, len(plans))
+	for i, plan := range plans {
+		start := bw.BitsWritten()
+		e.writePlannedSubframe(bw, plan)
+		subframeBits[i] = bw.BitsWritten() - start
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, nil, fmt.Errorf("error writing subframes: %w", err)
+	}
+
+	// Frame footer: CRC-16 of everything before it
+	crc := crc16(frame.Bytes())
+	frame.Write([]byte{byte(crc >> 8), byte(crc)})
+	return frame.Bytes(), subframeBits, nil
+}
+
+// deinterleave splits interleaved samples into one slice per channel. Only
+// complete inter-channel samples are kept: if the final one is cut short, its
+// leftover values are dropped rather than misassigned to other channels.
+func deinterleave(samples []int32, channels int) [][]int32 {
+	blockSize := len(samples) / channels
+	channelSamples := make([][]int32, channels)
+	for ch := range channelSamples {
+		channelSamples[ch] = make([]int32, blockSize)
+		for i := range channelSamples[ch] {
+			channelSamples[ch][i] = samples[i*channels+ch]
+		}
+	}
+	return channelSamples
+}
+
+/*
+predictSamples predicts each sample from the ones before it and returns the residual, the part of the signal the prediction could not account for. Residuals of a well predicted signal are small and compress far better than the samples themselves.
 
-The function returns two slices of int32:
- 1. The predicted samples, which are used to reconstruct the original signal during decoding.
- 2. The residuals, which are the differences between the actual and predicted samples and will be encoded.
+Two kinds of predictor are tried. The fixed polynomial predictors FLAC defines need no coefficients to be stored:
+  - order 0: s[n]
+  - order 1: s[n] - s[n-1]
+  - order 2: s[n] - 2s[n-1] + s[n-2]
+  - order 3: s[n] - 3s[n-1] + 3s[n-2] - s[n-3]
+  - order 4: s[n] - 4s[n-1] + 6s[n-2] - 4s[n-3] + s[n-4]
 
-This function is crucial for the compression efficiency of the FLAC encoder, as it reduces the amount of data that needs to be stored by leveraging the predictability of audio signals.
+Linear predictive coding (LPC) fits coefficients to the block instead, at the cost of storing them:
+ 1. The block is weighed by the apodization window, tapering its ends, and its autocorrelation is computed for lags up to the encoder's maximum LPC order.
+ 2. The Levinson-Durbin recursion solves for the coefficients of every order up to that maximum.
+ 3. Each order's coefficients are quantized to integers of the encoder's precision, scaled by a shift, and applied to the samples to get the residual.
+
+The function performs the following steps:
+ 1. Picks the fixed order with the smallest sum of absolute residuals, unless WithPredictor(LPCOnly) rules fixed predictors out.
+ 2. Tries every LPC order, if LPC is enabled and WithPredictor(FixedOnly) does not rule it out.
+ 3. Plans the Rice coding of each candidate's residual and returns the one giving the smallest subframe, counting its warm-up samples and coefficients. The first order samples are warm-up samples stored verbatim, so the residual is that much shorter than the block.
 */
-func (e *Encoder) predictSamples(samples []int32) ([]int32, []int32) {
+func (e *Encoder) predictSamples(sf subframe) prediction {
 	if e.logging {
-		log.Println("Predicting samples using LPC")
+		e.logger.Debug("Predicting samples using fixed and LPC predictors")
 	}
 
-	// Implementation...
-	return nil, nil
+	// Full-scale 32-bit audio can overflow every fixed predictor's residual,
+	// and LPC-only prediction skips them; the infinite size then leaves the
+	// choice to LPC or verbatim coding
+	best := prediction{bits: math.MaxInt}
+	if e.predictorMode != LPCOnly {
+		if order, residual := bestFixedOrder(sf.samples); residual != nil {
+			rc := e.planResidualCoding(residual, order)
+			best = prediction{
+				subframeType: subframeTypeFixed | order,
+				order:        order,
+				residual:     residual,
+				coding:       rc,
+				bits:         subframeHeaderBits(sf.wastedBits) + order*sf.bitDepth + rc.bits,
+			}
+		}
+	}
+
+	if e.predictorMode != FixedOnly {
+		if lpc, ok := e.predictLPC(sf); ok && lpc.bits < best.bits {
+			best = lpc
+		}
+	}
+
+	if e.logging {
+		if best.coefficients != nil {
+			e.logger.Debug("Chose LPC predictor", "order", best.order)
+		} else {
+			e.logger.Debug("Chose fixed predictor", "order", best.order)
+		}
+	}
+	return best
 }
 
 /*
 encodeResidual encodes the residuals (differences between actual samples and predicted samples) into a compressed format suitable for FLAC.
 
-Residual encoding significantly reduces the amount of data that needs to be stored. The residuals are typically encoded using Rice coding, a form of entropy coding efficient for this type of data.
+Residual encoding significantly reduces the amount of data that needs to be stored. The residuals are encoded using Rice coding, a form of entropy coding efficient for this type of data.
 
-The function performs the following steps:
- 1. Determines the optimal Rice parameter for the residuals, balancing the trade-off between the size of the encoded data and the complexity of encoding.
- 2. Encodes the residuals using the calculated Rice parameter by splitting them into groups and encoding each group with the Rice parameter.
- 3. Returns the encoded residuals as a byte slice, which will be written to the FLAC stream.
+The coding is planned beforehand by planResidualCoding, so that its size can be weighed against other subframe types:
+ 1. The residual is split into 2^order partitions for every partition order up to the encoder's maximum that divides the block evenly. The first partition is shorter than the rest by the predictor's warm-up samples.
+ 2. A Rice parameter k is estimated for each partition from the mean of its zigzag-folded residuals, or with WithExhaustiveRiceSearch found by measuring every k, and the Rice coded size is compared against storing the partition escaped as raw binary.
+ 3. The partition order giving the smallest total wins, so that a block that is loud in one part and quiet in another gets a parameter suited to each. Without partition search, as at the fastest compression levels, only the highest order is planned.
+
+The function then writes the coding method, the partition order and, for each partition, the parameter (or escape code) followed by the unary+binary Rice codes or the raw samples. The residual is written straight into the subframe's bitstream, which need not be byte-aligned.
 
 Proper implementation of this function is crucial for achieving high compression ratios in the FLAC format.
 */
-func (e *Encoder) encodeResidual(residual []int32) []byte {
+func (e *Encoder) encodeResidual(bw *BitWriter, residual []int32, rc residualCoding) {
 	if e.logging {
-		log.Println("Encoding residuals")
+		e.logger.Debug("Encoding residuals", "partitions", len(rc.partitions))
 	}
 
-	// Implementation...
-	return nil
+	bw.WriteBits(uint64(rc.method), riceMethodBits)
+	bw.WriteBits(uint64(rc.partitionOrder), ricePartitionOrderBits)
+
+	for _, c := range rc.partitions {
+		part := residual[:c.count]
+		residual = residual[c.count:]
+
+		bw.WriteBits(uint64(c.param), uint(c.paramBits()))
+		if c.escaped {
+			bw.WriteBits(uint64(c.rawBits), riceRawBitsWidth)
+			for _, r := range part {
+				bw.WriteBits(uint64(uint32(r)), uint(c.rawBits))
+			}
+			continue
+		}
+		k := uint(c.param)
+		for _, r := range part {
+			u := zigzag(r)
+			bw.WriteUnary(uint(u >> k))
+			bw.WriteBits(uint64(u), k)
+		}
+	}
 }
 
 // Close closes the output flac file, ensuring all data is properly written and resources are released.
+// Only a file created by NewEncoder is closed; writers passed to NewEncoderWriter are left open,
+// even if they are io.Closers, as they belong to the caller.
 func (e *Encoder) Close() error {
 	if e.logging {
-		log.Println("Closing output file")
+		e.logger.Debug("Closing output file")
 	}
 
-	var outputErr error
-	if e.output != nil {
-		outputErr = e.output.Close()
+	if e.outputPath == "" {
+		return nil
 	}
-	return outputErr
-}
-
-/*
-calcMinBlockSize calculates the minimum block size for FLAC encoding.
-
-The function ensures the bit depth is within the valid range (4-32 bits) and that the number of channels is valid (1-8 channels). It performs the following steps:
- 1. Validates the bit depth and channel count.
- 2. Calculates the total number of bits required for the minimum block size (16 samples).
- 3. Returns the minimum block size in bytes.
-
-The minimum block size affects the overall compression efficiency and latency of the encoded audio. If the bit depth or channels are out of the valid range, the function returns 0 to indicate an error.
-*/
-func calcMinBlockSize(bitDepth, channels int) int {
-	const minSamples = 16
-	if bitDepth >= 4 && bitDepth <= 32 {
-		if channels >= 1 && channels <= 8 {
-			totalBits := minSamples * bitDepth * channels
-			return int(math.Ceil(float64(totalBits) / 8))
-		}
+	closer, ok := e.output.(io.Closer)
+	if !ok {
+		return nil
 	}
-	// Returning 0 indicates that the provided bit depth or channel count is invalid.
-	return 0
+	e.output = nil
+	return closer.Close()
 }
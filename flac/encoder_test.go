@@ -1,8 +1,18 @@
 package flac
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net/http/httptest"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/nooooaaaaah/soundcompression/audio"
 )
@@ -59,7 +69,7 @@ func TestNewEncoder(t *testing.T) {
 
 			tt.expectedInput = audioFormat
 
-			encoder, err := NewEncoder(audioFormat, tt.outputPath, true)
+			encoder, err := NewEncoder(audioFormat, tt.outputPath, WithLogging(true))
 			if (err != nil) != tt.expectedErr {
 				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
 			}
@@ -81,6 +91,132 @@ func TestNewEncoder(t *testing.T) {
 		})
 	}
 }
+
+// claimedFormat reports a sample rate, channel count and bit depth of its
+// own, like a WAV file with a corrupt header.
+type claimedFormat struct {
+	*audio.MemoryFormat
+	sampleRate int
+	channels   int
+	bitDepth   int
+}
+
+func (f *claimedFormat) SampleRate() int { return f.sampleRate }
+func (f *claimedFormat) Channels() int   { return f.channels }
+func (f *claimedFormat) BitDepth() int   { return f.bitDepth }
+
+// oversizedFormat reports a total of its own, such as more samples than
+// STREAMINFO can count.
+type oversizedFormat struct {
+	*audio.MemoryFormat
+	total uint64
+}
+
+func (f *oversizedFormat) TotalSamples() uint64 { return f.total }
+
+func TestNewEncoderUnsupportedFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRate int
+		channels   int
+		bitDepth   int
+	}{
+		{name: "9 channels", sampleRate: 44100, channels: 9, bitDepth: 16},
+		{name: "40-bit depth", sampleRate: 44100, channels: 2, bitDepth: 40},
+		{name: "No channels", sampleRate: 44100, channels: 0, bitDepth: 16},
+		{name: "3-bit depth", sampleRate: 44100, channels: 1, bitDepth: 3},
+		{name: "Zero sample rate", sampleRate: 0, channels: 2, bitDepth: 16},
+		{name: "Sample rate past 20 bits", sampleRate: maxSampleRate + 1, channels: 2, bitDepth: 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := &claimedFormat{MemoryFormat: newTestFormat(44100, 1, 16), sampleRate: tt.sampleRate, channels: tt.channels, bitDepth: tt.bitDepth}
+			outputPath := t.TempDir() + "/unsupported.flac"
+
+			_, err := NewEncoder(input, outputPath)
+			if !errors.Is(err, ErrUnsupportedFormat) {
+				t.Fatalf("expected ErrUnsupportedFormat, got %v", err)
+			}
+			if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+				t.Errorf("expected no output file, got %v", err)
+			}
+
+			if _, err := NewEncoderWriter(input, &bytes.Buffer{}); !errors.Is(err, ErrUnsupportedFormat) {
+				t.Errorf("expected ErrUnsupportedFormat from NewEncoderWriter, got %v", err)
+			}
+		})
+	}
+	// The largest rate STREAMINFO holds is still accepted
+	decoder, err := NewDecoder(bytes.NewReader(encodeToBuffer(t, newTestFormat(maxSampleRate, 1, 16, sineSamples(100, 1)...))))
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if rate := decoder.SampleRate(); rate != maxSampleRate {
+		t.Errorf("expected a sample rate of %d Hz, got %d", maxSampleRate, rate)
+	}
+}
+
+func TestNewEncoderTotalSamplesLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		total       uint64
+		expectedErr bool
+	}{
+		{name: "Largest 36-bit total", total: maxTotalSamples},
+		{name: "One past 36 bits", total: maxTotalSamples + 1, expectedErr: true},
+		{name: "Full 64 bits", total: math.MaxUint64, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := &oversizedFormat{MemoryFormat: newTestFormat(44100, 2, 16), total: tt.total}
+			var out bytes.Buffer
+			encoder, err := NewEncoderWriter(input, &out)
+			if tt.expectedErr {
+				if !errors.Is(err, ErrUnsupportedFormat) {
+					t.Fatalf("expected ErrUnsupportedFormat, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewEncoderWriter failed: %v", err)
+			}
+
+			// The total must reach STREAMINFO whole rather than truncated.
+			block, err := encoder.streamInfoBlock(input.TotalSamples())
+			if err != nil {
+				t.Fatalf("streamInfoBlock failed: %v", err)
+			}
+			if got := decodeStreamInfo(block[4:]).totalSamples; got != tt.total {
+				t.Errorf("expected %d total samples in STREAMINFO, got %d", tt.total, got)
+			}
+		})
+	}
+}
+
+func TestNewEncoderNoFileOnFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "Invalid option", opts: []Option{WithBlockSize(8)}},
+		{name: "Invalid option after a valid one", opts: []Option{WithCompressionLevel(8), WithApodization("blackman")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := t.TempDir() + "/failed.flac"
+			if _, err := NewEncoder(newTestFormat(44100, 2, 16), outputPath, tt.opts...); err == nil {
+				t.Fatalf("expected an error")
+			}
+			if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+				t.Errorf("expected no output file, got %v", err)
+			}
+		})
+	}
+}
+
 func TestWriteStreamInfo(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -125,14 +261,8 @@ func TestWriteStreamInfo(t *testing.T) {
 			}
 			defer audioFormat.Close()
 
-			outputFile, err := os.CreateTemp("", "test_output_*.flac")
-			if err != nil {
-				t.Fatalf("failed to create temp file: %v", err)
-			}
-			defer os.Remove(outputFile.Name())
-
 			encoder := &Encoder{
-				output:       outputFile,
+				output:       &memWriteSeeker{},
 				input:        audioFormat,
 				minBlockSize: tt.minBlockSize,
 				maxBlockSize: tt.maxBlockSize,
@@ -147,3 +277,1358 @@ func TestWriteStreamInfo(t *testing.T) {
 		})
 	}
 }
+
+// streamInfoFields holds the values unpacked from a STREAMINFO block.
+type streamInfoFields struct {
+	minBlockSize, maxBlockSize uint64
+	minFrameSize, maxFrameSize uint64
+	sampleRate                 uint64
+	channels                   uint64
+	bitDepth                   uint64
+	totalSamples               uint64
+	md5sum                     []byte
+}
+
+// decodeStreamInfo unpacks a 34-byte STREAMINFO block into its fields.
+func decodeStreamInfo(block []byte) streamInfoFields {
+	r := &testBitReader{buf: block}
+	return streamInfoFields{
+		minBlockSize: r.readBits(16),
+		maxBlockSize: r.readBits(16),
+		minFrameSize: r.readBits(24),
+		maxFrameSize: r.readBits(24),
+		sampleRate:   r.readBits(20),
+		channels:     r.readBits(3) + 1,
+		bitDepth:     r.readBits(5) + 1,
+		totalSamples: r.readBits(36),
+		md5sum:       block[18:34],
+	}
+}
+
+func TestWriteStreamInfoFields(t *testing.T) {
+	audioFormat, err := audio.NewWAVFormat("../sample.wav")
+	if err != nil {
+		t.Fatalf("failed to create audio format: %v", err)
+	}
+	defer audioFormat.Close()
+
+	output := &memWriteSeeker{}
+	encoder := &Encoder{
+		output:       output,
+		input:        audioFormat,
+		minBlockSize: DefaultMinBlockSize,
+		maxBlockSize: DefaultMaxBlockSize,
+	}
+	if err := encoder.writeStreamInfo(); err != nil {
+		t.Fatalf("writeStreamInfo failed: %v", err)
+	}
+
+	data := output.data
+	if len(data) != 4+StreamInfoSize {
+		t.Fatalf("expected %d bytes, got %d", 4+StreamInfoSize, len(data))
+	}
+	if data[3] != StreamInfoSize {
+		t.Errorf("expected block length %d, got %d", StreamInfoSize, data[3])
+	}
+
+	info := decodeStreamInfo(data[4:])
+	tests := []struct {
+		name     string
+		got      uint64
+		expected uint64
+	}{
+		{"Min Block Size", info.minBlockSize, DefaultMinBlockSize},
+		{"Max Block Size", info.maxBlockSize, DefaultMaxBlockSize},
+		{"Sample Rate", info.sampleRate, 44100},
+		{"Channels", info.channels, 2},
+		{"Bit Depth", info.bitDepth, 16},
+		{"Total Samples", info.totalSamples, audioFormat.TotalSamples()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, tt.got)
+			}
+		})
+	}
+}
+
+func TestStreamInfoTotalSamplesAndMD5(t *testing.T) {
+	ascending := make([]byte, 16)
+	for i := range ascending {
+		ascending[i] = byte(i + 1)
+	}
+	allOnes := bytes.Repeat([]byte{0xFF}, 16)
+
+	tests := []struct {
+		name         string
+		totalSamples uint64
+		md5sum       []byte
+	}{
+		{name: "Unknown length", totalSamples: 0, md5sum: allOnes},
+		{name: "One second", totalSamples: 44100, md5sum: ascending},
+		{name: "Beyond 32 bits", totalSamples: 1<<32 + 5, md5sum: ascending},
+		{name: "Largest count", totalSamples: maxTotalSamples, md5sum: make([]byte, 16)},
+		{name: "Largest count and MD5", totalSamples: maxTotalSamples, md5sum: allOnes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder := &Encoder{
+				input:        newTestFormat(44100, 2, 16),
+				minBlockSize: DefaultMinBlockSize,
+				maxBlockSize: DefaultMaxBlockSize,
+				md5sum:       tt.md5sum,
+			}
+			block, err := encoder.streamInfoBlock(tt.totalSamples)
+			if err != nil {
+				t.Fatalf("streamInfoBlock failed: %v", err)
+			}
+			body := block[4:]
+			if len(body) != StreamInfoSize {
+				t.Fatalf("expected a %d-byte body, got %d", StreamInfoSize, len(body))
+			}
+
+			// Total samples are the low 4 bits of byte 13 and bytes 14-17,
+			// sharing byte 13 with the bit depth
+			total := uint64(body[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(body[14:18]))
+			if total != tt.totalSamples {
+				t.Errorf("expected %d total samples in bytes 13-17, got %d", tt.totalSamples, total)
+			}
+			if !bytes.Equal(body[18:34], tt.md5sum) {
+				t.Errorf("expected MD5 %x in bytes 18-33, got %x", tt.md5sum, body[18:34])
+			}
+
+			info, err := parseStreamInfo(body)
+			if err != nil {
+				t.Fatalf("parseStreamInfo failed: %v", err)
+			}
+			if info.SampleRate != 44100 || info.Channels != 2 || info.BitDepth != 16 || info.TotalSamples != tt.totalSamples {
+				t.Errorf("expected 44100 Hz, 2 channels, 16 bits and %d samples, got %+v", tt.totalSamples, info)
+			}
+			if !bytes.Equal(info.MD5[:], tt.md5sum) {
+				t.Errorf("expected decoded MD5 %x, got %x", tt.md5sum, info.MD5)
+			}
+		})
+	}
+}
+
+func TestStreamInfoMD5(t *testing.T) {
+	tests := []struct {
+		name     string
+		seekable bool
+	}{
+		{name: "Seek-back path", seekable: true},
+		{name: "Streaming fallback", seekable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audioFormat, err := audio.NewWAVFormat("../sample.wav")
+			if err != nil {
+				t.Fatalf("failed to create audio format: %v", err)
+			}
+			defer audioFormat.Close()
+
+			var output io.WriteCloser
+			var readBack func() []byte
+			if tt.seekable {
+				mem := &memWriteSeeker{}
+				output = mem
+				readBack = func() []byte { return mem.data }
+			} else {
+				r, w, err := os.Pipe()
+				if err != nil {
+					t.Fatalf("failed to create pipe: %v", err)
+				}
+				defer r.Close()
+				output = w
+				done := make(chan []byte)
+				go func() {
+					data, _ := io.ReadAll(r)
+					done <- data
+				}()
+				readBack = func() []byte { return <-done }
+			}
+
+			encoder := &Encoder{
+				output:       output,
+				input:        audioFormat,
+				minBlockSize: DefaultMinBlockSize,
+				maxBlockSize: DefaultMaxBlockSize,
+			}
+			encoder.beginStream()
+			if tt.seekable == (encoder.pending != nil) {
+				t.Fatalf("expected buffering to be %v", !tt.seekable)
+			}
+			if err := encoder.writeStreamHeader(); err != nil {
+				t.Fatalf("writeStreamHeader failed: %v", err)
+			}
+
+			// Encode a few blocks, hashing them independently as 16-bit little-endian
+			expected := md5.New()
+			buffer := make([]int32, encoder.minBlockSize*audioFormat.Channels())
+			for i := 0; i < 4; i++ {
+				n, err := audioFormat.ReadSamples(buffer)
+				if err != nil {
+					t.Fatalf("ReadSamples failed: %v", err)
+				}
+				encoder.updateMD5(buffer[:n])
+				if err := encoder.encodeBlock(buffer[:n]); err != nil {
+					t.Fatalf("encodeBlock failed: %v", err)
+				}
+				for _, sample := range buffer[:n] {
+					binary.Write(expected, binary.LittleEndian, int16(sample))
+				}
+			}
+
+			encoder.md5sum = encoder.md5hash.Sum(nil)
+			if err := encoder.patchMetadata(encoder.input.TotalSamples()); err != nil {
+				t.Fatalf("patchMetadata failed: %v", err)
+			}
+			output.Close()
+
+			data := readBack()
+			if !bytes.HasPrefix(data, []byte(FlacMarker)) {
+				t.Fatalf("output does not start with %q", FlacMarker)
+			}
+			info := decodeStreamInfo(data[8 : 8+StreamInfoSize])
+			if want := expected.Sum(nil); !bytes.Equal(info.md5sum, want) {
+				t.Errorf("expected MD5 %x, got %x", want, info.md5sum)
+			}
+			if info.sampleRate != 44100 {
+				t.Errorf("expected sample rate 44100 after patching, got %d", info.sampleRate)
+			}
+		})
+	}
+}
+
+func TestStreamInfoFrameSizes(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []int32
+		frames  int
+	}{
+		{
+			name:    "Multi-block sine",
+			samples: sineSamples(3*DefaultMinBlockSize+500, 2),
+			frames:  4,
+		},
+		{
+			name:    "Single block",
+			samples: sineSamples(1000, 2),
+			frames:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodeToBuffer(t, newTestFormat(44100, 2, 16, tt.samples...))
+			info := decodeStreamInfo(data[8 : 8+StreamInfoSize])
+
+			if info.maxFrameSize == 0 || info.minFrameSize == 0 {
+				t.Fatalf("expected non-zero frame sizes, got min %d, max %d", info.minFrameSize, info.maxFrameSize)
+			}
+			if info.maxFrameSize < info.minFrameSize {
+				t.Errorf("expected max frame size %d >= min %d", info.maxFrameSize, info.minFrameSize)
+			}
+
+			// The frames fill the rest of the stream, each between min and max
+			frameBytes := uint64(len(data) - (8 + StreamInfoSize))
+			frames := uint64(tt.frames)
+			if frameBytes < info.minFrameSize*frames || frameBytes > info.maxFrameSize*frames {
+				t.Errorf("%d bytes of %d frames do not fit min %d, max %d", frameBytes, frames, info.minFrameSize, info.maxFrameSize)
+			}
+			if tt.frames == 1 && (info.minFrameSize != frameBytes || info.maxFrameSize != frameBytes) {
+				t.Errorf("expected min and max frame size %d, got %d and %d", frameBytes, info.minFrameSize, info.maxFrameSize)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	audioFormat, err := audio.NewWAVFormat("../sample.wav")
+	if err != nil {
+		t.Fatalf("failed to create audio format: %v", err)
+	}
+	defer audioFormat.Close()
+
+	outputPath := t.TempDir() + "/test_output.flac"
+	encoder, err := NewEncoder(audioFormat, outputPath)
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	if err := encoder.Encode(); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte(FlacMarker)) {
+		t.Fatalf("output does not start with %q", FlacMarker)
+	}
+	if data[4]&LastMetadataBlock == 0 {
+		t.Errorf("expected STREAMINFO to be flagged as the last metadata block")
+	}
+	info := decodeStreamInfo(data[8 : 8+StreamInfoSize])
+	if bytes.Equal(info.md5sum, make([]byte, 16)) {
+		t.Errorf("expected a non-zero MD5 signature")
+	}
+}
+
+func TestCompressionLevels(t *testing.T) {
+	if testing.Short() {
+		t.Skip("encodes sample.wav at several levels")
+	}
+
+	input, err := audio.NewWAVFormat("../sample.wav")
+	if err != nil {
+		t.Fatalf("failed to create audio format: %v", err)
+	}
+	defer input.Close()
+	original := readAllSamples(t, input)
+
+	sizes := make(map[int]int)
+	for _, level := range []int{0, 8} {
+		input.Seek(0)
+		encoded := encodeToBuffer(t, input, WithCompressionLevel(level))
+		sizes[level] = len(encoded)
+
+		decoder, err := NewDecoder(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("level %d: NewDecoder failed: %v", level, err)
+		}
+		if !reflect.DeepEqual(readAllSamples(t, decoder), original) {
+			t.Errorf("level %d: decoded samples differ from the input", level)
+		}
+	}
+
+	if sizes[8] >= sizes[0] {
+		t.Errorf("expected level 8 to be smaller than level 0, got %d and %d bytes", sizes[8], sizes[0])
+	}
+}
+
+// memWriteSeeker is an in-memory io.WriteSeeker, standing in for an output file.
+type memWriteSeeker struct {
+	data []byte
+	pos  int64
+}
+
+func (m *memWriteSeeker) Write(p []byte) (int, error) {
+	if end := m.pos + int64(len(p)); end > int64(len(m.data)) {
+		m.data = append(m.data, make([]byte, end-int64(len(m.data)))...)
+	}
+	n := copy(m.data[m.pos:], p)
+	m.pos += int64(n)
+	return n, nil
+}
+
+func (m *memWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += m.pos
+	case io.SeekEnd:
+		offset += int64(len(m.data))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative seek offset")
+	}
+	m.pos = offset
+	return offset, nil
+}
+
+func (m *memWriteSeeker) Close() error { return nil }
+
+// newTestFormat returns an in-memory audio.Format over interleaved samples.
+func newTestFormat(sampleRate, channels, bitDepth int, samples ...int32) *audio.MemoryFormat {
+	f, err := audio.NewMemoryFormat(samples, sampleRate, channels, bitDepth)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+func TestEncodeRawPCM(t *testing.T) {
+	samples := sineSamples(5000, 2)
+	var raw bytes.Buffer
+	binary.Write(&raw, binary.LittleEndian, toInt16(samples))
+	rawPath := t.TempDir() + "/input.pcm"
+	if err := os.WriteFile(rawPath, raw.Bytes(), 0o644); err != nil {
+		t.Fatalf("failed to write raw input: %v", err)
+	}
+
+	audioFormat, err := audio.NewRawPCMFormat(rawPath, 44100, 2, 16, true)
+	if err != nil {
+		t.Fatalf("failed to create audio format: %v", err)
+	}
+	defer audioFormat.Close()
+
+	var out bytes.Buffer
+	encoder, err := NewEncoderWriter(audioFormat, &out)
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	if err := encoder.Encode(); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	info := decodeStreamInfo(out.Bytes()[8 : 8+StreamInfoSize])
+	frameSize := uint64(2 * 16 / 8)
+	if want := uint64(raw.Len()) / frameSize; info.totalSamples != want {
+		t.Errorf("expected %d total samples, got %d", want, info.totalSamples)
+	}
+	if !bytes.Equal(info.md5sum, md5Of16Bit(samples)) {
+		t.Errorf("expected MD5 %x, got %x", md5Of16Bit(samples), info.md5sum)
+	}
+}
+
+func TestEncodePlanar(t *testing.T) {
+	for _, channels := range []int{1, 2, 5} {
+		samples := sineSamples(2*DefaultMinBlockSize+300, channels)
+		interleaved := encodeToBuffer(t, newTestFormat(44100, channels, 16, samples...))
+
+		planar, err := audio.NewPlanarFormat(deinterleave(samples, channels), 44100, 16)
+		if err != nil {
+			t.Fatalf("NewPlanarFormat failed: %v", err)
+		}
+		if got := encodeToBuffer(t, planar); !bytes.Equal(got, interleaved) {
+			t.Errorf("%d channels: planar input encoded to %d bytes differing from the %d of interleaved input", channels, len(got), len(interleaved))
+		}
+	}
+}
+
+// toInt16 narrows samples to 16-bit values.
+func toInt16(samples []int32) []int16 {
+	out := make([]int16, len(samples))
+	for i, sample := range samples {
+		out[i] = int16(sample)
+	}
+	return out
+}
+
+func TestDeinterleave(t *testing.T) {
+	tests := []struct {
+		name     string
+		samples  []int32
+		channels int
+		expected [][]int32
+	}{
+		{
+			name:     "Mono",
+			samples:  []int32{1, 2, 3},
+			channels: 1,
+			expected: [][]int32{{1, 2, 3}},
+		},
+		{
+			name:     "Stereo L/R pattern",
+			samples:  []int32{1, -1, 2, -2, 3, -3, 4, -4},
+			channels: 2,
+			expected: [][]int32{{1, 2, 3, 4}, {-1, -2, -3, -4}},
+		},
+		{
+			name:     "Final short block with a partial inter-channel sample",
+			samples:  []int32{1, -1, 2, -2, 3},
+			channels: 2,
+			expected: [][]int32{{1, 2}, {-1, -2}},
+		},
+		{
+			name:     "Three channels",
+			samples:  []int32{1, 10, 100, 2, 20, 200},
+			channels: 3,
+			expected: [][]int32{{1, 2}, {10, 20}, {100, 200}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := deinterleave(tt.samples, tt.channels)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// sineSamples returns count interleaved samples per channel of a 16-bit sine
+// wave, each channel at a different frequency.
+func sineSamples(count, channels int) []int32 {
+	samples := make([]int32, count*channels)
+	for i := 0; i < count; i++ {
+		for ch := 0; ch < channels; ch++ {
+			freq := 440.0 * float64(ch+1)
+			samples[i*channels+ch] = int32(12000 * math.Sin(2*math.Pi*freq*float64(i)/44100))
+		}
+	}
+	return samples
+}
+
+// md5Of16Bit returns the MD5 of samples laid out as 16-bit little-endian values.
+func md5Of16Bit(samples []int32) []byte {
+	h := md5.New()
+	for _, sample := range samples {
+		binary.Write(h, binary.LittleEndian, int16(sample))
+	}
+	return h.Sum(nil)
+}
+
+func TestNewEncoderWriter(t *testing.T) {
+	samples := sineSamples(10000, 2)
+
+	tests := []struct {
+		name   string
+		output func() (io.Writer, func() []byte)
+	}{
+		{
+			name: "In-memory buffer",
+			output: func() (io.Writer, func() []byte) {
+				var buf bytes.Buffer
+				return &buf, buf.Bytes
+			},
+		},
+		{
+			name: "HTTP response",
+			output: func() (io.Writer, func() []byte) {
+				rec := httptest.NewRecorder()
+				return rec, rec.Body.Bytes
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, written := tt.output()
+			input := newTestFormat(44100, 2, 16, samples...)
+
+			encoder, err := NewEncoderWriter(input, w)
+			if err != nil {
+				t.Fatalf("NewEncoderWriter failed: %v", err)
+			}
+			if err := encoder.Encode(); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			if err := encoder.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			data := written()
+			if !bytes.HasPrefix(data, []byte(FlacMarker)) {
+				t.Fatalf("output does not start with %q", FlacMarker)
+			}
+			info := decodeStreamInfo(data[8 : 8+StreamInfoSize])
+			if want := md5Of16Bit(samples); !bytes.Equal(info.md5sum, want) {
+				t.Errorf("expected MD5 %x, got %x", want, info.md5sum)
+			}
+			if info.totalSamples != 10000 {
+				t.Errorf("expected 10000 total samples, got %d", info.totalSamples)
+			}
+		})
+	}
+}
+
+func TestEncodeToPipe(t *testing.T) {
+	samples := sineSamples(5*DefaultMinBlockSize+123, 2)
+	opts := []Option{WithSeekTable(0.1)}
+	seekable := &memWriteSeeker{}
+	encoder, err := NewEncoderWriter(newTestFormat(44100, 2, 16, samples...), seekable, opts...)
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	if err := encoder.Encode(); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	// A pipe is a plain io.Writer, so the stream is buffered and only written
+	// once STREAMINFO and the seek table are final
+	r, w := io.Pipe()
+	go func() {
+		encoder, err := NewEncoderWriter(newTestFormat(44100, 2, 16, samples...), w, opts...)
+		if err == nil {
+			err = encoder.Encode()
+		}
+		w.CloseWithError(err)
+	}()
+	piped, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("encoding to a pipe failed: %v", err)
+	}
+
+	if !bytes.Equal(piped, seekable.data) {
+		t.Errorf("expected the %d bytes written to a seekable output, got %d differing bytes", len(seekable.data), len(piped))
+	}
+	info := decodeStreamInfo(piped[8 : 8+StreamInfoSize])
+	if want := md5Of16Bit(samples); !bytes.Equal(info.md5sum, want) {
+		t.Errorf("expected MD5 %x, got %x", want, info.md5sum)
+	}
+	if info.minFrameSize == 0 || info.maxFrameSize == 0 {
+		t.Errorf("expected the frame sizes in STREAMINFO, got %d and %d", info.minFrameSize, info.maxFrameSize)
+	}
+
+	// readAllSamples fails on an MD5 mismatch
+	decoder, err := NewDecoder(bytes.NewReader(piped))
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if decoded := readAllSamples(t, decoder); !reflect.DeepEqual(decoded, samples) {
+		t.Errorf("decoded samples differ from the input")
+	}
+}
+
+// chunkedFormat returns at most chunk values per read, like a pipe or a
+// network stream.
+type chunkedFormat struct {
+	*audio.MemoryFormat
+	chunk int
+}
+
+func (f *chunkedFormat) ReadSamples(buffer []int32) (int, error) {
+	if len(buffer) > f.chunk {
+		buffer = buffer[:f.chunk]
+	}
+	return f.MemoryFormat.ReadSamples(buffer)
+}
+
+func TestEncodeShortFinalBlock(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    int // inter-channel samples
+		chunk    int // values returned per read, 0 for no limit
+		expected []int
+	}{
+		{
+			name:     "Short final block",
+			count:    3*DefaultMinBlockSize + 1000,
+			expected: []int{4096, 4096, 4096, 1000},
+		},
+		{
+			name:     "Short reads still give full blocks",
+			count:    3*DefaultMinBlockSize + 1000,
+			chunk:    1500,
+			expected: []int{4096, 4096, 4096, 1000},
+		},
+		{
+			name:     "Final block of one sample",
+			count:    DefaultMinBlockSize + 1,
+			chunk:    4095,
+			expected: []int{4096, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := sineSamples(tt.count, 2)
+			var input audio.Format = newTestFormat(44100, 2, 16, samples...)
+			if tt.chunk > 0 {
+				input = &chunkedFormat{MemoryFormat: input.(*audio.MemoryFormat), chunk: tt.chunk}
+			}
+			data := encodeToBuffer(t, input)
+
+			decoder, err := NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			info := decoder.StreamInfo()
+			if info.MinBlockSize != DefaultMinBlockSize || info.MaxBlockSize != DefaultMaxBlockSize {
+				t.Errorf("expected block sizes %d-%d in STREAMINFO, got %d-%d", DefaultMinBlockSize, DefaultMaxBlockSize, info.MinBlockSize, info.MaxBlockSize)
+			}
+			if info.TotalSamples != uint64(tt.count) {
+				t.Errorf("expected %d total samples, got %d", tt.count, info.TotalSamples)
+			}
+
+			var blockSizes []int
+			var decoded []int32
+			for {
+				_, frame, err := decoder.decodeFrame()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("decodeFrame failed: %v", err)
+				}
+				blockSizes = append(blockSizes, len(frame)/2)
+				decoded = append(decoded, frame...)
+			}
+			if !reflect.DeepEqual(blockSizes, tt.expected) {
+				t.Errorf("expected block sizes %v, got %v", tt.expected, blockSizes)
+			}
+			if !reflect.DeepEqual(decoded, samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+}
+
+// eofFormat returns at most chunk values per read and returns io.EOF along
+// with the read that reaches the end of its samples, rather than on the read
+// after it.
+type eofFormat struct {
+	*audio.MemoryFormat
+	chunk int
+	read  int
+}
+
+func (f *eofFormat) ReadSamples(buffer []int32) (int, error) {
+	if len(buffer) > f.chunk {
+		buffer = buffer[:f.chunk]
+	}
+	n, err := f.MemoryFormat.ReadSamples(buffer)
+	f.read += n
+	if err == nil && f.read == int(f.TotalSamples())*f.Channels() {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func TestEncodeFinalSamplesWithEOF(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    int // inter-channel samples
+		chunk    int // values returned per read
+		expected []int
+	}{
+		{
+			name:     "Short final block in one read",
+			count:    DefaultMinBlockSize + 1000,
+			chunk:    2 * DefaultMinBlockSize,
+			expected: []int{4096, 1000},
+		},
+		{
+			name:     "Short final block after short reads",
+			count:    DefaultMinBlockSize + 1000,
+			chunk:    1500,
+			expected: []int{4096, 1000},
+		},
+		{
+			name:     "Full final block",
+			count:    2 * DefaultMinBlockSize,
+			chunk:    2 * DefaultMinBlockSize,
+			expected: []int{4096, 4096},
+		},
+		{
+			name:     "Only block",
+			count:    100,
+			chunk:    2 * DefaultMinBlockSize,
+			expected: []int{100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := sineSamples(tt.count, 2)
+			data := encodeToBuffer(t, &eofFormat{MemoryFormat: newTestFormat(44100, 2, 16, samples...), chunk: tt.chunk})
+
+			decoder, err := NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if total := decoder.StreamInfo().TotalSamples; total != uint64(tt.count) {
+				t.Errorf("expected %d total samples, got %d", tt.count, total)
+			}
+			var blockSizes []int
+			var decoded []int32
+			for {
+				_, frame, err := decoder.decodeFrame()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("decodeFrame failed: %v", err)
+				}
+				blockSizes = append(blockSizes, len(frame)/2)
+				decoded = append(decoded, frame...)
+			}
+			if !reflect.DeepEqual(blockSizes, tt.expected) {
+				t.Errorf("expected block sizes %v, got %v", tt.expected, blockSizes)
+			}
+			if !reflect.DeepEqual(decoded, samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+}
+
+func TestEncodeChannelCounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels int
+	}{
+		{name: "Mono", channels: 1},
+		{name: "Stereo", channels: 2},
+		{name: "3 channels", channels: 3},
+		{name: "5.1 surround", channels: 6},
+		{name: "8 channels", channels: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := sineSamples(2*DefaultMinBlockSize+100, tt.channels)
+			data := encodeToBuffer(t, newTestFormat(44100, tt.channels, 16, samples...))
+
+			decoder, err := NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if decoder.Channels() != tt.channels {
+				t.Fatalf("expected %d channels in STREAMINFO, got %d", tt.channels, decoder.Channels())
+			}
+
+			// Read each frame by hand: the header's assignment says how many
+			// subframes follow, and the footer must come right after them.
+			frames := 0
+			for {
+				info, err := decoder.readFrameHeader()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("frame %d: readFrameHeader failed: %v", frames, err)
+				}
+				if tt.channels != 2 && info.assignment != tt.channels-1 {
+					t.Errorf("frame %d: expected channel assignment %d, got %d", frames, tt.channels-1, info.assignment)
+				}
+				if info.channels != tt.channels {
+					t.Fatalf("frame %d: expected %d subframes, got %d", frames, tt.channels, info.channels)
+				}
+				for ch := 0; ch < info.channels; ch++ {
+					bitDepth := info.bitDepth
+					if sideChannel(info.assignment) == ch {
+						bitDepth++
+					}
+					if _, err := readSubframe(decoder.br, info.blockSize, bitDepth); err != nil {
+						t.Fatalf("frame %d: reading subframe %d failed: %v", frames, ch, err)
+					}
+				}
+				decoder.br.Align()
+				if _, err := decoder.br.ReadBits(16); err != nil {
+					t.Fatalf("frame %d: reading footer failed: %v", frames, err)
+				}
+				frames++
+			}
+			if frames != 3 {
+				t.Errorf("expected 3 frames, got %d", frames)
+			}
+
+			decoder, err = NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if !reflect.DeepEqual(readAllSamples(t, decoder), samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+}
+
+func TestEncodeFiveChannelReads(t *testing.T) {
+	samples := sineSamples(2*DefaultMinBlockSize+333, 5)
+	for _, chunk := range []int{3, 7, 4096, 5 * DefaultMinBlockSize} {
+		// Reads of a size that is not a multiple of 5 split inter-channel samples
+		input := &chunkedFormat{MemoryFormat: newTestFormat(44100, 5, 16, samples...), chunk: chunk}
+		data := encodeToBuffer(t, input)
+
+		decoder, err := NewDecoder(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("reading %d values at a time: NewDecoder failed: %v", chunk, err)
+		}
+		if !reflect.DeepEqual(readAllSamples(t, decoder), samples) {
+			t.Errorf("reading %d values at a time: decoded samples differ from the input", chunk)
+		}
+	}
+
+	// An input ending after 3 of the 5 channels of its last sample
+	values := sineSamples(5*1000+3, 1)
+	input := &claimedFormat{MemoryFormat: newTestFormat(44100, 1, 16, values...), sampleRate: 44100, channels: 5, bitDepth: 16}
+	encoder, err := NewEncoderWriter(input, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	err = encoder.Encode()
+	var encErr *EncodingError
+	if !errors.As(err, &encErr) || encErr.Stage != StageRead || !errors.Is(err, ErrPartialSample) {
+		t.Errorf("expected an ErrPartialSample at the read stage, got %v", err)
+	}
+}
+
+func TestWithVariableBlockSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		variable bool
+	}{
+		{name: "Frame numbers", variable: false},
+		{name: "Sample numbers", variable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := sineSamples(3*DefaultMinBlockSize+100, 2)
+			data := encodeToBuffer(t, newTestFormat(44100, 2, 16, samples...), WithVariableBlockSize(tt.variable))
+
+			decoder, err := NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			var frame, sample uint64
+			for {
+				info, err := decoder.readFrameHeader()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("frame %d: readFrameHeader failed: %v", frame, err)
+				}
+				expected := frame
+				if tt.variable {
+					expected = sample
+				}
+				if info.variable != tt.variable || info.number != expected {
+					t.Errorf("frame %d: expected variable %v and number %d, got %v and %d", frame, tt.variable, expected, info.variable, info.number)
+				}
+				for ch := 0; ch < info.channels; ch++ {
+					bitDepth := info.bitDepth
+					if sideChannel(info.assignment) == ch {
+						bitDepth++
+					}
+					if _, err := readSubframe(decoder.br, info.blockSize, bitDepth); err != nil {
+						t.Fatalf("frame %d: reading subframe %d failed: %v", frame, ch, err)
+					}
+				}
+				decoder.br.Align()
+				if _, err := decoder.br.ReadBits(16); err != nil {
+					t.Fatalf("frame %d: reading footer failed: %v", frame, err)
+				}
+				frame++
+				sample += uint64(info.blockSize)
+			}
+			if sample != uint64(len(samples)/2) {
+				t.Errorf("expected %d samples in frames, got %d", len(samples)/2, sample)
+			}
+
+			decoder, err = NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if !reflect.DeepEqual(readAllSamples(t, decoder), samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+}
+
+// streamingFormat does not know its length up front, like a live or piped
+// source, and reports 0 total samples.
+type streamingFormat struct {
+	*audio.MemoryFormat
+}
+
+func (f *streamingFormat) TotalSamples() uint64 { return 0 }
+
+func TestEncodeUnknownLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		seekable bool
+	}{
+		{name: "Seekable output", seekable: true},
+		{name: "Plain writer", seekable: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := sineSamples(3*DefaultMinBlockSize+500, 2)
+			input := &streamingFormat{newTestFormat(44100, 2, 16, samples...)}
+
+			var w io.Writer = &bytes.Buffer{}
+			if tt.seekable {
+				w = &memWriteSeeker{}
+			}
+			encoder, err := NewEncoderWriter(input, w, WithSeekTable(1))
+			if err != nil {
+				t.Fatalf("NewEncoderWriter failed: %v", err)
+			}
+			if err := encoder.Encode(); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+
+			var data []byte
+			if tt.seekable {
+				data = w.(*memWriteSeeker).data
+			} else {
+				data = w.(*bytes.Buffer).Bytes()
+			}
+
+			// Without a known length there is no seek table either, so
+			// STREAMINFO is the only metadata block.
+			bodies, _ := metadataBlockBodies(t, data)
+			if _, ok := bodies[metadataSeekTable]; ok {
+				t.Errorf("expected no SEEKTABLE for an unknown length")
+			}
+			info := decodeStreamInfo(bodies[metadataStreamInfo])
+			if info.totalSamples != 0 {
+				t.Errorf("expected 0 total samples, got %d", info.totalSamples)
+			}
+			if want := md5Of16Bit(samples); !bytes.Equal(info.md5sum, want) {
+				t.Errorf("expected MD5 %x, got %x", want, info.md5sum)
+			}
+
+			// The frames alone carry the stream and decode to the whole input.
+			decoder, err := NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if decoder.TotalSamples() != 0 {
+				t.Errorf("expected the decoder to report 0 total samples, got %d", decoder.TotalSamples())
+			}
+			if !reflect.DeepEqual(readAllSamples(t, decoder), samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+}
+
+func TestEncoderReset(t *testing.T) {
+	first := sineSamples(3*DefaultMinBlockSize+700, 2)
+	second := sineSamples(DefaultMinBlockSize+123, 1)
+	for i := range second {
+		second[i] /= 3
+	}
+	opts := []Option{WithSeekTable(0.05), WithCompressionLevel(3)}
+
+	outputPath := t.TempDir() + "/first.flac"
+	encoder, err := NewEncoder(newTestFormat(44100, 2, 16, first...), outputPath, opts...)
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	if err := encoder.Encode(); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := encoder.Reset(newTestFormat(48000, 1, 16, second...), &out); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if err := encoder.Encode(); err != nil {
+		t.Fatalf("Encode after Reset failed: %v", err)
+	}
+
+	// The file from before the Reset must be closed and complete.
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read first output: %v", err)
+	}
+	bodies, _ := metadataBlockBodies(t, data)
+	info := decodeStreamInfo(bodies[metadataStreamInfo])
+	if info.totalSamples != uint64(len(first)/2) || info.channels != 2 {
+		t.Errorf("first stream: expected %d samples over 2 channels, got %d over %d", len(first)/2, info.totalSamples, info.channels)
+	}
+	if want := md5Of16Bit(first); !bytes.Equal(info.md5sum, want) {
+		t.Errorf("first stream: expected MD5 %x, got %x", want, info.md5sum)
+	}
+
+	// Nothing of the first stream may leak into the second: it must match
+	// what a fresh Encoder writes byte for byte.
+	var fresh bytes.Buffer
+	freshEncoder, err := NewEncoderWriter(newTestFormat(48000, 1, 16, second...), &fresh, opts...)
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	if err := freshEncoder.Encode(); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), fresh.Bytes()) {
+		bodies, _ := metadataBlockBodies(t, out.Bytes())
+		t.Errorf("stream after Reset differs from a fresh encoder's, STREAMINFO %+v", decodeStreamInfo(bodies[metadataStreamInfo]))
+	}
+}
+
+func TestEncoderResetUnsupportedFormat(t *testing.T) {
+	encoder, err := NewEncoderWriter(newTestFormat(44100, 2, 16), &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	input := &claimedFormat{MemoryFormat: newTestFormat(44100, 1, 16), sampleRate: 44100, channels: 9, bitDepth: 16}
+	if err := encoder.Reset(input, &bytes.Buffer{}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+}
+
+func TestEncodeFullScale32Bit(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels int
+		sample   func(i int) int32
+	}{
+		{
+			name:     "Alternating full scale",
+			channels: 1,
+			sample: func(i int) int32 {
+				if i%2 == 0 {
+					return math.MaxInt32
+				}
+				return math.MinInt32
+			},
+		},
+		{
+			name:     "Full-scale sine",
+			channels: 2,
+			sample: func(i int) int32 {
+				return int32(math.Round(math.Sin(float64(i/2)*0.05) * math.MaxInt32))
+			},
+		},
+		{
+			name:     "Full-scale noise",
+			channels: 2,
+			sample:   func(i int) int32 { return int32(uint32(i) * 2654435761) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := make([]int32, 2*DefaultMinBlockSize*tt.channels)
+			for i := range samples {
+				samples[i] = tt.sample(i)
+			}
+			data := encodeToBuffer(t, newTestFormat(96000, tt.channels, 32, samples...), WithVerify(true))
+
+			decoder, err := NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if !reflect.DeepEqual(readAllSamples(t, decoder), samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+}
+
+func TestWithExactLength(t *testing.T) {
+	tests := []struct {
+		name        string
+		count       int // inter-channel samples the input holds
+		claimed     uint64
+		opts        []Option
+		expectedErr bool
+	}{
+		{name: "Single sample", count: 1, claimed: 1},
+		{name: "One short of a block", count: DefaultMinBlockSize - 1, claimed: DefaultMinBlockSize - 1},
+		{name: "One past a block", count: DefaultMinBlockSize + 1, claimed: DefaultMinBlockSize + 1},
+		{name: "Odd length at level 0", count: 5*1152 + 17, claimed: 5*1152 + 17, opts: []Option{WithCompressionLevel(0)}},
+		{name: "Input shorter than claimed", count: 5000, claimed: 6000, expectedErr: true},
+		{name: "Input longer than claimed", count: 5000, claimed: 4000, expectedErr: true},
+		{name: "Unknown length", count: 5000, claimed: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := sineSamples(tt.count, 2)
+			input := &oversizedFormat{MemoryFormat: newTestFormat(44100, 2, 16, samples...), total: tt.claimed}
+
+			var out bytes.Buffer
+			encoder, err := NewEncoderWriter(input, &out, append(tt.opts, WithExactLength(true))...)
+			if err != nil {
+				t.Fatalf("NewEncoderWriter failed: %v", err)
+			}
+			err = encoder.Encode()
+			if tt.expectedErr {
+				if !errors.Is(err, ErrLengthMismatch) {
+					t.Fatalf("expected ErrLengthMismatch, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+
+			decoder, err := NewDecoder(bytes.NewReader(out.Bytes()))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			decoded := readAllSamples(t, decoder)
+			if got := uint64(len(decoded) / 2); tt.claimed > 0 && got != tt.claimed {
+				t.Errorf("expected exactly %d decoded samples, got %d", tt.claimed, got)
+			}
+			if !reflect.DeepEqual(decoded, samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+}
+
+// cancellingFormat cancels a context once it has served a number of reads.
+type cancellingFormat struct {
+	*audio.MemoryFormat
+	reads  int
+	cancel context.CancelFunc
+}
+
+func (f *cancellingFormat) ReadSamples(buffer []int32) (int, error) {
+	f.reads--
+	if f.reads == 0 {
+		f.cancel()
+	}
+	return f.MemoryFormat.ReadSamples(buffer)
+}
+
+func TestEncodeContextCancel(t *testing.T) {
+	tests := []struct {
+		name   string
+		toFile bool
+	}{
+		{name: "File created by NewEncoder is removed", toFile: true},
+		{name: "Buffered writer receives nothing", toFile: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			input := &cancellingFormat{
+				MemoryFormat: newTestFormat(44100, 2, 16, sineSamples(5*DefaultMinBlockSize, 2)...),
+				reads:        1,
+				cancel:       cancel,
+			}
+
+			var encoder *Encoder
+			var buf bytes.Buffer
+			outputPath := t.TempDir() + "/cancelled.flac"
+			var err error
+			if tt.toFile {
+				encoder, err = NewEncoder(input, outputPath)
+			} else {
+				encoder, err = NewEncoderWriter(input, &buf)
+			}
+			if err != nil {
+				t.Fatalf("failed to create encoder: %v", err)
+			}
+			defer encoder.Close()
+
+			err = encoder.EncodeContext(ctx)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got %v", err)
+			}
+			if remaining := len(readAllSamples(t, input.MemoryFormat)); remaining != 4*DefaultMinBlockSize*2 {
+				t.Errorf("expected encoding to stop after one block, %d samples left unread", remaining)
+			}
+
+			if tt.toFile {
+				if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+					t.Errorf("expected output file to be removed, stat returned %v", err)
+				}
+			} else if buf.Len() != 0 {
+				t.Errorf("expected no output, got %d bytes", buf.Len())
+			}
+		})
+	}
+}
+
+func TestFlush(t *testing.T) {
+	samples := sineSamples(5*DefaultMinBlockSize+100, 2)
+	outputPath := t.TempDir() + "/flushed.flac"
+	var encoder *Encoder
+	var snapshot []byte
+	progress := func(done, total uint64) {
+		if done != 2*DefaultMinBlockSize {
+			return
+		}
+		if err := encoder.Flush(); err != nil {
+			t.Fatalf("Flush failed: %v", err)
+		}
+		// What a crash right after the flush would leave behind
+		var err error
+		if snapshot, err = os.ReadFile(outputPath); err != nil {
+			t.Fatalf("failed to read output: %v", err)
+		}
+	}
+
+	encoder, err := NewEncoder(newTestFormat(44100, 2, 16, samples...), outputPath, WithProgress(progress))
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer encoder.Close()
+	if err := encoder.Encode(); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatalf("NewDecoder failed on the flushed stream: %v", err)
+	}
+	if got := decoder.TotalSamples(); got != 2*DefaultMinBlockSize {
+		t.Errorf("expected %d total samples after the flush, got %d", 2*DefaultMinBlockSize, got)
+	}
+	if info := decoder.StreamInfo(); info.MinFrameSize == 0 || info.MD5 == [16]byte{} {
+		t.Errorf("expected frame sizes and an MD5 signature after the flush, got %+v", info)
+	}
+	// readAllSamples fails on an MD5 mismatch
+	if decoded := readAllSamples(t, decoder); !reflect.DeepEqual(decoded, samples[:2*DefaultMinBlockSize*2]) {
+		t.Errorf("flushed stream does not decode to the samples encoded before the flush")
+	}
+
+	// The finished file covers the whole input
+	encoded, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if decoder, err = NewDecoder(bytes.NewReader(encoded)); err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if decoded := readAllSamples(t, decoder); !reflect.DeepEqual(decoded, samples) {
+		t.Errorf("finished stream does not decode to the input")
+	}
+}
+
+func TestFlushBufferedOutput(t *testing.T) {
+	var buf bytes.Buffer
+	var encoder *Encoder
+	var flushErr error
+	progress := func(done, total uint64) {
+		flushErr = encoder.Flush()
+	}
+	encoder, err := NewEncoderWriter(newTestFormat(44100, 1, 16, sineSamples(1000, 1)...), &buf, WithProgress(progress))
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	if err := encoder.Flush(); err == nil {
+		t.Errorf("expected an error flushing before encoding")
+	}
+	if err := encoder.Encode(); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if flushErr == nil {
+		t.Errorf("expected an error flushing a buffered stream")
+	}
+}
+
+func TestWithFlushInterval(t *testing.T) {
+	samples := sineSamples(3*DefaultMinBlockSize, 2)
+	outputPath := t.TempDir() + "/flushed.flac"
+	encoder, err := NewEncoder(newTestFormat(44100, 2, 16, samples...), outputPath, WithFlushInterval(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	if err := encoder.Encode(); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	encoder.Close()
+
+	encoded, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	decoder, err := NewDecoder(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if got := decoder.TotalSamples(); got != 3*DefaultMinBlockSize {
+		t.Errorf("expected %d total samples, got %d", 3*DefaultMinBlockSize, got)
+	}
+	if decoded := readAllSamples(t, decoder); !reflect.DeepEqual(decoded, samples) {
+		t.Errorf("decoded samples differ from the input")
+	}
+
+	if _, err := NewEncoderWriter(newTestFormat(44100, 2, 16), io.Discard, WithFlushInterval(-time.Second)); err == nil {
+		t.Errorf("expected an error for a negative flush interval")
+	}
+}
@@ -1,7 +1,42 @@
 package flac
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
+// ErrUnsupportedFormat is returned, wrapped, when the input has a channel
+// count, bit depth, sample rate or length STREAMINFO cannot describe.
+var ErrUnsupportedFormat = errors.New("unsupported input format")
+
+// ErrLengthMismatch is returned, wrapped, by an encoder created
+// WithExactLength(true) when the input yields a different number of samples
+// than its TotalSamples reports.
+var ErrLengthMismatch = errors.New("input length does not match its total samples")
+
+// ErrPartialSample is returned, wrapped, when the input ends partway through
+// an inter-channel sample, holding values for only some of its channels.
+var ErrPartialSample = errors.New("input ended partway through an inter-channel sample")
+
+// ErrFrameCRCMismatch is returned, wrapped, by a Decoder reading a frame whose
+// CRC-16 footer does not match its contents.
+var ErrFrameCRCMismatch = errors.New("frame CRC-16 mismatch")
+
+// ErrMD5Mismatch is returned, wrapped, by a Decoder reaching the end of a
+// stream whose decoded audio does not match the MD5 signature in STREAMINFO.
+var ErrMD5Mismatch = errors.New("MD5 signature mismatch")
+
+// Stages of the encoding pipeline reported by EncodingError.
+const (
+	StageStreamHeader = "stream_header" // writing the marker and metadata blocks
+	StageRead         = "read"          // reading samples from the input
+	StageBlock        = "block"         // encoding and writing a frame
+	StageFlush        = "flush"         // patching the metadata blocks at a periodic Flush
+	StageStreamFooter = "stream_footer" // patching the metadata blocks with final values
+)
+
+// EncodingError is returned by Encode, wrapping the error that stopped it
+// along with the stage of the pipeline it happened in.
 type EncodingError struct {
 	Stage string
 	Err   error
@@ -11,6 +46,27 @@ func (e *EncodingError) Error() string {
 	return fmt.Sprintf("encoding error at %s: %v", e.Stage, e.Err)
 }
 
+// Unwrap returns the underlying error, so errors.Is and errors.As see through
+// an EncodingError.
+func (e *EncodingError) Unwrap() error {
+	return e.Err
+}
+
 func NewEncodingError(stage string, err error) *EncodingError {
 	return &EncodingError{Stage: stage, Err: err}
 }
+
+// VerifyError reports a frame that did not decode back to the samples it was
+// encoded from, found by an encoder created WithVerify.
+type VerifyError struct {
+	Frame    uint64 // frame number
+	Channel  int
+	Sample   int // index within the block of the first differing sample
+	Expected int32
+	Got      int32
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("verify failed in frame %d, channel %d, sample %d: expected %d, decoded %d",
+		e.Frame, e.Channel, e.Sample, e.Expected, e.Got)
+}
@@ -0,0 +1,92 @@
+package flac
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/nooooaaaaah/soundcompression/audio"
+)
+
+// errInjected is the failure injected by failingWriteSeeker and failingFormat.
+var errInjected = errors.New("injected failure")
+
+// failingWriteSeeker is a seekable output that fails every write reaching
+// beyond limit bytes.
+type failingWriteSeeker struct {
+	memWriteSeeker
+	limit int64
+}
+
+func (f *failingWriteSeeker) Write(p []byte) (int, error) {
+	if f.pos+int64(len(p)) > f.limit {
+		return 0, errInjected
+	}
+	return f.memWriteSeeker.Write(p)
+}
+
+// failingFormat fails every read after the first.
+type failingFormat struct {
+	*audio.MemoryFormat
+	reads int
+}
+
+func (f *failingFormat) ReadSamples(buffer []int32) (int, error) {
+	f.reads++
+	if f.reads > 1 {
+		return 0, errInjected
+	}
+	return f.MemoryFormat.ReadSamples(buffer)
+}
+
+func TestEncodingErrorStage(t *testing.T) {
+	samples := sineSamples(3*DefaultMinBlockSize, 2)
+	headerSize := int64(len(FlacMarker) + 4 + StreamInfoSize)
+
+	tests := []struct {
+		name          string
+		input         audio.Format
+		output        io.Writer
+		expectedStage string
+	}{
+		{
+			name:          "Header write fails",
+			input:         newTestFormat(44100, 2, 16, samples...),
+			output:        &failingWriteSeeker{limit: 0},
+			expectedStage: StageStreamHeader,
+		},
+		{
+			name:          "Frame write fails",
+			input:         newTestFormat(44100, 2, 16, samples...),
+			output:        &failingWriteSeeker{limit: headerSize + 10},
+			expectedStage: StageBlock,
+		},
+		{
+			name:          "Input read fails",
+			input:         &failingFormat{MemoryFormat: newTestFormat(44100, 2, 16, samples...)},
+			output:        &memWriteSeeker{},
+			expectedStage: StageRead,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder, err := NewEncoderWriter(tt.input, tt.output)
+			if err != nil {
+				t.Fatalf("NewEncoderWriter failed: %v", err)
+			}
+
+			err = encoder.Encode()
+			var encErr *EncodingError
+			if !errors.As(err, &encErr) {
+				t.Fatalf("expected an EncodingError, got %v", err)
+			}
+			if encErr.Stage != tt.expectedStage {
+				t.Errorf("expected stage %q, got %q", tt.expectedStage, encErr.Stage)
+			}
+			if !errors.Is(err, errInjected) {
+				t.Errorf("expected the injected error to be wrapped, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package flac
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nooooaaaaah/soundcompression/audio"
+)
+
+// EncodeFile encodes the WAV file at inputPath to a FLAC file at outputPath.
+// It opens the input, encodes it with the given options and closes both files,
+// returning every error met on the way, including one from closing either file
+// after a successful encode. A failed encode removes the partial output.
+func EncodeFile(inputPath, outputPath string, opts ...Option) (err error) {
+	input, err := audio.NewWAVFormat(inputPath)
+	if err != nil {
+		return fmt.Errorf("error opening input: %w", err)
+	}
+	defer func() {
+		if closeErr := input.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("error closing input: %w", closeErr))
+		}
+	}()
+
+	encoder, err := NewEncoder(input, outputPath, opts...)
+	if err != nil {
+		return fmt.Errorf("error creating encoder: %w", err)
+	}
+	err = encoder.Encode()
+	if closeErr := encoder.Close(); closeErr != nil {
+		err = errors.Join(err, fmt.Errorf("error closing output: %w", closeErr))
+	}
+	if err != nil {
+		os.Remove(outputPath)
+	}
+	return err
+}
+
+// Transcode encodes the WAV stream in src to a FLAC stream written to dst,
+// such as an HTTP response, in a single call. The input is recognised by its
+// RIFF header, RF64 and BW64 included, and read as it is encoded. dst is
+// written as NewEncoderWriter writes: a dst that cannot seek receives the
+// stream once it is complete. Neither src nor dst is closed.
+func Transcode(dst io.Writer, src io.ReadSeeker, opts ...Option) error {
+	input, err := audio.NewWAVFormatReader(src)
+	if err != nil {
+		return fmt.Errorf("error reading input: %w", err)
+	}
+
+	encoder, err := NewEncoderWriter(input, dst, opts...)
+	if err != nil {
+		return fmt.Errorf("error creating encoder: %w", err)
+	}
+	return encoder.Encode()
+}
+
+// DecodeFile decodes the FLAC file at inputPath to a WAV file at outputPath,
+// written by an audio.WAVWriter in the sample rate, channels and bit depth
+// STREAMINFO gives, with the canonical 44-byte header of a PCM WAV file. The
+// header's sizes count the samples actually decoded, whatever STREAMINFO
+// claims. A failed decode removes the partial output.
+func DecodeFile(inputPath, outputPath string) (err error) {
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("error opening input: %w", err)
+	}
+	defer input.Close()
+
+	decoder, err := NewDecoder(input)
+	if err != nil {
+		return fmt.Errorf("error reading input: %w", err)
+	}
+
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer func() {
+		if closeErr := output.Close(); closeErr != nil {
+			err = errors.Join(err, fmt.Errorf("error closing output: %w", closeErr))
+		}
+		if err != nil {
+			os.Remove(outputPath)
+		}
+	}()
+
+	wav, err := audio.NewWAVWriter(output, decoder.SampleRate(), decoder.Channels(), decoder.BitDepth())
+	if err != nil {
+		return err
+	}
+	buffer := make([]int32, 4096*decoder.Channels())
+	for {
+		n, err := decoder.ReadSamples(buffer)
+		if werr := wav.WriteSamples(buffer[:n]); werr != nil {
+			return werr
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error decoding input: %w", err)
+		}
+	}
+	return wav.Close()
+}
@@ -0,0 +1,180 @@
+package flac
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nooooaaaaah/soundcompression/audio"
+)
+
+func TestEncodeFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		inputPath   string
+		opts        []Option
+		expectedErr bool
+	}{
+		{name: "Sample WAV", inputPath: "../sample.wav"},
+		{name: "Sample WAV at level 0", inputPath: "../sample.wav", opts: []Option{WithCompressionLevel(0)}},
+		{name: "Missing input", inputPath: "missing.wav", expectedErr: true},
+		{name: "Invalid option", inputPath: "../sample.wav", opts: []Option{WithBlockSize(8)}, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "out.flac")
+			err := EncodeFile(tt.inputPath, outputPath, tt.opts...)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				if _, statErr := os.Stat(outputPath); !os.IsNotExist(statErr) {
+					t.Errorf("expected no output file, got %v", statErr)
+				}
+				return
+			}
+
+			data, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			if !bytes.HasPrefix(data, []byte(FlacMarker)) {
+				t.Errorf("output does not start with %q", FlacMarker)
+			}
+		})
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	wav, err := os.ReadFile("../sample.wav")
+	if err != nil {
+		t.Fatalf("failed to read sample: %v", err)
+	}
+	input, err := audio.NewWAVFormatReader(bytes.NewReader(wav))
+	if err != nil {
+		t.Fatalf("NewWAVFormatReader failed: %v", err)
+	}
+	original := readAllSamples(t, input)
+
+	var out bytes.Buffer
+	if err := Transcode(&out, bytes.NewReader(wav), WithCompressionLevel(3)); err != nil {
+		t.Fatalf("Transcode failed: %v", err)
+	}
+	decoder, err := NewDecoder(&out)
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if decoder.SampleRate() != input.SampleRate() || decoder.Channels() != input.Channels() || decoder.BitDepth() != input.BitDepth() {
+		t.Errorf("expected %d Hz, %d channels, %d bits, got %+v", input.SampleRate(), input.Channels(), input.BitDepth(), decoder.StreamInfo())
+	}
+	if decoded := readAllSamples(t, decoder); !reflect.DeepEqual(decoded, original) {
+		t.Errorf("decoded samples differ from the input")
+	}
+
+	if err := Transcode(&bytes.Buffer{}, bytes.NewReader([]byte("not a WAV file"))); err == nil {
+		t.Errorf("expected an error for input that is not a WAV file")
+	}
+}
+
+func TestDecodeFile(t *testing.T) {
+	dir := t.TempDir()
+	flacPath, wavPath := filepath.Join(dir, "sample.flac"), filepath.Join(dir, "sample.wav")
+	if err := EncodeFile("../sample.wav", flacPath); err != nil {
+		t.Fatalf("EncodeFile failed: %v", err)
+	}
+	if err := DecodeFile(flacPath, wavPath); err != nil {
+		t.Fatalf("DecodeFile failed: %v", err)
+	}
+
+	original, err := audio.NewWAVFormat("../sample.wav")
+	if err != nil {
+		t.Fatalf("NewWAVFormat failed: %v", err)
+	}
+	defer original.Close()
+	decoded, err := audio.NewWAVFormat(wavPath)
+	if err != nil {
+		t.Fatalf("NewWAVFormat failed on the decoded file: %v", err)
+	}
+	defer decoded.Close()
+
+	if decoded.SampleRate() != original.SampleRate() || decoded.Channels() != original.Channels() ||
+		decoded.BitDepth() != original.BitDepth() || decoded.TotalSamples() != original.TotalSamples() {
+		t.Errorf("expected %d Hz, %d channels, %d bits and %d samples, got %d Hz, %d channels, %d bits and %d samples",
+			original.SampleRate(), original.Channels(), original.BitDepth(), original.TotalSamples(),
+			decoded.SampleRate(), decoded.Channels(), decoded.BitDepth(), decoded.TotalSamples())
+	}
+	if !reflect.DeepEqual(readAllSamples(t, decoded), readAllSamples(t, original)) {
+		t.Errorf("decoded samples differ from the original")
+	}
+	info, err := os.Stat(wavPath)
+	if err != nil {
+		t.Fatalf("failed to stat the decoded file: %v", err)
+	}
+	if want := audio.WAVHeaderSize + int64(decoded.Subchunk2Size); info.Size() != want {
+		t.Errorf("expected a %d-byte header and %d bytes of data, got a %d-byte file", audio.WAVHeaderSize, decoded.Subchunk2Size, info.Size())
+	}
+
+	if err := DecodeFile("missing.flac", filepath.Join(dir, "missing.wav")); err == nil {
+		t.Errorf("expected an error for a missing input")
+	}
+	if err := DecodeFile("../sample.wav", filepath.Join(dir, "not-flac.wav")); err == nil {
+		t.Errorf("expected an error for input that is not FLAC")
+	}
+}
+
+func TestDecodeFileLayouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels int
+		bitDepth int
+		samples  []int32
+		unknown  bool // whether STREAMINFO leaves the total samples unknown
+	}{
+		{name: "8-bit mono with an odd data size", channels: 1, bitDepth: 8, samples: []int32{-128, -1, 0, 1, 127}},
+		{name: "20-bit stereo", channels: 2, bitDepth: 20, samples: []int32{-524288, 524287, 1, -1, 0, 12345}},
+		{name: "24-bit stereo", channels: 2, bitDepth: 24, samples: sineSamples(5000, 2)},
+		{name: "Unknown length", channels: 2, bitDepth: 16, samples: sineSamples(5000, 2), unknown: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			flacPath, wavPath := filepath.Join(dir, "in.flac"), filepath.Join(dir, "out.wav")
+			var input audio.Format = newTestFormat(44100, tt.channels, tt.bitDepth, tt.samples...)
+			if tt.unknown {
+				input = &streamingFormat{MemoryFormat: input.(*audio.MemoryFormat)}
+			}
+			encoder, err := NewEncoder(input, flacPath)
+			if err != nil {
+				t.Fatalf("NewEncoder failed: %v", err)
+			}
+			if err := encoder.Encode(); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			if err := encoder.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			if err := DecodeFile(flacPath, wavPath); err != nil {
+				t.Fatalf("DecodeFile failed: %v", err)
+			}
+			decoded, err := audio.NewWAVFormat(wavPath)
+			if err != nil {
+				t.Fatalf("NewWAVFormat failed on the decoded file: %v", err)
+			}
+			defer decoded.Close()
+			if want := uint64(len(tt.samples) / tt.channels); decoded.TotalSamples() != want {
+				t.Errorf("expected %d total samples, got %d", want, decoded.TotalSamples())
+			}
+			if decoded.BitDepth() != tt.bitDepth {
+				t.Errorf("expected %d bits, got %d", tt.bitDepth, decoded.BitDepth())
+			}
+			if got := readAllSamples(t, decoded); !reflect.DeepEqual(got, tt.samples) {
+				t.Errorf("expected samples %v, got %v", tt.samples, got)
+			}
+		})
+	}
+}
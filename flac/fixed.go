@@ -0,0 +1,91 @@
+package flac
+
+// MaxFixedOrder is the highest order of the fixed polynomial predictors.
+const MaxFixedOrder = 4
+
+// fixedResidual returns the residual of the fixed predictor of the given order.
+// The first order samples are warm-up samples and have no residual, so the
+// result holds len(samples)-order values. Predictions are computed in 64 bits,
+// as full-scale 32-bit samples overflow an int32 difference; it returns false
+// if a residual falls outside the signed 32-bit range the format allows.
+func fixedResidual(samples []int32, order int) ([]int32, bool) {
+	if len(samples) <= order {
+		return nil, false
+	}
+	residual := make([]int32, len(samples)-order)
+	for i := order; i < len(samples); i++ {
+		s := samples
+		var r int64
+		switch order {
+		case 0:
+			r = int64(s[i])
+		case 1:
+			r = int64(s[i]) - int64(s[i-1])
+		case 2:
+			r = int64(s[i]) - 2*int64(s[i-1]) + int64(s[i-2])
+		case 3:
+			r = int64(s[i]) - 3*int64(s[i-1]) + 3*int64(s[i-2]) - int64(s[i-3])
+		case 4:
+			r = int64(s[i]) - 4*int64(s[i-1]) + 6*int64(s[i-2]) - 4*int64(s[i-3]) + int64(s[i-4])
+		}
+		if r > maxResidualMagnitude || r < -maxResidualMagnitude {
+			return nil, false
+		}
+		residual[i-order] = int32(r)
+	}
+	return residual, true
+}
+
+// bestFixedOrder tries every fixed predictor and returns the order with the
+// smallest sum of absolute residuals, along with that residual. The sums only
+// cover samples from MaxFixedOrder on, so every order is compared over the same
+// span; ties go to the lower order. Orders whose residual does not fit 32 bits
+// are skipped, and the residual is nil if none fits.
+func bestFixedOrder(samples []int32) (int, []int32) {
+	bestOrder := 0
+	var best []int32
+	var bestSum uint64
+	for order := 0; order <= MaxFixedOrder; order++ {
+		residual, ok := fixedResidual(samples, order)
+		if !ok {
+			continue
+		}
+		var sum uint64
+		start := MaxFixedOrder - order
+		if start > len(residual) {
+			start = len(residual)
+		}
+		for _, r := range residual[start:] {
+			if r < 0 {
+				sum += uint64(-int64(r))
+			} else {
+				sum += uint64(r)
+			}
+		}
+		if best == nil || sum < bestSum {
+			bestOrder, best, bestSum = order, residual, sum
+		}
+	}
+	return bestOrder, best
+}
+
+// restoreFixed reverses fixedResidual in place: samples holds order warm-up
+// samples followed by the residual, and ends up holding the decoded samples.
+// Like fixedResidual it predicts in 64 bits, so 32-bit streams decode exactly.
+func restoreFixed(samples []int32, order int) {
+	for i := order; i < len(samples); i++ {
+		s := samples
+		var prediction int64
+		switch order {
+		case 1:
+			prediction = int64(s[i-1])
+		case 2:
+			prediction = 2*int64(s[i-1]) - int64(s[i-2])
+		case 3:
+			prediction = 3*int64(s[i-1]) - 3*int64(s[i-2]) + int64(s[i-3])
+		case 4:
+			prediction = 4*int64(s[i-1]) - 6*int64(s[i-2]) + 4*int64(s[i-3]) - int64(s[i-4])
+		}
+		s[i] = int32(int64(s[i]) + prediction)
+	}
+}
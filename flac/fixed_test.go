@@ -0,0 +1,85 @@
+package flac
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestFixedResidual(t *testing.T) {
+	samples := []int32{1, 4, 9, 16, 25, 36}
+
+	tests := []struct {
+		name     string
+		order    int
+		expected []int32
+	}{
+		{"Order 0", 0, []int32{1, 4, 9, 16, 25, 36}},
+		{"Order 1", 1, []int32{3, 5, 7, 9, 11}},
+		{"Order 2", 2, []int32{2, 2, 2, 2}},
+		{"Order 3", 3, []int32{0, 0, 0}},
+		{"Order 4", 4, []int32{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := fixedResidual(samples, tt.order)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFixedResidualFullScale32Bit(t *testing.T) {
+	// Alternating full-scale samples: every difference overflows an int32.
+	samples := []int32{math.MaxInt32, math.MinInt32 + 1, math.MaxInt32, math.MinInt32 + 1, math.MaxInt32, math.MinInt32 + 1}
+
+	if residual, ok := fixedResidual(samples, 0); !ok || !reflect.DeepEqual(residual, samples) {
+		t.Errorf("expected order 0 to return the samples, got %v (ok=%v)", residual, ok)
+	}
+	for order := 1; order <= MaxFixedOrder; order++ {
+		if _, ok := fixedResidual(samples, order); ok {
+			t.Errorf("expected order %d to overflow 32 bits", order)
+		}
+	}
+	if order, _ := bestFixedOrder(samples); order != 0 {
+		t.Errorf("expected the only order that fits, 0, got %d", order)
+	}
+
+	// A slow full-scale ramp fits order 1 even though the samples span the
+	// whole range, and must come back exactly.
+	ramp := []int32{math.MinInt32, math.MinInt32 + 1<<30, -1, 1 << 30, math.MaxInt32}
+	residual, ok := fixedResidual(ramp, 1)
+	if !ok {
+		t.Fatalf("expected order 1 to fit")
+	}
+	restored := append([]int32{ramp[0]}, residual...)
+	restoreFixed(restored, 1)
+	if !reflect.DeepEqual(restored, ramp) {
+		t.Errorf("expected %v restored, got %v", ramp, restored)
+	}
+}
+
+func TestPredictSamples(t *testing.T) {
+	ramp := make([]int32, 4096)
+	for i := range ramp {
+		ramp[i] = int32(3*i - 2000)
+	}
+
+	encoder := &Encoder{logging: false}
+	p := encoder.predictSamples(subframe{samples: ramp, bitDepth: 16})
+	order, residual := p.order, p.residual
+	if p.subframeType != subframeTypeFixed|2 {
+		t.Errorf("expected order 2 for a linear ramp, got %d", order)
+	}
+	if len(residual) != len(ramp)-order {
+		t.Fatalf("expected %d residuals, got %d", len(ramp)-order, len(residual))
+	}
+	residual2, _ := fixedResidual(ramp, 2)
+	for i, r := range residual2 {
+		if r != 0 {
+			t.Fatalf("expected zero residual under order 2, got %d at %d", r, i)
+		}
+	}
+}
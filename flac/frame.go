@@ -0,0 +1,313 @@
+package flac
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+const (
+	frameSyncCode     = 0x3FFE // 14-bit sync code starting every frame
+	frameSyncCodeBits = 14
+
+	// Blocking strategies, signalled by the bit following the sync code.
+	fixedBlockSize    = 0 // frames carry a frame number
+	variableBlockSize = 1 // frames carry the number of their first sample
+
+	// Block size codes for an uncommon block size minus one stored as 8 or 16
+	// bits at the end of the header.
+	blockSize8Bit  = 0x6
+	blockSize16Bit = 0x7
+
+	// Sample rate codes telling the decoder to use the STREAMINFO sample rate,
+	// or to read it from the end of the header in kHz, Hz or tens of Hz.
+	sampleRateFromStreamInfo = 0x0
+	sampleRate8BitKHz        = 0xC
+	sampleRate16BitHz        = 0xD
+	sampleRate16BitTensHz    = 0xE
+
+	// maxCodedNumber is the largest value the extended UTF-8 coding holds (36 bits).
+	maxCodedNumber = 1<<36 - 1
+
+	// maxFrameNumber is the largest frame number a fixed blocking strategy
+	// stream may code (31 bits).
+	maxFrameNumber = 1<<31 - 1
+)
+
+// sampleSizeCodes maps a bit depth to its 3-bit frame header code. Depths not
+// listed are coded as 0, meaning "get from STREAMINFO".
+var sampleSizeCodes = map[int]uint64{
+	8:  0b001,
+	12: 0b010,
+	16: 0b100,
+	20: 0b101,
+	24: 0b110,
+	32: 0b111,
+}
+
+// encodeUTF8Number codes a frame or sample number with FLAC's extension of
+// UTF-8, which carries values of up to 36 bits in at most 7 bytes.
+func encodeUTF8Number(n uint64) ([]byte, error) {
+	if n > maxCodedNumber {
+		return nil, fmt.Errorf("coded number %d exceeds 36 bits", n)
+	}
+	if n < 0x80 {
+		return []byte{byte(n)}, nil
+	}
+
+	var length int
+	switch {
+	case n < 0x800:
+		length = 2
+	case n < 0x10000:
+		length = 3
+	case n < 0x200000:
+		length = 4
+	case n < 0x4000000:
+		length = 5
+	case n < 0x80000000:
+		length = 6
+	default:
+		length = 7
+	}
+
+	// Continuation bytes carry 6 bits each, the leading byte a run of length
+	// one bits followed by the remaining high bits.
+	coded := make([]byte, length)
+	for i := length - 1; i > 0; i-- {
+		coded[i] = 0x80 | byte(n&0x3F)
+		n >>= 6
+	}
+	coded[0] = byte(0xFF<<(8-length)) | byte(n)
+	return coded, nil
+}
+
+// blockSizeCode returns the 4-bit frame header code for a block size. Sizes
+// without a code of their own, such as a short final block, are stored minus
+// one at the end of the header, in explicitBits bits holding explicitValue.
+func blockSizeCode(n int) (code uint8, explicitBits int, explicitValue uint16) {
+	for c, size := range blockSizes {
+		if size != 0 && size == n {
+			return uint8(c), 0, 0
+		}
+	}
+	if n <= 1<<8 {
+		return blockSize8Bit, 8, uint16(n - 1)
+	}
+	return blockSize16Bit, 16, uint16(n - 1)
+}
+
+// sampleRateCode returns the 4-bit frame header code for a sample rate. Rates
+// without a code of their own are stored at the end of the header, in
+// explicitBits bits holding explicitValue, in the coarsest unit that is exact.
+// Rates none of those can hold are left to STREAMINFO.
+func sampleRateCode(rate int) (code uint8, explicitBits int, explicitValue uint32) {
+	for c, r := range sampleRates {
+		if r != 0 && r == rate {
+			return uint8(c), 0, 0
+		}
+	}
+	switch {
+	case rate%1000 == 0 && rate/1000 <= 0xFF:
+		return sampleRate8BitKHz, 8, uint32(rate / 1000)
+	case rate <= 0xFFFF:
+		return sampleRate16BitHz, 16, uint32(rate)
+	case rate%10 == 0 && rate/10 <= 0xFFFF:
+		return sampleRate16BitTensHz, 16, uint32(rate / 10)
+	}
+	return sampleRateFromStreamInfo, 0, 0
+}
+
+// frameHeader returns the header of a frame holding blockSize samples per
+// channel, ending with its CRC-8. The frame is numbered by its position in the
+// stream, or by its first sample with a variable blocking strategy.
+func (e *Encoder) frameHeader(blockSize int, channelAssignment int) ([]byte, error) {
+	strategy, n := uint64(fixedBlockSize), e.frameNumber
+	if e.variableBlockSize {
+		strategy, n = variableBlockSize, e.samplesDone
+	} else if n > maxFrameNumber {
+		return nil, fmt.Errorf("frame number %d exceeds 31 bits", n)
+	}
+	number, err := encodeUTF8Number(n)
+	if err != nil {
+		return nil, err
+	}
+
+	sizeCode, sizeBits, sizeValue := blockSizeCode(blockSize)
+	rateCode, rateBits, rateValue := sampleRateCode(e.input.SampleRate())
+
+	var header bytes.Buffer
+	bw := NewBitWriter(&header)
+	bw.WriteBits(frameSyncCode, frameSyncCodeBits)
+	bw.WriteBits(0, 1) // reserved
+	bw.WriteBits(strategy, 1)
+	bw.WriteBits(uint64(sizeCode), 4)
+	bw.WriteBits(uint64(rateCode), 4)
+	bw.WriteBits(uint64(channelAssignment), 4)
+	bw.WriteBits(sampleSizeCodes[e.input.BitDepth()], 3)
+	bw.WriteBits(0, 1) // reserved
+	for _, b := range number {
+		bw.WriteBits(uint64(b), 8)
+	}
+	bw.WriteBits(uint64(sizeValue), uint(sizeBits))
+	bw.WriteBits(uint64(rateValue), uint(rateBits))
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	header.WriteByte(crc8(header.Bytes()))
+	return header.Bytes(), nil
+}
+
+// Block sizes, sample rates and sample sizes a frame header can code directly,
+// indexed by their 4 or 3-bit code. Zero entries are read from elsewhere: the
+// end of the header, STREAMINFO, or are reserved.
+var (
+	blockSizes  = [16]int{0, 192, 576, 1152, 2304, 4608, 0, 0, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768}
+	sampleRates = [12]int{0, 88200, 176400, 192000, 8000, 16000, 22050, 24000, 32000, 44100, 48000, 96000}
+	sampleSizes = [8]int{0, 8, 12, 0, 16, 20, 24, 32}
+)
+
+// frameInfo holds the fields of a decoded frame header.
+type frameInfo struct {
+	blockSize  int
+	sampleRate int
+	assignment int
+	channels   int
+	bitDepth   int
+	variable   bool   // variable blocking strategy: number is a sample number
+	number     uint64 // frame number, or first sample number when variable
+}
+
+// decodeUTF8Number reads a frame or sample number coded by encodeUTF8Number.
+func decodeUTF8Number(br *BitReader) (uint64, error) {
+	first, err := br.ReadBits(8)
+	if err != nil {
+		return 0, err
+	}
+	length := bits.LeadingZeros8(^uint8(first))
+	switch {
+	case length == 0:
+		return first, nil
+	case length == 1 || length > 7:
+		return 0, fmt.Errorf("invalid coded number lead byte %#x", first)
+	}
+
+	n := first & (0xFF >> (length + 1))
+	for i := 1; i < length; i++ {
+		b, err := br.ReadBits(8)
+		if err != nil {
+			return 0, err
+		}
+		if b&0xC0 != 0x80 {
+			return 0, fmt.Errorf("invalid coded number continuation byte %#x", b)
+		}
+		n = n<<6 | b&0x3F
+	}
+	return n, nil
+}
+
+// readFrameHeader reads a frame header up to and including its CRC-8, filling
+// in fields coded as "from STREAMINFO". It returns io.EOF if the stream ends
+// cleanly before the frame.
+func (d *Decoder) readFrameHeader() (_ frameInfo, err error) {
+	d.br.resetRecord()
+	sync, err := d.br.ReadBits(frameSyncCodeBits)
+	if err != nil {
+		return frameInfo{}, err
+	}
+	if sync != frameSyncCode {
+		return frameInfo{}, fmt.Errorf("invalid frame sync code %#x", sync)
+	}
+
+	// Past the sync code, the stream ending is an error
+	defer func() {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	var fields [6]uint64
+	for i, width := range []uint{1, 1, 4, 4, 4, 3} {
+		if fields[i], err = d.br.ReadBits(width); err != nil {
+			return frameInfo{}, err
+		}
+	}
+	if _, err := d.br.ReadBits(1); err != nil { // reserved
+		return frameInfo{}, err
+	}
+	blockingStrategy, blockSizeCode, sampleRateCode := fields[1], fields[2], fields[3]
+	assignment, sampleSizeCode := int(fields[4]), fields[5]
+
+	info := frameInfo{variable: blockingStrategy != fixedBlockSize, assignment: assignment}
+	if info.number, err = decodeUTF8Number(d.br); err != nil {
+		return frameInfo{}, err
+	}
+
+	switch blockSizeCode {
+	case 0:
+		return frameInfo{}, fmt.Errorf("reserved block size code")
+	case blockSize8Bit, blockSize16Bit:
+		width := uint(8)
+		if blockSizeCode == blockSize16Bit {
+			width = 16
+		}
+		n, err := d.br.ReadBits(width)
+		if err != nil {
+			return frameInfo{}, err
+		}
+		info.blockSize = int(n) + 1
+	default:
+		info.blockSize = blockSizes[blockSizeCode]
+	}
+
+	switch {
+	case sampleRateCode == sampleRateFromStreamInfo:
+		info.sampleRate = d.info.SampleRate
+	case sampleRateCode < uint64(len(sampleRates)):
+		info.sampleRate = sampleRates[sampleRateCode]
+	case sampleRateCode == 0xF:
+		return frameInfo{}, fmt.Errorf("invalid sample rate code")
+	default:
+		// 8-bit kHz, 16-bit Hz or 16-bit tens of Hz at the end of the header
+		width, scale := uint(16), 1
+		switch sampleRateCode {
+		case sampleRate8BitKHz:
+			width, scale = 8, 1000
+		case sampleRate16BitTensHz:
+			scale = 10
+		}
+		n, err := d.br.ReadBits(width)
+		if err != nil {
+			return frameInfo{}, err
+		}
+		info.sampleRate = int(n) * scale
+	}
+
+	switch {
+	case assignment < 8:
+		info.channels = assignment + 1
+	case assignment <= channelMidSide:
+		info.channels = 2
+	default:
+		return frameInfo{}, fmt.Errorf("reserved channel assignment %#x", assignment)
+	}
+
+	info.bitDepth = sampleSizes[sampleSizeCode]
+	if sampleSizeCode == 0 {
+		info.bitDepth = d.info.BitDepth
+	} else if info.bitDepth == 0 {
+		return frameInfo{}, fmt.Errorf("reserved sample size code")
+	}
+
+	// The CRC-8 covers everything before it
+	want := crc8(d.br.record)
+	got, err := d.br.ReadBits(8)
+	if err != nil {
+		return frameInfo{}, err
+	}
+	if byte(got) != want {
+		return frameInfo{}, fmt.Errorf("frame header CRC-8 mismatch: got %#02x, want %#02x", got, want)
+	}
+	return info, nil
+}
@@ -0,0 +1,189 @@
+package flac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeUTF8Number(t *testing.T) {
+	tests := []struct {
+		name        string
+		number      uint64
+		expected    []byte
+		expectedErr bool
+	}{
+		{name: "Zero", number: 0, expected: []byte{0x00}},
+		{name: "Largest 1-byte value", number: 0x7F, expected: []byte{0x7F}},
+		{name: "Smallest 2-byte value", number: 0x80, expected: []byte{0xC2, 0x80}},
+		{name: "Largest 2-byte value", number: 0x7FF, expected: []byte{0xDF, 0xBF}},
+		{name: "Smallest 3-byte value", number: 0x800, expected: []byte{0xE0, 0xA0, 0x80}},
+		{name: "Largest 6-byte value", number: 0x7FFFFFFF, expected: []byte{0xFD, 0xBF, 0xBF, 0xBF, 0xBF, 0xBF}},
+		{name: "Above 32 bits", number: 0x100000000, expected: []byte{0xFE, 0x84, 0x80, 0x80, 0x80, 0x80, 0x80}},
+		{name: "Largest 36-bit value", number: 0xFFFFFFFFF, expected: []byte{0xFE, 0xBF, 0xBF, 0xBF, 0xBF, 0xBF, 0xBF}},
+		{name: "Above 36 bits", number: 0x1000000000, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := encodeUTF8Number(tt.number)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if !bytes.Equal(got, tt.expected) {
+				t.Errorf("expected %x, got %x", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFrameHeader(t *testing.T) {
+	encoder := &Encoder{
+		input:       newTestFormat(44100, 2, 16),
+		frameNumber: 0x80,
+	}
+
+	header, err := encoder.frameHeader(4096, 1)
+	if err != nil {
+		t.Fatalf("frameHeader failed: %v", err)
+	}
+
+	expected := []byte{0xFF, 0xF8, 0xC9, 0x18, 0xC2, 0x80}
+	if !bytes.Equal(header[:len(header)-1], expected) {
+		t.Errorf("expected header %x, got %x", expected, header[:len(header)-1])
+	}
+	if crc := crc8(header); crc != 0 {
+		t.Errorf("expected the CRC-8 over the whole header to be 0, got %#x", crc)
+	}
+}
+
+func TestFrameHeaderNumbering(t *testing.T) {
+	tests := []struct {
+		name        string
+		variable    bool
+		frameNumber uint64
+		samplesDone uint64
+		expected    []byte // the byte holding the blocking strategy, then the coded number
+		expectedErr bool
+	}{
+		{name: "Fixed uses the frame number", frameNumber: 3, samplesDone: 3 * 4096, expected: []byte{0xF8, 0x03}},
+		{name: "Variable uses the sample number", variable: true, frameNumber: 3, samplesDone: 3 * 4096, expected: []byte{0xF9, 0xE3, 0x80, 0x80}},
+		{name: "Largest 31-bit frame number", frameNumber: maxFrameNumber, expected: []byte{0xF8, 0xFD, 0xBF, 0xBF, 0xBF, 0xBF, 0xBF}},
+		{name: "Frame number above 31 bits", frameNumber: maxFrameNumber + 1, expectedErr: true},
+		{name: "36-bit sample number", variable: true, frameNumber: maxFrameNumber + 1, samplesDone: maxCodedNumber, expected: []byte{0xF9, 0xFE, 0xBF, 0xBF, 0xBF, 0xBF, 0xBF, 0xBF}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder := &Encoder{
+				input:             newTestFormat(44100, 2, 16),
+				variableBlockSize: tt.variable,
+				frameNumber:       tt.frameNumber,
+				samplesDone:       tt.samplesDone,
+			}
+			header, err := encoder.frameHeader(4096, 1)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			// Skip the first sync byte and the block size, sample rate,
+			// channel and sample size byte pair
+			got := append([]byte{header[1]}, header[4:len(header)-1]...)
+			if !bytes.Equal(got, tt.expected) {
+				t.Errorf("expected %x, got %x", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSampleRateCode(t *testing.T) {
+	tests := []struct {
+		name          string
+		rate          int
+		expectedCode  uint8
+		expectedBits  int
+		expectedValue uint32
+	}{
+		{name: "44.1 kHz", rate: 44100, expectedCode: 0b1001},
+		{name: "48 kHz", rate: 48000, expectedCode: 0b1010},
+		{name: "192 kHz", rate: 192000, expectedCode: 0b0011},
+		{name: "8 kHz", rate: 8000, expectedCode: 0b0100},
+		{name: "Whole kHz in 8 bits", rate: 11000, expectedCode: sampleRate8BitKHz, expectedBits: 8, expectedValue: 11},
+		{name: "Odd rate in 16-bit Hz", rate: 37800, expectedCode: sampleRate16BitHz, expectedBits: 16, expectedValue: 37800},
+		{name: "Largest 16-bit Hz", rate: 65535, expectedCode: sampleRate16BitHz, expectedBits: 16, expectedValue: 65535},
+		{name: "High rate in tens of Hz", rate: 352800, expectedCode: sampleRate16BitTensHz, expectedBits: 16, expectedValue: 35280},
+		{name: "Unrepresentable rate", rate: 352801, expectedCode: sampleRateFromStreamInfo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, bits, value := sampleRateCode(tt.rate)
+			if code != tt.expectedCode || bits != tt.expectedBits || value != tt.expectedValue {
+				t.Fatalf("expected code %#x with %d bits of %d, got %#x with %d bits of %d",
+					tt.expectedCode, tt.expectedBits, tt.expectedValue, code, bits, value)
+			}
+
+			// The decoder must read the same rate back from the header.
+			encoder := &Encoder{input: newTestFormat(tt.rate, 2, 16)}
+			header, err := encoder.frameHeader(4096, 1)
+			if err != nil {
+				t.Fatalf("frameHeader failed: %v", err)
+			}
+			decoder := &Decoder{br: NewBitReader(bytes.NewReader(header)), info: StreamInfo{SampleRate: tt.rate}}
+			info, err := decoder.readFrameHeader()
+			if err != nil {
+				t.Fatalf("readFrameHeader failed: %v", err)
+			}
+			if info.sampleRate != tt.rate {
+				t.Errorf("expected sample rate %d from the header, got %d", tt.rate, info.sampleRate)
+			}
+		})
+	}
+}
+
+func TestBlockSizeCode(t *testing.T) {
+	tests := []struct {
+		name          string
+		size          int
+		expectedCode  uint8
+		expectedBits  int
+		expectedValue uint16
+	}{
+		{name: "4096", size: 4096, expectedCode: 0b1100},
+		{name: "192", size: 192, expectedCode: 0b0001},
+		{name: "576", size: 576, expectedCode: 0b0010},
+		{name: "4608", size: 4608, expectedCode: 0b0101},
+		{name: "256", size: 256, expectedCode: 0b1000},
+		{name: "Short block in 8 bits", size: 100, expectedCode: blockSize8Bit, expectedBits: 8, expectedValue: 99},
+		{name: "Single sample", size: 1, expectedCode: blockSize8Bit, expectedBits: 8},
+		{name: "Arbitrary 1000", size: 1000, expectedCode: blockSize16Bit, expectedBits: 16, expectedValue: 999},
+		{name: "Largest block", size: 65535, expectedCode: blockSize16Bit, expectedBits: 16, expectedValue: 65534},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, bits, value := blockSizeCode(tt.size)
+			if code != tt.expectedCode || bits != tt.expectedBits || value != tt.expectedValue {
+				t.Fatalf("expected code %#x with %d bits of %d, got %#x with %d bits of %d",
+					tt.expectedCode, tt.expectedBits, tt.expectedValue, code, bits, value)
+			}
+
+			// The decoder must read the same size back, with an explicit
+			// sample rate following the explicit block size.
+			encoder := &Encoder{input: newTestFormat(37800, 2, 16)}
+			header, err := encoder.frameHeader(tt.size, 1)
+			if err != nil {
+				t.Fatalf("frameHeader failed: %v", err)
+			}
+			decoder := &Decoder{br: NewBitReader(bytes.NewReader(header))}
+			info, err := decoder.readFrameHeader()
+			if err != nil {
+				t.Fatalf("readFrameHeader failed: %v", err)
+			}
+			if info.blockSize != tt.size || info.sampleRate != 37800 {
+				t.Errorf("expected %d samples at 37800 Hz from the header, got %d at %d", tt.size, info.blockSize, info.sampleRate)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package flac
+
+import "strconv"
+
+// Vorbis comments recording gapless playback information. Each holds a
+// decimal count of samples per channel: ENCODER_DELAY leading samples and
+// ENCODER_PADDING trailing samples that are not part of the audio and should
+// be discarded when playing tracks back to back.
+const (
+	GaplessDelayTag   = "ENCODER_DELAY"
+	GaplessPaddingTag = "ENCODER_PADDING"
+)
+
+// gaplessInfo is the delay and padding recorded by WithGaplessInfo.
+type gaplessInfo struct {
+	delay   uint64
+	padding uint64
+}
+
+// WithGaplessInfo records, as ENCODER_DELAY and ENCODER_PADDING Vorbis
+// comments, how many leading and trailing samples per channel of the input are
+// not part of the audio, such as the priming and padding samples of a lossy
+// source it was decoded from. The encoder itself adds none: the final block is
+// coded at its true length rather than padded, so the values are written as
+// given. They override tags of the same names set with WithTags.
+func WithGaplessInfo(delay, padding uint64) Option {
+	return func(e *Encoder) error {
+		e.gapless = &gaplessInfo{delay: delay, padding: padding}
+		return nil
+	}
+}
+
+// allTags returns the tags to write in the VORBIS_COMMENT block: those set
+// with WithTags plus any gapless playback information.
+func (e *Encoder) allTags() map[string]string {
+	if e.gapless == nil {
+		return e.tags
+	}
+	tags := make(map[string]string, len(e.tags)+2)
+	for name, value := range e.tags {
+		tags[name] = value
+	}
+	tags[GaplessDelayTag] = strconv.FormatUint(e.gapless.delay, 10)
+	tags[GaplessPaddingTag] = strconv.FormatUint(e.gapless.padding, 10)
+	return tags
+}
+
+// GaplessInfo returns the leading and trailing samples per channel that a
+// player should discard, as recorded by WithGaplessInfo. ok is false unless
+// the stream records both as valid counts.
+func (d *Decoder) GaplessInfo() (delay, padding uint64, ok bool) {
+	delay, delayErr := strconv.ParseUint(d.tags[GaplessDelayTag], 10, 64)
+	padding, paddingErr := strconv.ParseUint(d.tags[GaplessPaddingTag], 10, 64)
+	if delayErr != nil || paddingErr != nil {
+		return 0, 0, false
+	}
+	return delay, padding, true
+}
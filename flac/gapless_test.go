@@ -0,0 +1,76 @@
+package flac
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWithGaplessInfo(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            []Option
+		expectedOK      bool
+		expectedDelay   uint64
+		expectedPadding uint64
+		expectedTags    map[string]string
+	}{
+		{
+			name:       "No gapless info",
+			expectedOK: false,
+		},
+		{
+			name:            "Delay and padding",
+			opts:            []Option{WithGaplessInfo(576, 1234)},
+			expectedOK:      true,
+			expectedDelay:   576,
+			expectedPadding: 1234,
+			expectedTags:    map[string]string{GaplessDelayTag: "576", GaplessPaddingTag: "1234"},
+		},
+		{
+			name:         "Exact length input",
+			opts:         []Option{WithGaplessInfo(0, 0)},
+			expectedOK:   true,
+			expectedTags: map[string]string{GaplessDelayTag: "0", GaplessPaddingTag: "0"},
+		},
+		{
+			name:            "Alongside other tags, overriding a stale value",
+			opts:            []Option{WithTags(map[string]string{"TITLE": "Track", GaplessPaddingTag: "99"}), WithGaplessInfo(0, 7)},
+			expectedOK:      true,
+			expectedPadding: 7,
+			expectedTags:    map[string]string{"TITLE": "Track", GaplessDelayTag: "0", GaplessPaddingTag: "7"},
+		},
+		{
+			name:       "Malformed tag",
+			opts:       []Option{WithTags(map[string]string{GaplessDelayTag: "soon", GaplessPaddingTag: "0"})},
+			expectedOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := sineSamples(3000, 2)
+			data := encodeToBuffer(t, newTestFormat(44100, 2, 16, samples...), tt.opts...)
+
+			decoder, err := NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			delay, padding, ok := decoder.GaplessInfo()
+			if ok != tt.expectedOK || delay != tt.expectedDelay || padding != tt.expectedPadding {
+				t.Errorf("expected delay %d, padding %d, ok %v, got %d, %d, %v",
+					tt.expectedDelay, tt.expectedPadding, tt.expectedOK, delay, padding, ok)
+			}
+			for name, value := range tt.expectedTags {
+				if got := decoder.Tags()[name]; got != value {
+					t.Errorf("expected tag %s=%q, got %q", name, value, got)
+				}
+			}
+
+			// The encoder pads nothing of its own, so exactly the input decodes.
+			decoded := readAllSamples(t, decoder)
+			if len(decoded) != len(samples) {
+				t.Errorf("expected %d decoded samples, got %d", len(samples), len(decoded))
+			}
+		})
+	}
+}
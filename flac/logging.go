@@ -0,0 +1,25 @@
+package flac
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// discardHandler drops every record; it backs the Encoder's logger until one
+// is set.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// discardLogger is the Encoder's default logger, which logs nothing.
+var discardLogger = slog.New(discardHandler{})
+
+// verboseLogger returns the logger WithLogging(true) installs: every message,
+// down to the per-block debug messages, as text on standard error.
+func verboseLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
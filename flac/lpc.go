@@ -0,0 +1,262 @@
+package flac
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// MaxLPCOrder is the highest LPC order a subframe can code.
+	MaxLPCOrder = 32
+
+	// DefaultMaxLPCOrder is the highest LPC order the encoder tries by default.
+	DefaultMaxLPCOrder = 8
+
+	// DefaultLPCPrecision is the number of bits quantized coefficients are
+	// stored in.
+	DefaultLPCPrecision = 12
+
+	maxLPCPrecision      = 15 // coefficient precision is coded as 4 bits minus one, 0b1111 being invalid
+	maxLPCShift          = 15 // the shift is a 5-bit signed value and must not be negative
+	lpcPrecisionBits     = 4
+	lpcShiftBits         = 5
+	maxResidualMagnitude = math.MaxInt32
+)
+
+// prediction describes how a subframe's samples are predicted: the subframe
+// type and predictor order, the quantized coefficients and shift of an LPC
+// predictor, and the residual with its planned coding.
+type prediction struct {
+	subframeType int
+	order        int
+	coefficients []int32
+	shift        int
+	residual     []int32
+	coding       residualCoding
+	bits         int // size of the whole subframe
+}
+
+// autocorrelation returns the autocorrelation of samples for lags 0 to maxLag.
+// It sums four lags at a time in one pass over samples, so each sample is
+// loaded once for all four and their products go to independent accumulators
+// rather than waiting on one another. Each sum still gathers its products in
+// order of the later sample, giving the same result as summing lag by lag.
+func autocorrelation(samples []float64, maxLag int) []float64 {
+	r := make([]float64, maxLag+1)
+	lag := 0
+	for ; lag+3 <= maxLag && lag+3 <= len(samples); lag += 4 {
+		// The first three samples lack partners for the longer lags
+		s := samples
+		r0 := s[lag] * s[0]
+		r0 += s[lag+1] * s[1]
+		r1 := s[lag+1] * s[0]
+		r0 += s[lag+2] * s[2]
+		r1 += s[lag+2] * s[1]
+		r2 := s[lag+2] * s[0]
+		var r3 float64
+		for i := lag + 3; i < len(samples); i++ {
+			x := samples[i]
+			history := samples[i-lag-3 : i-lag+1]
+			r0 += x * history[3]
+			r1 += x * history[2]
+			r2 += x * history[1]
+			r3 += x * history[0]
+		}
+		r[lag], r[lag+1], r[lag+2], r[lag+3] = r0, r1, r2, r3
+	}
+	for ; lag <= maxLag; lag++ {
+		var sum float64
+		for i := lag; i < len(samples); i++ {
+			sum += samples[i] * samples[i-lag]
+		}
+		r[lag] = sum
+	}
+	return r
+}
+
+// levinsonDurbin solves for the LPC coefficients of every order from 1 to
+// maxOrder given the autocorrelation r. coefficients[n-1] holds the order n
+// predictor, its first coefficient applying to the most recent sample. The
+// recursion stops early if the prediction error reaches zero, as it does for
+// a perfectly predictable signal.
+func levinsonDurbin(r []float64, maxOrder int) [][]float64 {
+	if r[0] == 0 {
+		return nil
+	}
+
+	var coefficients [][]float64
+	lpc := make([]float64, maxOrder)
+	prev := make([]float64, maxOrder)
+	err := r[0]
+	for i := 0; i < maxOrder; i++ {
+		acc := r[i+1]
+		for j := 0; j < i; j++ {
+			acc -= lpc[j] * r[i-j]
+		}
+		k := acc / err
+
+		copy(prev, lpc[:i])
+		lpc[i] = k
+		for j := 0; j < i; j++ {
+			lpc[j] = prev[j] - k*prev[i-1-j]
+		}
+		coefficients = append(coefficients, append([]float64(nil), lpc[:i+1]...))
+
+		err *= 1 - k*k
+		if err <= 0 {
+			break
+		}
+	}
+	return coefficients
+}
+
+// quantizeLPCoefficients converts LPC coefficients to signed integers of
+// precision bits and the shift they are scaled by. The shift is chosen so the
+// largest coefficient uses the full precision, up to the 15 the format allows.
+// Coefficients too large to fit even unscaled would need a negative shift,
+// which the format does not allow, and are an error. Rounding errors are
+// carried from one coefficient to the next so they do not accumulate, and a
+// value the carry pushes past the signed range is clamped.
+func quantizeLPCoefficients(coeffs []float64, precision int) (qcoeffs []int32, shift int, err error) {
+	if precision < 1 || precision > maxLPCPrecision {
+		return nil, 0, fmt.Errorf("LPC precision %d is out of range 1-%d", precision, maxLPCPrecision)
+	}
+
+	var cmax float64
+	for _, c := range coeffs {
+		if math.IsNaN(c) || math.IsInf(c, 0) {
+			return nil, 0, fmt.Errorf("invalid LPC coefficient %v", c)
+		}
+		cmax = math.Max(cmax, math.Abs(c))
+	}
+	qcoeffs = make([]int32, len(coeffs))
+	if cmax == 0 {
+		return qcoeffs, 0, nil
+	}
+
+	// cmax < 2^log2cmax, and the sign takes one bit of the precision
+	_, log2cmax := math.Frexp(cmax)
+	shift = precision - 1 - log2cmax
+	if shift > maxLPCShift {
+		shift = maxLPCShift
+	}
+
+	qmax := float64(int32(1)<<(precision-1) - 1)
+	qmin := -qmax - 1
+	if shift < 0 {
+		// Only -2^(precision-1) itself still fits unscaled
+		for _, c := range coeffs {
+			if q := math.Round(c); q < qmin || q > qmax {
+				return nil, 0, fmt.Errorf("LPC coefficient %g does not fit %d bits", c, precision)
+			}
+		}
+		shift = 0
+	}
+	var carry float64
+	for i, c := range coeffs {
+		v := c*float64(int32(1)<<shift) + carry
+		q := math.Max(qmin, math.Min(qmax, math.Round(v)))
+		carry = v - q
+		qcoeffs[i] = int32(q)
+	}
+	return qcoeffs, shift, nil
+}
+
+// lpcResidual applies a quantized predictor to samples and returns the
+// residual, which holds len(samples)-order values. It returns false if a
+// residual falls outside the signed 32-bit range the format allows.
+func lpcResidual(samples []int32, coefficients []int32, shift int) ([]int32, bool) {
+	order := len(coefficients)
+	if len(samples) <= order {
+		return nil, false
+	}
+	residual := make([]int32, len(samples)-order)
+	for i := order; i < len(samples); i++ {
+		var prediction int64
+		for j, c := range coefficients {
+			prediction += int64(c) * int64(samples[i-1-j])
+		}
+		r := int64(samples[i]) - prediction>>uint(shift)
+		if r > maxResidualMagnitude || r < -maxResidualMagnitude {
+			return nil, false
+		}
+		residual[i-order] = int32(r)
+	}
+	return residual, true
+}
+
+// restoreLPC reverses linear prediction in place: samples holds len(coefficients)
+// warm-up samples followed by the residual, and ends up holding the decoded
+// samples. coefficients[0] applies to the most recent sample and each
+// prediction is shifted right by shift.
+func restoreLPC(samples []int32, coefficients []int32, shift int) {
+	order := len(coefficients)
+	for i := order; i < len(samples); i++ {
+		var prediction int64
+		for j, c := range coefficients {
+			prediction += int64(c) * int64(samples[i-1-j])
+		}
+		samples[i] += int32(prediction >> uint(shift))
+	}
+}
+
+// lpcCoefficients estimates predictor coefficients for every order from 1 to
+// maxOrder. The estimate works on a float copy of the samples weighed by
+// window, if there is one, so the samples themselves are left for the residual.
+func lpcCoefficients(samples []int32, window []float64, maxOrder int) [][]float64 {
+	if maxOrder >= len(samples) {
+		maxOrder = len(samples) - 1
+	}
+	if maxOrder < 1 {
+		return nil
+	}
+	x := make([]float64, len(samples))
+	for i, s := range samples {
+		x[i] = float64(s)
+		if window != nil {
+			x[i] *= window[i]
+		}
+	}
+	return levinsonDurbin(autocorrelation(x, maxOrder), maxOrder)
+}
+
+// predictLPC tries an LPC predictor of every order up to the encoder's maximum
+// and returns the one giving the smallest subframe. It returns false if no
+// order could be used, such as for a silent block or a block shorter than the
+// lowest order.
+func (e *Encoder) predictLPC(sf subframe) (prediction, bool) {
+	maxOrder := e.maxLPCOrder
+	if maxOrder == 0 && e.predictorMode == LPCOnly {
+		maxOrder = DefaultMaxLPCOrder
+	}
+
+	var best prediction
+	found := false
+	for _, lpc := range lpcCoefficients(sf.samples, e.windowFor(len(sf.samples)), maxOrder) {
+		order := len(lpc)
+		coefficients, shift, err := quantizeLPCoefficients(lpc, e.lpcPrecision)
+		if err != nil {
+			continue
+		}
+		residual, ok := lpcResidual(sf.samples, coefficients, shift)
+		if !ok {
+			continue
+		}
+		rc := e.planResidualCoding(residual, order)
+		bits := subframeHeaderBits(sf.wastedBits) + order*sf.bitDepth +
+			lpcPrecisionBits + lpcShiftBits + order*e.lpcPrecision + rc.bits
+		if !found || bits < best.bits {
+			best = prediction{
+				subframeType: subframeTypeLPC | (order - 1),
+				order:        order,
+				coefficients: coefficients,
+				shift:        shift,
+				residual:     residual,
+				coding:       rc,
+				bits:         bits,
+			}
+			found = true
+		}
+	}
+	return best, found
+}
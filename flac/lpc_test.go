@@ -0,0 +1,269 @@
+package flac
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// ar2Samples synthesizes x[n] = 1.6x[n-1] - 0.95x[n-2] + noise, a resonance the
+// fixed polynomial predictors cannot follow.
+func ar2Samples(n int) []int32 {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]int32, n)
+	var x1, x2 float64
+	for i := range samples {
+		x := 1.6*x1 - 0.95*x2 + rng.NormFloat64()*50
+		samples[i] = int32(x)
+		x1, x2 = float64(samples[i]), x1
+	}
+	return samples
+}
+
+func sumAbs(residual []int32) int64 {
+	var sum int64
+	for _, r := range residual {
+		if r < 0 {
+			sum -= int64(r)
+		} else {
+			sum += int64(r)
+		}
+	}
+	return sum
+}
+
+// naiveAutocorrelation sums the products for each lag in a separate pass, as
+// a reference for autocorrelation.
+func naiveAutocorrelation(samples []float64, maxLag int) []float64 {
+	r := make([]float64, maxLag+1)
+	for lag := range r {
+		var sum float64
+		for i := lag; i < len(samples); i++ {
+			sum += samples[i] * samples[i-lag]
+		}
+		r[lag] = sum
+	}
+	return r
+}
+
+// windowedSamples returns samples weighed by a Tukey window, as the encoder
+// analyzes them.
+func windowedSamples(samples []int32) []float64 {
+	window := tukeyWindow(len(samples), 0.5)
+	x := make([]float64, len(samples))
+	for i, s := range samples {
+		x[i] = float64(s) * window[i]
+	}
+	return x
+}
+
+func TestAutocorrelation(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []float64
+		maxLag  int
+	}{
+		{name: "AR(2) block at order 8", samples: windowedSamples(ar2Samples(4096)), maxLag: 8},
+		{name: "AR(2) block at order 32", samples: windowedSamples(ar2Samples(4096)), maxLag: MaxLPCOrder},
+		{name: "Block shorter than the lags", samples: []float64{3, -1, 4, 1, -5}, maxLag: 8},
+		{name: "Lag 0 only", samples: []float64{3, -1, 4}, maxLag: 0},
+		{name: "Empty block", maxLag: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, want := autocorrelation(tt.samples, tt.maxLag), naiveAutocorrelation(tt.samples, tt.maxLag)
+			if len(got) != len(want) {
+				t.Fatalf("expected %d lags, got %d", len(want), len(got))
+			}
+			for lag := range want {
+				if math.Abs(got[lag]-want[lag]) > 1e-9*math.Abs(want[0]) {
+					t.Errorf("lag %d: expected %g, got %g", lag, want[lag], got[lag])
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAutocorrelation(b *testing.B) {
+	samples := windowedSamples(ar2Samples(4096))
+	for _, lags := range []int{DefaultMaxLPCOrder, MaxLPCOrder} {
+		b.Run(fmt.Sprintf("Naive/Order%d", lags), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				naiveAutocorrelation(samples, lags)
+			}
+		})
+		b.Run(fmt.Sprintf("Grouped/Order%d", lags), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				autocorrelation(samples, lags)
+			}
+		})
+	}
+}
+
+func TestLevinsonDurbinAR2(t *testing.T) {
+	samples := ar2Samples(4096)
+	coefficients := lpcCoefficients(samples, nil, 2)
+	if len(coefficients) != 2 {
+		t.Fatalf("expected coefficients for 2 orders, got %d", len(coefficients))
+	}
+	got := coefficients[1]
+	if got[0] < 1.55 || got[0] > 1.65 || got[1] < -1 || got[1] > -0.9 {
+		t.Errorf("expected coefficients near [1.6 -0.95], got %v", got)
+	}
+}
+
+func TestQuantizeLPCoefficients(t *testing.T) {
+	tests := []struct {
+		name          string
+		coeffs        []float64
+		precision     int
+		expected      []int32
+		expectedShift int
+		expectErr     bool
+	}{
+		{
+			name:          "Largest coefficient uses the full precision",
+			coeffs:        []float64{1.5, -0.75},
+			precision:     12,
+			expected:      []int32{1536, -768},
+			expectedShift: 10,
+		},
+		{
+			name:          "Small coefficients limited to the maximum shift",
+			coeffs:        []float64{0.001, -0.0005},
+			precision:     15,
+			expected:      []int32{33, -17},
+			expectedShift: 15,
+		},
+		{
+			// 16 needs a shift of -1, but -16 is exactly the 5-bit minimum
+			name:          "Large coefficients reduce the shift",
+			coeffs:        []float64{15, -16},
+			precision:     5,
+			expected:      []int32{15, -16},
+			expectedShift: 0,
+		},
+		{
+			name:      "Coefficient too large for the precision",
+			coeffs:    []float64{16.5, 1},
+			precision: 5,
+			expectErr: true,
+		},
+		{
+			name:          "All-zero coefficients",
+			coeffs:        []float64{0, 0, 0},
+			precision:     12,
+			expected:      []int32{0, 0, 0},
+			expectedShift: 0,
+		},
+		{
+			name:          "Rounding clamped to the signed range",
+			coeffs:        []float64{0.99999, 0.99999},
+			precision:     4,
+			expected:      []int32{7, 7},
+			expectedShift: 3,
+		},
+		{
+			name:      "Precision out of range",
+			coeffs:    []float64{1},
+			precision: 16,
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qcoeffs, shift, err := quantizeLPCoefficients(tt.coeffs, tt.precision)
+			if tt.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got coefficients %v with shift %d", qcoeffs, shift)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(qcoeffs, tt.expected) {
+				t.Errorf("expected coefficients %v, got %v", tt.expected, qcoeffs)
+			}
+			if shift != tt.expectedShift {
+				t.Errorf("expected shift %d, got %d", tt.expectedShift, shift)
+			}
+			limit := int32(1) << (tt.precision - 1)
+			for _, q := range qcoeffs {
+				if q < -limit || q >= limit {
+					t.Errorf("coefficient %d does not fit %d bits", q, tt.precision)
+				}
+			}
+		})
+	}
+}
+
+func TestPredictLPC(t *testing.T) {
+	samples := ar2Samples(4096)
+	sf := subframe{samples: samples, bitDepth: 16}
+
+	encoder := &Encoder{logging: false, maxLPCOrder: DefaultMaxLPCOrder, lpcPrecision: DefaultLPCPrecision}
+	p := encoder.predictSamples(sf)
+	if p.coefficients == nil {
+		t.Fatalf("expected an LPC predictor, got subframe type %#b", p.subframeType)
+	}
+	if p.subframeType != subframeTypeLPC|(p.order-1) {
+		t.Errorf("expected subframe type for order %d, got %#b", p.order, p.subframeType)
+	}
+	if p.shift < 0 || p.shift > maxLPCShift {
+		t.Errorf("shift %d out of range", p.shift)
+	}
+
+	// Compared over the same span, the LPC residual is far smaller than the
+	// best any fixed predictor manages.
+	start := MaxLPCOrder
+	lpcSum := sumAbs(p.residual[start-p.order:])
+	for order := 0; order <= MaxFixedOrder; order++ {
+		residual, _ := fixedResidual(samples, order)
+		fixedSum := sumAbs(residual[start-order:])
+		if lpcSum*2 > fixedSum {
+			t.Errorf("expected LPC residual sum %d to be under half of fixed order %d's %d", lpcSum, order, fixedSum)
+		}
+	}
+
+	// The residual restores the samples exactly.
+	restored := append([]int32(nil), samples[:p.order]...)
+	restored = append(restored, p.residual...)
+	restoreLPC(restored, p.coefficients, p.shift)
+	if !reflect.DeepEqual(restored, samples) {
+		t.Errorf("restored samples differ from the input")
+	}
+}
+
+func TestWriteLPCSubframe(t *testing.T) {
+	samples := ar2Samples(4096)
+	encoder := &Encoder{logging: false, maxLPCOrder: DefaultMaxLPCOrder, lpcPrecision: DefaultLPCPrecision, maxPartitionOrder: DefaultMaxPartitionOrder}
+
+	var buf bytes.Buffer
+	bw := NewBitWriter(&buf)
+	encoder.writeSubframe(bw, samples, 16)
+	bits := bw.count
+	if err := bw.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	if got := int(buf.Bytes()[0]>>1) & subframeTypeLPC; got != subframeTypeLPC {
+		t.Errorf("expected an LPC subframe, got type %#b", buf.Bytes()[0]>>1)
+	}
+	if expected := encoder.predictSamples(subframe{samples: samples, bitDepth: 16}).bits; bits != int64(expected) {
+		t.Errorf("expected %d bits as planned, got %d", expected, bits)
+	}
+
+	decoded, err := readSubframe(NewBitReader(&buf), len(samples), 16)
+	if err != nil {
+		t.Fatalf("readSubframe failed: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, samples) {
+		t.Errorf("decoded samples differ from the input")
+	}
+}
@@ -0,0 +1,161 @@
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Metadata block types.
+const (
+	metadataStreamInfo    = 0
+	metadataApplication   = 2
+	metadataVorbisComment = 4
+)
+
+// VendorString identifies the encoder in VORBIS_COMMENT blocks.
+const VendorString = "soundcompression"
+
+// maxMetadataBlockSize is the largest body the 24-bit length field can describe.
+const maxMetadataBlockSize = 1<<24 - 1
+
+// metadataBlockHeader returns the 4-byte header of a metadata block: the last
+// block flag, the 7-bit block type and the 24-bit body length.
+func metadataBlockHeader(blockType int, length int, last bool) []byte {
+	header := []byte{byte(blockType), byte(length >> 16), byte(length >> 8), byte(length)}
+	if last {
+		header[0] |= LastMetadataBlock
+	}
+	return header
+}
+
+// validTagName reports whether name can be a Vorbis comment field name: one
+// or more ASCII characters from 0x20 to 0x7D, excluding '='.
+func validTagName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if c := name[i]; c < 0x20 || c > 0x7D || c == '=' {
+			return false
+		}
+	}
+	return true
+}
+
+// vorbisComment returns the body of a VORBIS_COMMENT metadata block holding
+// the tags as NAME=value comments sorted by name. Unlike the rest of FLAC, the
+// lengths inside the block are little-endian.
+func vorbisComment(tags map[string]string) ([]byte, error) {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		if !validTagName(name) {
+			return nil, fmt.Errorf("invalid tag name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var body bytes.Buffer
+	writeString := func(s string) {
+		binary.Write(&body, binary.LittleEndian, uint32(len(s)))
+		body.WriteString(s)
+	}
+	writeString(VendorString)
+	binary.Write(&body, binary.LittleEndian, uint32(len(names)))
+	for _, name := range names {
+		writeString(name + "=" + tags[name])
+	}
+
+	return body.Bytes(), nil
+}
+
+// parseVorbisComment reads the tags back out of the body of a VORBIS_COMMENT
+// block. Field names are case-insensitive, so they are returned upper-cased;
+// a name given more than once keeps its last value. The vendor string is
+// skipped.
+func parseVorbisComment(body []byte) (map[string]string, error) {
+	r := bytes.NewReader(body)
+	readString := func() (string, error) {
+		var length uint32
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return "", err
+		}
+		if int64(length) > int64(r.Len()) {
+			return "", fmt.Errorf("string of %d bytes overruns the block", length)
+		}
+		s := make([]byte, length)
+		r.Read(s)
+		return string(s), nil
+	}
+
+	if _, err := readString(); err != nil {
+		return nil, fmt.Errorf("error reading vendor string: %w", err)
+	}
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("error reading comment count: %w", err)
+	}
+	tags := make(map[string]string)
+	for i := uint32(0); i < count; i++ {
+		comment, err := readString()
+		if err != nil {
+			return nil, fmt.Errorf("error reading comment %d: %w", i, err)
+		}
+		name, value, ok := strings.Cut(comment, "=")
+		if !ok || !validTagName(name) {
+			return nil, fmt.Errorf("invalid comment %q", comment)
+		}
+		tags[strings.ToUpper(name)] = value
+	}
+	return tags, nil
+}
+
+// application is the payload of an APPLICATION metadata block, keyed by an
+// ID registered with the FLAC project.
+type application struct {
+	id   [4]byte
+	data []byte
+}
+
+// block returns the body of the APPLICATION block: the ID followed by the data.
+func (a application) block() []byte {
+	return append(a.id[:len(a.id):len(a.id)], a.data...)
+}
+
+// metadataBlock is an optional metadata block written after STREAMINFO.
+type metadataBlock struct {
+	blockType int
+	body      []byte
+}
+
+// metadataBlocks returns the metadata blocks the options ask for, in the order
+// they are written after STREAMINFO.
+func (e *Encoder) metadataBlocks() ([]metadataBlock, error) {
+	var blocks []metadataBlock
+	if e.seekTable != nil {
+		blocks = append(blocks, metadataBlock{metadataSeekTable, e.seekTable.block()})
+	}
+	if tags := e.allTags(); len(tags) > 0 {
+		body, err := vorbisComment(tags)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, metadataBlock{metadataVorbisComment, body})
+	}
+	for _, p := range e.pictures {
+		blocks = append(blocks, metadataBlock{metadataPicture, p.block()})
+	}
+	for _, a := range e.applications {
+		blocks = append(blocks, metadataBlock{metadataApplication, a.block()})
+	}
+
+	for _, b := range blocks {
+		if len(b.body) > maxMetadataBlockSize {
+			return nil, fmt.Errorf("metadata block of type %d too large: %d bytes", b.blockType, len(b.body))
+		}
+	}
+	return blocks, nil
+}
@@ -0,0 +1,191 @@
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseVorbisComments reads back the body of a VORBIS_COMMENT block.
+func parseVorbisComments(t *testing.T, body []byte) (string, []string) {
+	t.Helper()
+	r := bytes.NewReader(body)
+	readString := func() string {
+		var length uint32
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			t.Fatalf("failed to read length: %v", err)
+		}
+		s := make([]byte, length)
+		if _, err := r.Read(s); err != nil && length > 0 {
+			t.Fatalf("failed to read string: %v", err)
+		}
+		return string(s)
+	}
+
+	vendor := readString()
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		t.Fatalf("failed to read comment count: %v", err)
+	}
+	comments := make([]string, count)
+	for i := range comments {
+		comments[i] = readString()
+	}
+	if r.Len() != 0 {
+		t.Errorf("expected no trailing bytes, got %d", r.Len())
+	}
+	return vendor, comments
+}
+
+func TestWithTags(t *testing.T) {
+	tests := []struct {
+		name        string
+		tags        map[string]string
+		expected    []string
+		expectedErr bool
+	}{
+		{
+			name:     "No tags",
+			tags:     nil,
+			expected: nil,
+		},
+		{
+			name:     "Tags sorted by name",
+			tags:     map[string]string{"TITLE": "Song", "ARTIST": "Band", "ALBUM": "Record = Ü"},
+			expected: []string{"ALBUM=Record = Ü", "ARTIST=Band", "TITLE=Song"},
+		},
+		{
+			name:        "Name containing '='",
+			tags:        map[string]string{"A=B": "x"},
+			expectedErr: true,
+		},
+		{
+			name:        "Empty name",
+			tags:        map[string]string{"": "x"},
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := sineSamples(1000, 2)
+			input := newTestFormat(44100, 2, 16, samples...)
+			var buf bytes.Buffer
+			encoder, err := NewEncoderWriter(input, &buf, WithTags(tt.tags))
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if err := encoder.Encode(); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			data := buf.Bytes()
+
+			streamInfoLast := data[4]&LastMetadataBlock != 0
+			if streamInfoLast != (len(tt.expected) == 0) {
+				t.Errorf("expected STREAMINFO last flag %v, got %v", len(tt.expected) == 0, streamInfoLast)
+			}
+
+			if len(tt.expected) > 0 {
+				header := data[8+StreamInfoSize:]
+				if header[0] != LastMetadataBlock|metadataVorbisComment {
+					t.Fatalf("expected a last VORBIS_COMMENT block header, got %#02x", header[0])
+				}
+				length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+				vendor, comments := parseVorbisComments(t, header[4:4+length])
+				if vendor != VendorString {
+					t.Errorf("expected vendor %q, got %q", VendorString, vendor)
+				}
+				if len(comments) != len(tt.tags) {
+					t.Errorf("expected %d comments, got %d", len(tt.tags), len(comments))
+				}
+				if !reflect.DeepEqual(comments, tt.expected) {
+					t.Errorf("expected comments %q, got %q", tt.expected, comments)
+				}
+			}
+
+			// The stream must still decode with the extra block in place.
+			decoder, err := NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if decoded := readAllSamples(t, decoder); !reflect.DeepEqual(decoded, samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+}
+
+func TestMetadataBlockTooLarge(t *testing.T) {
+	encoder := &Encoder{tags: map[string]string{"COMMENT": strings.Repeat("x", maxMetadataBlockSize)}}
+	if _, err := encoder.metadataBlocks(); err == nil {
+		t.Errorf("expected an error for a block over %d bytes", maxMetadataBlockSize)
+	}
+}
+
+func TestWithApplication(t *testing.T) {
+	apps := []application{
+		{id: [4]byte{'t', 'e', 's', 't'}, data: []byte("first payload")},
+		{id: [4]byte{'A', 'P', 'P', '2'}, data: bytes.Repeat([]byte{0xAB}, 300)},
+		{id: [4]byte{'e', 'm', 'p', 't'}},
+	}
+	input := newTestFormat(44100, 1, 16, sineSamples(1000, 1)...)
+	var opts []Option
+	for _, a := range apps {
+		opts = append(opts, WithApplication(a.id, a.data))
+	}
+	var out bytes.Buffer
+	encoder, err := NewEncoderWriter(input, &out, opts...)
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	if err := encoder.Encode(); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	// Walk the metadata blocks, keeping every APPLICATION block in order.
+	data := out.Bytes()
+	var bodies [][]byte
+	offset := len(FlacMarker)
+	for {
+		header := data[offset:]
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if int(header[0]&^LastMetadataBlock) == metadataApplication {
+			bodies = append(bodies, data[offset+4:offset+4+length])
+		}
+		offset += 4 + length
+		if header[0]&LastMetadataBlock != 0 {
+			break
+		}
+	}
+
+	if len(bodies) != len(apps) {
+		t.Fatalf("expected %d APPLICATION blocks, got %d", len(apps), len(bodies))
+	}
+	for i, body := range bodies {
+		if len(body) < 4 {
+			t.Fatalf("block %d: expected at least the 4-byte ID, got %d bytes", i, len(body))
+		}
+		if id := [4]byte(body[:4]); id != apps[i].id {
+			t.Errorf("block %d: expected ID %q, got %q", i, apps[i].id[:], id[:])
+		}
+		if got := len(body) - 4; got != len(apps[i].data) {
+			t.Errorf("block %d: expected %d bytes of data, got %d", i, len(apps[i].data), got)
+		}
+		if !bytes.Equal(body[4:], apps[i].data) {
+			t.Errorf("block %d: payload differs", i)
+		}
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if got := len(readAllSamples(t, decoder)); got != 1000 {
+		t.Errorf("expected 1000 decoded samples, got %d", got)
+	}
+}
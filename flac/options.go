@@ -0,0 +1,363 @@
+package flac
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// Option configures an Encoder. Options are applied in order by NewEncoder and
+// NewEncoderWriter, and an option returning an error aborts construction.
+type Option func(*Encoder) error
+
+// WithBlockSize sets the number of samples per channel in each block. It must
+// be within the 16-65535 range FLAC allows.
+func WithBlockSize(n int) Option {
+	return func(e *Encoder) error {
+		if n < MinBlockSize || n > MaxBlockSize {
+			return fmt.Errorf("invalid block size %d: must be between %d and %d", n, MinBlockSize, MaxBlockSize)
+		}
+		e.minBlockSize = n
+		e.maxBlockSize = n
+		return nil
+	}
+}
+
+// WithVariableBlockSize selects the variable blocking strategy, under which
+// each frame header carries the number of the frame's first sample, of up to
+// 36 bits, instead of the frame's position in the stream, of up to 31 bits.
+// Streams whose blocks differ in size must use it.
+func WithVariableBlockSize(variable bool) Option {
+	return func(e *Encoder) error {
+		e.variableBlockSize = variable
+		return nil
+	}
+}
+
+// WithObservedBlockSizes writes the smallest and largest block sizes the
+// encoder actually used to STREAMINFO once the stream is finished, instead of
+// the configured bounds. Decoders may size their buffers from these. Unlike the
+// configured minimum, the observed one counts the last block, which is usually
+// short, so a stream whose blocks are otherwise all the same size no longer
+// reports equal bounds; the minimum is raised to 16 samples if the last block
+// is smaller still, as the field cannot go lower.
+func WithObservedBlockSizes(observed bool) Option {
+	return func(e *Encoder) error {
+		e.observedBlocks = observed
+		return nil
+	}
+}
+
+// WithOutputBitDepth encodes the input at bits bits per sample, from 4 to 32,
+// rather than its own bit depth, which must be at least as high. A lower depth
+// is reached by requantizing the input with TPDF dither, as audio.Requantize
+// does, so a 24-bit recording can be stored as a 16-bit FLAC file. STREAMINFO,
+// the frame headers and the MD5 signature all describe the requantized audio.
+func WithOutputBitDepth(bits int) Option {
+	return func(e *Encoder) error {
+		if bits < 4 || bits > 32 {
+			return fmt.Errorf("invalid output bit depth %d: must be between 4 and 32", bits)
+		}
+		e.outputBitDepth = bits
+		return nil
+	}
+}
+
+// WithMaxPartitionOrder sets the highest Rice partition order tried when
+// coding residuals, from 0 (a single partition) to 15. Higher orders adapt
+// better to blocks whose loudness changes, at the cost of encoding time.
+func WithMaxPartitionOrder(n int) Option {
+	return func(e *Encoder) error {
+		if n < 0 || n > MaxPartitionOrder {
+			return fmt.Errorf("invalid maximum partition order %d: must be between 0 and %d", n, MaxPartitionOrder)
+		}
+		e.maxPartitionOrder = n
+		return nil
+	}
+}
+
+// WithExhaustiveRiceSearch finds each residual partition's Rice parameter by
+// measuring the coded size of every parameter rather than estimating it from
+// the partition's mean, the default. The search never codes a partition
+// larger than the estimate would, and is usually only slightly smaller, at a
+// noticeable cost in encoding time.
+func WithExhaustiveRiceSearch(exhaustive bool) Option {
+	return func(e *Encoder) error {
+		e.exhaustiveRice = exhaustive
+		return nil
+	}
+}
+
+// WithMaxLPCOrder sets the highest LPC order tried for each subframe, from 1
+// to 32. Every order up to n is tried and the one coding smallest kept, so
+// higher orders cost encoding time for ever smaller gains. It also enables LPC
+// at the compression levels that use fixed predictors only.
+func WithMaxLPCOrder(n int) Option {
+	return func(e *Encoder) error {
+		if n < 1 || n > MaxLPCOrder {
+			return fmt.Errorf("invalid maximum LPC order %d: must be between 1 and %d", n, MaxLPCOrder)
+		}
+		e.maxLPCOrder = n
+		return nil
+	}
+}
+
+// WithLPCPrecision sets the number of bits each quantized LPC coefficient is
+// stored in, from 5 to 15. More precise coefficients predict better but take
+// more space in every subframe. The default is DefaultLPCPrecision.
+func WithLPCPrecision(bits int) Option {
+	return func(e *Encoder) error {
+		if bits < 5 || bits > maxLPCPrecision {
+			return fmt.Errorf("invalid LPC precision %d: must be between 5 and %d", bits, maxLPCPrecision)
+		}
+		e.lpcPrecision = bits
+		return nil
+	}
+}
+
+// compressionLevel holds the settings a compression level stands for.
+type compressionLevel struct {
+	blockSize         int
+	maxLPCOrder       int
+	apodization       string
+	maxPartitionOrder int
+	partitionSearch   bool
+	stereoMode        stereoMode
+}
+
+// compressionLevels spans the range of the reference encoder's presets, from
+// fixed predictors only to order 12 LPC, but is not a copy of them. Level 5
+// matches the encoder's defaults.
+var compressionLevels = [...]compressionLevel{
+	{1152, 0, DefaultApodization, 3, false, stereoIndependent},
+	{1152, 0, DefaultApodization, 3, false, stereoAdaptive},
+	{1152, 0, DefaultApodization, 3, true, stereoExhaustive},
+	{4096, 6, DefaultApodization, 4, true, stereoIndependent},
+	{4096, 8, DefaultApodization, 4, true, stereoAdaptive},
+	{4096, 8, DefaultApodization, 5, true, stereoAdaptive},
+	{4096, 8, DefaultApodization, 6, true, stereoExhaustive},
+	{4096, 12, DefaultApodization, 6, true, stereoExhaustive},
+	{4096, 12, DefaultApodization, 8, true, stereoExhaustive},
+}
+
+// MaxCompressionLevel is the slowest, smallest compression level.
+const MaxCompressionLevel = len(compressionLevels) - 1
+
+// WithCompressionLevel applies a preset from 0, the fastest, to 8, the
+// smallest. The levels trade speed for size as the reference encoder's -0 to
+// -8 do, but their settings are this encoder's own; level 5, for one, picks
+// the stereo assignment by estimate where the reference -5 tries them all:
+//
+//	level  block size  max LPC order  max partition order  partition search  stereo
+//	0      1152        fixed only     3                    no                independent
+//	1      1152        fixed only     3                    no                adaptive
+//	2      1152        fixed only     3                    yes               exhaustive
+//	3      4096        6              4                    yes               independent
+//	4      4096        8              4                    yes               adaptive
+//	5      4096        8              5                    yes               adaptive
+//	6      4096        8              6                    yes               exhaustive
+//	7      4096        12             6                    yes               exhaustive
+//	8      4096        12             8                    yes               exhaustive
+//
+// Every level uses the DefaultApodization window. Adaptive stereo picks the
+// channel assignment by estimate, exhaustive stereo codes all four and keeps
+// the smallest. Options given after this one override its settings.
+func WithCompressionLevel(level int) Option {
+	return func(e *Encoder) error {
+		if level < 0 || level > MaxCompressionLevel {
+			return fmt.Errorf("invalid compression level %d: must be between 0 and %d", level, MaxCompressionLevel)
+		}
+		l := compressionLevels[level]
+		window, err := parseApodization(l.apodization)
+		if err != nil {
+			return err
+		}
+		e.minBlockSize = l.blockSize
+		e.maxBlockSize = l.blockSize
+		e.maxLPCOrder = l.maxLPCOrder
+		e.apodization = window
+		e.window = nil
+		e.maxPartitionOrder = l.maxPartitionOrder
+		e.partitionSearch = l.partitionSearch
+		e.stereoMode = l.stereoMode
+		return nil
+	}
+}
+
+// PredictorMode selects the kinds of predictor the encoder tries for each
+// subframe.
+type PredictorMode int
+
+const (
+	// Auto tries both fixed and LPC predictors and keeps whichever codes
+	// smallest. It is the default.
+	Auto PredictorMode = iota
+
+	// FixedOnly tries only the fixed polynomial predictors, for speed.
+	FixedOnly
+
+	// LPCOnly tries only LPC predictors, up to the maximum LPC order set by
+	// WithMaxLPCOrder or the compression level, or DefaultMaxLPCOrder for the
+	// levels that use fixed predictors only.
+	LPCOnly
+)
+
+// WithPredictor chooses between fixed and LPC predictors regardless of the
+// compression level. Whatever the mode, channels that cannot be predicted
+// smaller than they are still take constant or verbatim subframes.
+func WithPredictor(mode PredictorMode) Option {
+	return func(e *Encoder) error {
+		if mode < Auto || mode > LPCOnly {
+			return fmt.Errorf("invalid predictor mode %d", mode)
+		}
+		e.predictorMode = mode
+		return nil
+	}
+}
+
+// WithApodization sets the window applied to each block before estimating LPC
+// coefficients: "rectangle", "hann", "tukey" or "tukey(P)", where P between 0
+// and 1 is the fraction of the block tapered. The window only shapes the
+// estimate; the residual is computed from the unweighted samples. The default
+// is DefaultApodization.
+func WithApodization(name string) Option {
+	return func(e *Encoder) error {
+		window, err := parseApodization(name)
+		if err != nil {
+			return err
+		}
+		e.apodization = window
+		e.window = nil
+		return nil
+	}
+}
+
+// WithVerify decodes each frame as soon as it is encoded and compares it with
+// the samples it was encoded from, failing the encode with a *VerifyError on
+// the first mismatch. It catches encoder bugs at the cost of encoding time.
+func WithVerify(verify bool) Option {
+	return func(e *Encoder) error {
+		e.verify = verify
+		return nil
+	}
+}
+
+// WithExactLength guarantees that the stream decodes to exactly the input's
+// TotalSamples samples. The final block is always coded at its true length
+// rather than padded to the block size; with the option set, Encode also fails
+// with ErrLengthMismatch if the input runs short of, or past, the total it
+// reported, instead of writing a STREAMINFO that disagrees with the frames.
+// Inputs of unknown length, reporting 0 total samples, are not checked.
+func WithExactLength(exact bool) Option {
+	return func(e *Encoder) error {
+		e.exactLength = exact
+		return nil
+	}
+}
+
+// WithFlushInterval calls Flush whenever interval has passed since the last
+// flush, or since the encode started, so that a crash loses at most interval's
+// worth of audio. It suits long live encodes to a file; outputs that cannot
+// seek are never flushed. An interval of 0, the default, disables it.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(e *Encoder) error {
+		if interval < 0 {
+			return fmt.Errorf("invalid flush interval %v: must not be negative", interval)
+		}
+		e.flushInterval = interval
+		return nil
+	}
+}
+
+// WithLogging enables verbose logging of the encoding process to standard
+// error, including the per-block debug messages. Use WithLogger to send the
+// messages elsewhere.
+func WithLogging(logging bool) Option {
+	if !logging {
+		return WithLogger(nil)
+	}
+	return WithLogger(verboseLogger())
+}
+
+// WithLogger sends the encoder's log messages to logger. Stages of the process
+// are logged at info level, anything unusual, such as a cancelled encode, at
+// warn level and the details of each block and subframe at debug level. A nil
+// logger disables logging, which is the default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(e *Encoder) error {
+		e.logging = logger != nil
+		e.logger = logger
+		if logger == nil {
+			e.logger = discardLogger
+		}
+		return nil
+	}
+}
+
+// WithProgress registers a callback fired after each encoded block with the
+// number of samples per channel encoded so far and the input's total. It runs
+// on the encoding goroutine, so it should return quickly; a slow callback, such
+// as one redrawing a UI, should hand the values off rather than do the work
+// itself. A nil callback disables progress reporting.
+func WithProgress(progress func(samplesDone, samplesTotal uint64)) Option {
+	return func(e *Encoder) error {
+		e.progress = progress
+		return nil
+	}
+}
+
+// WithTags embeds the tags, such as ARTIST, TITLE or ALBUM, as Vorbis comments
+// in a VORBIS_COMMENT block following STREAMINFO. Names must be printable
+// ASCII without '='; they are written in sorted order.
+func WithTags(tags map[string]string) Option {
+	return func(e *Encoder) error {
+		e.tags = make(map[string]string, len(tags))
+		for name, value := range tags {
+			if !validTagName(name) {
+				return fmt.Errorf("invalid tag name %q", name)
+			}
+			e.tags[name] = value
+		}
+		return nil
+	}
+}
+
+// WithSeekTable writes a SEEKTABLE block with a seek point every
+// intervalSeconds, letting players jump into long files without scanning
+// them. It is skipped when the input's total length is unknown.
+func WithSeekTable(intervalSeconds float64) Option {
+	return func(e *Encoder) error {
+		if !(intervalSeconds > 0) || math.IsInf(intervalSeconds, 0) {
+			return fmt.Errorf("invalid seek table interval %v: must be positive", intervalSeconds)
+		}
+		e.seekInterval = intervalSeconds
+		return nil
+	}
+}
+
+// WithPicture embeds an image, such as cover art, in a PICTURE block.
+// pictureType follows the ID3v2 APIC types, 3 being the front cover. The
+// width, height and colour depth are filled in for PNG and JPEG images and
+// left zero otherwise; an empty mime is detected the same way. The option may
+// be given more than once.
+func WithPicture(pictureType uint32, mime string, description string, data []byte) Option {
+	return func(e *Encoder) error {
+		p, err := newPicture(pictureType, mime, description, data)
+		if err != nil {
+			return err
+		}
+		e.pictures = append(e.pictures, p)
+		return nil
+	}
+}
+
+// WithApplication embeds data in an APPLICATION block under the given
+// application ID, which should be registered with the FLAC project. The option
+// may be given more than once; the blocks are written in the order given.
+func WithApplication(id [4]byte, data []byte) Option {
+	return func(e *Encoder) error {
+		e.applications = append(e.applications, application{id: id, data: data})
+		return nil
+	}
+}
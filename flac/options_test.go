@@ -0,0 +1,545 @@
+package flac
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithBlockSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []Option
+		expectedErr   bool
+		expectedMinBS int
+		expectedMaxBS int
+	}{
+		{
+			name:          "Default",
+			opts:          nil,
+			expectedMinBS: DefaultMinBlockSize,
+			expectedMaxBS: DefaultMaxBlockSize,
+		},
+		{
+			name:          "Valid 2048",
+			opts:          []Option{WithBlockSize(2048)},
+			expectedMinBS: 2048,
+			expectedMaxBS: 2048,
+		},
+		{
+			name:        "Too small",
+			opts:        []Option{WithBlockSize(8)},
+			expectedErr: true,
+		},
+		{
+			name:        "Too large",
+			opts:        []Option{WithBlockSize(70000)},
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder, err := NewEncoderWriter(newTestFormat(44100, 2, 16), &buf, tt.opts...)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if encoder.minBlockSize != tt.expectedMinBS {
+				t.Errorf("expected minBlockSize to be %d, got %d", tt.expectedMinBS, encoder.minBlockSize)
+			}
+			if encoder.maxBlockSize != tt.expectedMaxBS {
+				t.Errorf("expected maxBlockSize to be %d, got %d", tt.expectedMaxBS, encoder.maxBlockSize)
+			}
+		})
+	}
+}
+
+// Block sizes count samples per channel, whatever the bit depth and channel
+// count: every frame holds that many samples of each channel.
+func TestBlockSizeUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels int
+		bitDepth int
+	}{
+		{name: "8-bit mono", channels: 1, bitDepth: 8},
+		{name: "24-bit stereo", channels: 2, bitDepth: 24},
+		{name: "32-bit 8 channels", channels: 8, bitDepth: 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const blocks = 3
+			samples := make([]int32, blocks*MinBlockSize*tt.channels)
+			for i := range samples {
+				samples[i] = int32(i%7 - 3)
+			}
+			var analysis bytes.Buffer
+			encoded := encodeToBuffer(t, newTestFormat(44100, tt.channels, tt.bitDepth, samples...),
+				WithBlockSize(MinBlockSize), WithAnalysisWriter(&analysis))
+
+			if got := strings.Count(analysis.String(), fmt.Sprintf("blocksize=%d ", MinBlockSize)); got != blocks {
+				t.Errorf("expected %d frames of %d samples, got %d in:\n%s", blocks, MinBlockSize, got, analysis.String())
+			}
+			decoder, err := NewDecoder(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if info := decoder.StreamInfo(); info.MinBlockSize != MinBlockSize || info.MaxBlockSize != MinBlockSize {
+				t.Errorf("expected block sizes of %d in STREAMINFO, got %d and %d", MinBlockSize, info.MinBlockSize, info.MaxBlockSize)
+			}
+		})
+	}
+
+	if _, err := NewEncoderWriter(newTestFormat(44100, 8, 32), &bytes.Buffer{}, WithBlockSize(MinBlockSize-1)); err == nil {
+		t.Errorf("expected an error for a block size of %d samples", MinBlockSize-1)
+	}
+}
+
+func TestWithMaxPartitionOrder(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []Option
+		expectedErr   bool
+		expectedOrder int
+	}{
+		{
+			name:          "Default",
+			expectedOrder: DefaultMaxPartitionOrder,
+		},
+		{
+			name:          "Single partition",
+			opts:          []Option{WithMaxPartitionOrder(0)},
+			expectedOrder: 0,
+		},
+		{
+			name:          "Maximum",
+			opts:          []Option{WithMaxPartitionOrder(MaxPartitionOrder)},
+			expectedOrder: MaxPartitionOrder,
+		},
+		{
+			name:        "Too large",
+			opts:        []Option{WithMaxPartitionOrder(MaxPartitionOrder + 1)},
+			expectedErr: true,
+		},
+		{
+			name:        "Negative",
+			opts:        []Option{WithMaxPartitionOrder(-1)},
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder, err := NewEncoderWriter(newTestFormat(44100, 2, 16), &buf, tt.opts...)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if encoder.maxPartitionOrder != tt.expectedOrder {
+				t.Errorf("expected maxPartitionOrder to be %d, got %d", tt.expectedOrder, encoder.maxPartitionOrder)
+			}
+		})
+	}
+}
+
+func TestWithCompressionLevel(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []Option
+		expectedErr bool
+		check       func(t *testing.T, e *Encoder)
+	}{
+		{
+			name: "Level 5 matches the defaults",
+			opts: []Option{WithCompressionLevel(5)},
+			check: func(t *testing.T, e *Encoder) {
+				var buf bytes.Buffer
+				defaults, _ := NewEncoderWriter(newTestFormat(44100, 2, 16), &buf)
+				if e.minBlockSize != defaults.minBlockSize || e.maxLPCOrder != defaults.maxLPCOrder ||
+					e.maxPartitionOrder != defaults.maxPartitionOrder || e.partitionSearch != defaults.partitionSearch ||
+					e.stereoMode != defaults.stereoMode {
+					t.Errorf("expected level 5 to match the defaults")
+				}
+			},
+		},
+		{
+			name: "Level 0 uses fixed predictors only",
+			opts: []Option{WithCompressionLevel(0)},
+			check: func(t *testing.T, e *Encoder) {
+				if e.maxLPCOrder != 0 || e.minBlockSize != 1152 || e.partitionSearch || e.stereoMode != stereoIndependent {
+					t.Errorf("unexpected level 0 settings: %+v", compressionLevels[0])
+				}
+			},
+		},
+		{
+			name: "Later options override the level",
+			opts: []Option{WithCompressionLevel(8), WithBlockSize(2048)},
+			check: func(t *testing.T, e *Encoder) {
+				if e.minBlockSize != 2048 || e.maxLPCOrder != 12 {
+					t.Errorf("expected block size 2048 and max LPC order 12, got %d and %d", e.minBlockSize, e.maxLPCOrder)
+				}
+			},
+		},
+		{
+			name:        "Too high",
+			opts:        []Option{WithCompressionLevel(MaxCompressionLevel + 1)},
+			expectedErr: true,
+		},
+		{
+			name:        "Negative",
+			opts:        []Option{WithCompressionLevel(-1)},
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder, err := NewEncoderWriter(newTestFormat(44100, 2, 16), &buf, tt.opts...)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			tt.check(t, encoder)
+		})
+	}
+}
+
+func TestWithProgress(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress func(calls *[][2]uint64) func(uint64, uint64)
+	}{
+		{
+			name: "Callback",
+			progress: func(calls *[][2]uint64) func(uint64, uint64) {
+				return func(done, total uint64) {
+					*calls = append(*calls, [2]uint64{done, total})
+				}
+			},
+		},
+		{
+			name: "Nil callback",
+			progress: func(calls *[][2]uint64) func(uint64, uint64) {
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls [][2]uint64
+			progress := tt.progress(&calls)
+			input := newTestFormat(44100, 2, 16, sineSamples(10000, 2)...)
+
+			var buf bytes.Buffer
+			encoder, err := NewEncoderWriter(input, &buf, WithBlockSize(4096), WithProgress(progress))
+			if err != nil {
+				t.Fatalf("NewEncoderWriter failed: %v", err)
+			}
+			if err := encoder.Encode(); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+
+			if progress == nil {
+				return
+			}
+			if len(calls) != 3 {
+				t.Fatalf("expected 3 progress calls, got %d", len(calls))
+			}
+			for i := 1; i < len(calls); i++ {
+				if calls[i][0] <= calls[i-1][0] {
+					t.Errorf("expected progress to increase, got %v", calls)
+				}
+			}
+			if last := calls[len(calls)-1]; last[0] != last[1] || last[1] != 10000 {
+				t.Errorf("expected final progress to be 10000/10000, got %d/%d", last[0], last[1])
+			}
+		})
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    slog.Level
+		expected []string
+		absent   []string
+	}{
+		{
+			name:     "Debug level",
+			level:    slog.LevelDebug,
+			expected: []string{"Starting encoding process", "msg=\"Encoded block\" samples=8192", "Finished encoding process"},
+		},
+		{
+			name:     "Info level",
+			level:    slog.LevelInfo,
+			expected: []string{"Starting encoding process", "Finished encoding process"},
+			absent:   []string{"Encoded block"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: tt.level}))
+			input := newTestFormat(44100, 2, 16, sineSamples(2*DefaultMinBlockSize, 2)...)
+			encodeToBuffer(t, input, WithLogger(logger))
+
+			for _, msg := range tt.expected {
+				if !strings.Contains(logs.String(), msg) {
+					t.Errorf("expected %q in the log, got:\n%s", msg, logs.String())
+				}
+			}
+			for _, msg := range tt.absent {
+				if strings.Contains(logs.String(), msg) {
+					t.Errorf("expected no %q in the log", msg)
+				}
+			}
+		})
+	}
+
+	t.Run("Nil logger disables logging", func(t *testing.T) {
+		encoder, err := NewEncoderWriter(newTestFormat(44100, 2, 16), &bytes.Buffer{}, WithLogging(true), WithLogger(nil))
+		if err != nil {
+			t.Fatalf("NewEncoderWriter failed: %v", err)
+		}
+		if encoder.logging || encoder.logger != discardLogger {
+			t.Errorf("expected logging to be disabled")
+		}
+	})
+}
+
+func TestWithPredictor(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		forbidden string // subframe type that must not appear
+		required  string // subframe type that must appear
+	}{
+		{name: "Auto", opts: []Option{WithPredictor(Auto)}, required: "type=LPC"},
+		{name: "Fixed only", opts: []Option{WithPredictor(FixedOnly)}, forbidden: "type=LPC", required: "type=FIXED"},
+		{name: "LPC only", opts: []Option{WithPredictor(LPCOnly)}, forbidden: "type=FIXED", required: "type=LPC"},
+		{
+			name:      "LPC only at a fixed-only level",
+			opts:      []Option{WithCompressionLevel(0), WithPredictor(LPCOnly)},
+			forbidden: "type=FIXED",
+			required:  "type=LPC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := sineSamples(3*DefaultMinBlockSize, 2)
+			var analysis bytes.Buffer
+			encoded := encodeToBuffer(t, newTestFormat(44100, 2, 16, samples...), append(tt.opts, WithAnalysisWriter(&analysis))...)
+
+			if tt.forbidden != "" && strings.Contains(analysis.String(), tt.forbidden) {
+				t.Errorf("expected no %s subframes, got:\n%s", tt.forbidden, analysis.String())
+			}
+			if !strings.Contains(analysis.String(), tt.required) {
+				t.Errorf("expected %s subframes, got:\n%s", tt.required, analysis.String())
+			}
+
+			decoder, err := NewDecoder(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if decoded := readAllSamples(t, decoder); !reflect.DeepEqual(decoded, samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+
+	if _, err := NewEncoderWriter(newTestFormat(44100, 2, 16), &bytes.Buffer{}, WithPredictor(PredictorMode(3))); err == nil {
+		t.Errorf("expected an error for an invalid predictor mode")
+	}
+}
+
+// chordSamples returns n mono samples of twelve mixed tones over faint noise,
+// a signal that keeps gaining from higher LPC orders.
+func chordSamples(n int) []int32 {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]int32, n)
+	for i := range samples {
+		var v float64
+		for k := 1; k <= 12; k++ {
+			v += 1500 * math.Sin(0.037*float64(i*k*k)+float64(k))
+		}
+		samples[i] = int32(v + rng.NormFloat64()*2)
+	}
+	return samples
+}
+
+func TestWithMaxLPCOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		order     int
+		precision int
+	}{
+		{name: "Order 8", order: 8, precision: DefaultLPCPrecision},
+		{name: "Order 32", order: 32, precision: DefaultLPCPrecision},
+		{name: "Order 32 at full precision", order: 32, precision: 15},
+		{name: "Order 8 at low precision", order: 8, precision: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := chordSamples(DefaultMinBlockSize)
+			encoded := encodeToBuffer(t, newTestFormat(44100, 1, 16, samples...),
+				WithPredictor(LPCOnly), WithMaxLPCOrder(tt.order), WithLPCPrecision(tt.precision))
+
+			// The chord gains from nearly every order it is given, so the
+			// subframe header carries an order close to the maximum
+			decoder, err := NewDecoder(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if _, err := decoder.readFrameHeader(); err != nil {
+				t.Fatalf("readFrameHeader failed: %v", err)
+			}
+			header, _ := decoder.br.ReadBits(8)
+			subframeType := int(header>>1) & 0x3F
+			order := subframeType&0x1F + 1
+			if subframeType&subframeTypeLPC == 0 || order > tt.order || order <= tt.order/2 {
+				t.Fatalf("expected an LPC subframe of order above %d up to %d, got type %#b", tt.order/2, tt.order, subframeType)
+			}
+			if header&1 != 0 {
+				t.Fatalf("expected no wasted bits")
+			}
+			for i := 0; i < order; i++ {
+				decoder.br.ReadBits(16)
+			}
+			if precision, _ := decoder.br.ReadBits(lpcPrecisionBits); int(precision)+1 != tt.precision {
+				t.Errorf("expected precision %d in the header, got %d", tt.precision, precision+1)
+			}
+
+			decoder, err = NewDecoder(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if decoded := readAllSamples(t, decoder); !reflect.DeepEqual(decoded, samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+
+	for _, opt := range []Option{WithMaxLPCOrder(0), WithMaxLPCOrder(33), WithLPCPrecision(4), WithLPCPrecision(16)} {
+		if _, err := NewEncoderWriter(newTestFormat(44100, 2, 16), &bytes.Buffer{}, opt); err == nil {
+			t.Errorf("expected an error for an out-of-range option")
+		}
+	}
+}
+
+func TestWithObservedBlockSizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    int // inter-channel samples
+		observed bool
+		seekable bool
+		min, max int
+	}{
+		{name: "Short final block", count: 3*DefaultMinBlockSize + 1000, observed: true, min: 1000, max: 4096},
+		{name: "Short final block to a seekable output", count: 3*DefaultMinBlockSize + 1000, observed: true, seekable: true, min: 1000, max: 4096},
+		{name: "Whole blocks", count: 2 * DefaultMinBlockSize, observed: true, min: 4096, max: 4096},
+		{name: "Only block", count: 2000, observed: true, min: 2000, max: 2000},
+		{name: "Final block under the field minimum", count: DefaultMinBlockSize + 5, observed: true, min: MinBlockSize, max: 4096},
+		{name: "Configured bounds", count: 3*DefaultMinBlockSize + 1000, min: 4096, max: 4096},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := sineSamples(tt.count, 2)
+			input := newTestFormat(44100, 2, 16, samples...)
+			var data []byte
+			if tt.seekable {
+				out := &memWriteSeeker{}
+				encoder, err := NewEncoderWriter(input, out, WithObservedBlockSizes(tt.observed))
+				if err != nil {
+					t.Fatalf("NewEncoderWriter failed: %v", err)
+				}
+				if err := encoder.Encode(); err != nil {
+					t.Fatalf("Encode failed: %v", err)
+				}
+				data = out.data
+			} else {
+				data = encodeToBuffer(t, input, WithObservedBlockSizes(tt.observed))
+			}
+
+			decoder, err := NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if info := decoder.StreamInfo(); info.MinBlockSize != tt.min || info.MaxBlockSize != tt.max {
+				t.Errorf("expected block sizes %d-%d in STREAMINFO, got %d-%d", tt.min, tt.max, info.MinBlockSize, info.MaxBlockSize)
+			}
+			if decoded := readAllSamples(t, decoder); !reflect.DeepEqual(decoded, samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+}
+
+func TestWithOutputBitDepth(t *testing.T) {
+	// A 24-bit sine, so the 16-bit output is the input's top 16 bits give or
+	// take the dither
+	samples := sineSamples(2*DefaultMinBlockSize+100, 2)
+	for i := range samples {
+		samples[i] <<= 8
+	}
+	data := encodeToBuffer(t, newTestFormat(44100, 2, 24, samples...), WithOutputBitDepth(16))
+
+	decoder, err := NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if bits := decoder.StreamInfo().BitDepth; bits != 16 {
+		t.Errorf("expected a STREAMINFO bit depth of 16, got %d", bits)
+	}
+	// Reading to the end checks the MD5 signature against the 16-bit audio
+	decoded := readAllSamples(t, decoder)
+	if len(decoded) != len(samples) {
+		t.Fatalf("expected %d samples, got %d", len(samples), len(decoded))
+	}
+	for i, s := range decoded {
+		if diff := s - samples[i]>>8; diff < -1 || diff > 1 {
+			t.Fatalf("sample %d: expected %d within 1, got %d", i, samples[i]>>8, s)
+		}
+	}
+
+	// The same depth as the input leaves it untouched
+	if data := encodeToBuffer(t, newTestFormat(44100, 2, 24, samples...), WithOutputBitDepth(24)); !bytes.Equal(data, encodeToBuffer(t, newTestFormat(44100, 2, 24, samples...))) {
+		t.Errorf("expected the input's own bit depth to encode as without the option")
+	}
+
+	for _, bits := range []int{3, 33} {
+		if _, err := NewEncoderWriter(newTestFormat(44100, 2, 24), &bytes.Buffer{}, WithOutputBitDepth(bits)); err == nil {
+			t.Errorf("expected an error for an output bit depth of %d", bits)
+		}
+	}
+	if _, err := NewEncoderWriter(newTestFormat(44100, 2, 16), &bytes.Buffer{}, WithOutputBitDepth(24)); err == nil {
+		t.Errorf("expected an error for an output bit depth above the input's")
+	}
+	encoder, err := NewEncoderWriter(newTestFormat(44100, 2, 24), &bytes.Buffer{}, WithOutputBitDepth(20))
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	if err := encoder.Reset(newTestFormat(44100, 2, 16), &bytes.Buffer{}); err == nil {
+		t.Errorf("expected Reset to reject an input below the output bit depth")
+	}
+}
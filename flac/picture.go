@@ -0,0 +1,89 @@
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // register JPEG for image.DecodeConfig
+	_ "image/png"  // register PNG for image.DecodeConfig
+)
+
+const (
+	metadataPicture = 6
+
+	// MaxPictureType is the highest picture type the format defines
+	// (20, publisher/studio logotype); 3 is the front cover.
+	MaxPictureType = 20
+)
+
+// picture is an image to embed in a PICTURE metadata block.
+type picture struct {
+	pictureType uint32
+	mime        string
+	description string
+	width       uint32 // 0 if unknown
+	height      uint32 // 0 if unknown
+	depth       uint32 // bits per pixel, 0 if unknown
+	colors      uint32 // palette size for indexed images, otherwise 0
+	data        []byte
+}
+
+// newPicture describes an image, filling in its dimensions and colour depth
+// when it decodes as a PNG or JPEG. An empty MIME type is taken from the
+// detected format.
+func newPicture(pictureType uint32, mime, description string, data []byte) (picture, error) {
+	if pictureType > MaxPictureType {
+		return picture{}, fmt.Errorf("invalid picture type %d: must be at most %d", pictureType, MaxPictureType)
+	}
+	for i := 0; i < len(mime); i++ {
+		if mime[i] < 0x20 || mime[i] > 0x7E {
+			return picture{}, fmt.Errorf("invalid MIME type %q: must be printable ASCII", mime)
+		}
+	}
+
+	p := picture{pictureType: pictureType, mime: mime, description: description, data: data}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return p, nil
+	}
+	if p.mime == "" {
+		p.mime = "image/" + format
+	}
+	p.width, p.height = uint32(config.Width), uint32(config.Height)
+	switch model := config.ColorModel.(type) {
+	case color.Palette:
+		p.depth, p.colors = 8, uint32(len(model))
+	default:
+		switch model {
+		case color.GrayModel:
+			p.depth = 8
+		case color.Gray16Model:
+			p.depth = 16
+		case color.YCbCrModel:
+			p.depth = 24
+		case color.RGBAModel, color.NRGBAModel, color.CMYKModel:
+			p.depth = 32
+		case color.RGBA64Model, color.NRGBA64Model:
+			p.depth = 64
+		}
+	}
+	return p, nil
+}
+
+// block returns the body of the PICTURE metadata block. Every field is
+// big-endian, and the MIME type, description and data are length-prefixed.
+func (p picture) block() []byte {
+	var body bytes.Buffer
+	writeData := func(data []byte) {
+		binary.Write(&body, binary.BigEndian, uint32(len(data)))
+		body.Write(data)
+	}
+	binary.Write(&body, binary.BigEndian, p.pictureType)
+	writeData([]byte(p.mime))
+	writeData([]byte(p.description))
+	binary.Write(&body, binary.BigEndian, [4]uint32{p.width, p.height, p.depth, p.colors})
+	writeData(p.data)
+	return body.Bytes()
+}
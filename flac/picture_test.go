@@ -0,0 +1,139 @@
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestWithPicture(t *testing.T) {
+	encode := func(img image.Image, jpg bool) []byte {
+		var buf bytes.Buffer
+		if jpg {
+			jpeg.Encode(&buf, img, nil)
+		} else {
+			png.Encode(&buf, img)
+		}
+		return buf.Bytes()
+	}
+	rgba := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	rgba.Set(0, 0, color.NRGBA{255, 0, 0, 128})
+	paletted := image.NewPaletted(image.Rect(0, 0, 5, 4), color.Palette{color.Black, color.White, color.Gray{128}})
+
+	tests := []struct {
+		name         string
+		pictureType  uint32
+		mime         string
+		data         []byte
+		expectedErr  bool
+		expected     [4]uint32 // width, height, depth, colors
+		expectedMIME string
+	}{
+		{
+			name:         "PNG front cover",
+			pictureType:  3,
+			mime:         "image/png",
+			data:         encode(rgba, false),
+			expected:     [4]uint32{3, 2, 32, 0},
+			expectedMIME: "image/png",
+		},
+		{
+			name:         "Paletted PNG with detected MIME type",
+			pictureType:  3,
+			data:         encode(paletted, false),
+			expected:     [4]uint32{5, 4, 8, 3},
+			expectedMIME: "image/png",
+		},
+		{
+			name:         "JPEG",
+			pictureType:  4,
+			mime:         "image/jpeg",
+			data:         encode(image.NewYCbCr(image.Rect(0, 0, 16, 8), image.YCbCrSubsampleRatio420), true),
+			expected:     [4]uint32{16, 8, 24, 0},
+			expectedMIME: "image/jpeg",
+		},
+		{
+			name:         "Unrecognised image",
+			pictureType:  0,
+			mime:         "image/gif",
+			data:         []byte("GIF89a not really"),
+			expectedMIME: "image/gif",
+		},
+		{
+			name:        "Invalid picture type",
+			pictureType: MaxPictureType + 1,
+			data:        []byte{0},
+			expectedErr: true,
+		},
+		{
+			name:        "Invalid MIME type",
+			pictureType: 3,
+			mime:        "image/\x00",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := newTestFormat(44100, 1, 16, sineSamples(1000, 1)...)
+			var out bytes.Buffer
+			encoder, err := NewEncoderWriter(input, &out, WithPicture(tt.pictureType, tt.mime, "Cover", tt.data))
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if err := encoder.Encode(); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+
+			bodies, _ := metadataBlockBodies(t, out.Bytes())
+			body, ok := bodies[metadataPicture]
+			if !ok {
+				t.Fatalf("expected a PICTURE block")
+			}
+
+			r := bytes.NewReader(body)
+			readUint32 := func() uint32 {
+				var v uint32
+				if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+					t.Fatalf("failed to read PICTURE field: %v", err)
+				}
+				return v
+			}
+			readData := func() []byte {
+				data := make([]byte, readUint32())
+				r.Read(data)
+				return data
+			}
+
+			if got := readUint32(); got != tt.pictureType {
+				t.Errorf("expected picture type %d, got %d", tt.pictureType, got)
+			}
+			if got := string(readData()); got != tt.expectedMIME {
+				t.Errorf("expected MIME type %q, got %q", tt.expectedMIME, got)
+			}
+			if got := string(readData()); got != "Cover" {
+				t.Errorf("expected description %q, got %q", "Cover", got)
+			}
+			var fields [4]uint32
+			for i := range fields {
+				fields[i] = readUint32()
+			}
+			if fields != tt.expected {
+				t.Errorf("expected width, height, depth, colors %v, got %v", tt.expected, fields)
+			}
+			if data := readData(); !bytes.Equal(data, tt.data) {
+				t.Errorf("expected %d bytes of picture data, got %d", len(tt.data), len(data))
+			}
+			if r.Len() != 0 {
+				t.Errorf("expected no trailing bytes, got %d", r.Len())
+			}
+		})
+	}
+}
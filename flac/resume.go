@@ -0,0 +1,152 @@
+package flac
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nooooaaaaah/soundcompression/audio"
+)
+
+// Checkpoint is a point an interrupted encode can resume from: the end of the
+// last whole frame written.
+type Checkpoint struct {
+	Samples uint64 // inter-channel samples encoded in the frames written
+	Offset  int64  // bytes of the stream up to the end of those frames, counted from the "fLaC" marker
+}
+
+// Checkpoint returns the point the encode has reached, updated as each frame
+// is written. It is meant to be called from a WithProgress callback, to log
+// how far an encode got; ResumeEncoder finds the point again by itself.
+func (e *Encoder) Checkpoint() Checkpoint {
+	return Checkpoint{Samples: e.samplesDone, Offset: int64(e.headerBytes + e.frameBytes)}
+}
+
+// ResumeEncoder reopens the FLAC file at outputPath, left incomplete by an
+// encode of input that was interrupted, such as by a crash or a failing disk,
+// and returns an Encoder whose Encode carries on from the last whole frame in
+// the file. The frames are read back to recount their samples and rebuild the
+// MD5 signature, frame sizes and seek table; anything after the last frame
+// that decodes intact and continues the stream is truncated away, and input
+// is seeked to the first sample not yet encoded. A read that fails while the
+// frames are read back is returned without truncating the file. input must implement audio.Seeker, and input and
+// opts must be the ones the interrupted encode was given: a header or format
+// that differs from what they produce is an error. The resumed file is then
+// identical to the one an uninterrupted encode would have written, except
+// that WithOutputBitDepth dithers the resumed part differently.
+func ResumeEncoder(input audio.Format, outputPath string, opts ...Option) (*Encoder, error) {
+	encoder, err := NewEncoderWriter(input, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	seeker, ok := encoder.input.(audio.Seeker)
+	if !ok {
+		return nil, fmt.Errorf("cannot resume an encode of an input that cannot seek")
+	}
+
+	file, err := os.OpenFile(outputPath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error opening output file: %w", err)
+	}
+	if err := encoder.resume(file, seeker); err != nil {
+		file.Close()
+		return nil, err
+	}
+	encoder.output = file
+	encoder.outputPath = outputPath
+	return encoder, nil
+}
+
+// resumeFile is the output a resumed encode reads back, truncates and goes
+// on writing, an *os.File outside of tests.
+type resumeFile interface {
+	io.ReadWriteSeeker
+	Truncate(size int64) error
+}
+
+// readErrorRecorder passes reads through, keeping the first error other than
+// io.EOF, so a read that fails can be told apart from a stream that ends.
+type readErrorRecorder struct {
+	io.Reader
+	err error
+}
+
+func (r *readErrorRecorder) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
+
+// resume reads back the stream in file, positioning file and the input after
+// its last intact frame and setting the Encoder up to continue from there. A
+// read that fails is returned as is, leaving file untouched.
+func (e *Encoder) resume(file resumeFile, seeker audio.Seeker) error {
+	// Build the header again, without writing it, for the offsets of the
+	// frames and of the seek table
+	e.output = file
+	e.beginStream()
+	e.pending = new(bytes.Buffer)
+	if err := e.writeStreamHeader(); err != nil {
+		return fmt.Errorf("error building stream header: %w", err)
+	}
+	e.pending = nil
+
+	reader := &readErrorRecorder{Reader: file}
+	decoder, err := NewDecoder(bufio.NewReader(reader))
+	if err != nil {
+		return fmt.Errorf("error reading stream to resume: %w", err)
+	}
+	// Until the first frame header is read, the record holds the whole header
+	if size := uint64(len(decoder.br.record)); size != e.headerBytes {
+		return fmt.Errorf("stream header of %d bytes differs from the %d bytes the options give", size, e.headerBytes)
+	}
+	info := decoder.StreamInfo()
+	if info.SampleRate != e.input.SampleRate() || info.Channels != e.input.Channels() || info.BitDepth != e.input.BitDepth() {
+		return fmt.Errorf("stream of %d Hz, %d channels and %d bits does not match the input's %d Hz, %d channels and %d bits",
+			info.SampleRate, info.Channels, info.BitDepth, e.input.SampleRate(), e.input.Channels(), e.input.BitDepth())
+	}
+
+	// Replay every frame up to where the interrupted encode stopped writing:
+	// the end of the file, a frame it tore that fails to decode, or a stale
+	// one, left by an earlier encode, that does not continue the stream
+	for {
+		frame, samples, err := decoder.decodeFrame()
+		if reader.err != nil {
+			return fmt.Errorf("error reading stream to resume: %w", reader.err)
+		}
+		if err != nil {
+			break
+		}
+		expected := e.frameNumber
+		if e.variableBlockSize {
+			expected = e.samplesDone
+		}
+		if frame.number != expected {
+			break
+		}
+		e.updateMD5(samples)
+		e.countFrame(frame.blockSize, len(decoder.br.record))
+		e.samplesDone += uint64(frame.blockSize)
+	}
+
+	offset := e.Checkpoint().Offset
+	if err := file.Truncate(offset); err != nil {
+		return fmt.Errorf("error truncating output file: %w", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking output file: %w", err)
+	}
+	if err := seeker.Seek(e.samplesDone); err != nil {
+		return fmt.Errorf("error seeking input to sample %d: %w", e.samplesDone, err)
+	}
+
+	if e.logging {
+		e.logger.Info("Resuming encode", "samples", e.samplesDone, "offset", offset)
+	}
+	e.resuming = true
+	return nil
+}
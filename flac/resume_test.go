@@ -0,0 +1,237 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nooooaaaaah/soundcompression/audio"
+)
+
+// interruptedFormat fails every read once failAfter values have been read,
+// stopping an encode as a crash would.
+type interruptedFormat struct {
+	*audio.MemoryFormat
+	failAfter int
+	read      int
+}
+
+func (f *interruptedFormat) ReadSamples(buffer []int32) (int, error) {
+	if f.read >= f.failAfter {
+		return 0, errInjected
+	}
+	if len(buffer) > f.failAfter-f.read {
+		buffer = buffer[:f.failAfter-f.read]
+	}
+	n, err := f.MemoryFormat.ReadSamples(buffer)
+	f.read += n
+	return n, err
+}
+
+// failingReadFile is a file whose reads fail once limit bytes have been read.
+type failingReadFile struct {
+	*os.File
+	limit int64
+	read  int64
+}
+
+func (f *failingReadFile) Read(p []byte) (int, error) {
+	if f.read >= f.limit {
+		return 0, errInjected
+	}
+	if int64(len(p)) > f.limit-f.read {
+		p = p[:f.limit-f.read]
+	}
+	n, err := f.File.Read(p)
+	f.read += int64(n)
+	return n, err
+}
+
+// encodeFile encodes input to path with opts, returning Encode's error.
+func encodeFile(t *testing.T, input audio.Format, path string, opts ...Option) error {
+	t.Helper()
+	encoder, err := NewEncoder(input, path, opts...)
+	if err != nil {
+		t.Fatalf("NewEncoder failed: %v", err)
+	}
+	defer encoder.Close()
+	return encoder.Encode()
+}
+
+func TestResumeEncoder(t *testing.T) {
+	samples := sineSamples(10*DefaultMinBlockSize+777, 2)
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		failAfter int  // values read before the interruption
+		cut       int  // bytes torn off the end of the interrupted file
+		stale     bool // whether the frames written are repeated after the last, as an earlier encode could leave them
+	}{
+		{name: "Torn last frame", failAfter: 2 * 6 * DefaultMinBlockSize, cut: 100},
+		{name: "Stale frames", failAfter: 2 * 5 * DefaultMinBlockSize, stale: true},
+		{name: "Stale variable block size frames", opts: []Option{WithVariableBlockSize(true)}, failAfter: 2 * 5 * DefaultMinBlockSize, stale: true},
+		{
+			name:      "Seek table and tags",
+			opts:      []Option{WithSeekTable(0.1), WithTags(map[string]string{"TITLE": "Resumed"})},
+			failAfter: 2 * 4 * DefaultMinBlockSize,
+		},
+		{name: "Variable block size", opts: []Option{WithVariableBlockSize(true)}, failAfter: 2 * 3 * DefaultMinBlockSize},
+		{name: "Header only", failAfter: 0},
+		{name: "Finished but for STREAMINFO", failAfter: len(samples)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			wholePath, resumedPath := filepath.Join(dir, "whole.flac"), filepath.Join(dir, "resumed.flac")
+			if err := encodeFile(t, newTestFormat(44100, 2, 16, samples...), wholePath, tt.opts...); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+
+			interrupted := &interruptedFormat{MemoryFormat: newTestFormat(44100, 2, 16, samples...), failAfter: tt.failAfter}
+			if err := encodeFile(t, interrupted, resumedPath, tt.opts...); err == nil {
+				t.Fatalf("expected the interrupted encode to fail")
+			}
+			if tt.cut > 0 {
+				info, err := os.Stat(resumedPath)
+				if err != nil {
+					t.Fatalf("failed to stat the interrupted file: %v", err)
+				}
+				if err := os.Truncate(resumedPath, info.Size()-int64(tt.cut)); err != nil {
+					t.Fatalf("failed to tear the last frame: %v", err)
+				}
+			}
+			if tt.stale {
+				data, err := os.ReadFile(resumedPath)
+				if err != nil {
+					t.Fatalf("failed to read the interrupted file: %v", err)
+				}
+				// Until the first frame header is read, the record holds the whole header
+				decoder, err := NewDecoder(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("NewDecoder failed: %v", err)
+				}
+				data = append(data, data[len(decoder.br.record):]...)
+				if err := os.WriteFile(resumedPath, data, 0o644); err != nil {
+					t.Fatalf("failed to repeat the frames: %v", err)
+				}
+			}
+
+			encoder, err := ResumeEncoder(newTestFormat(44100, 2, 16, samples...), resumedPath, tt.opts...)
+			if err != nil {
+				t.Fatalf("ResumeEncoder failed: %v", err)
+			}
+			checkpoint := encoder.Checkpoint()
+			if checkpoint.Samples%DefaultMinBlockSize != 0 || checkpoint.Samples > uint64(tt.failAfter/2) {
+				t.Errorf("expected to resume from a whole block at most %d samples in, got %+v", tt.failAfter/2, checkpoint)
+			}
+			if err := encoder.Encode(); err != nil {
+				t.Fatalf("resumed Encode failed: %v", err)
+			}
+			if err := encoder.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			whole, err := os.ReadFile(wholePath)
+			if err != nil {
+				t.Fatalf("failed to read the uninterrupted file: %v", err)
+			}
+			resumed, err := os.ReadFile(resumedPath)
+			if err != nil {
+				t.Fatalf("failed to read the resumed file: %v", err)
+			}
+			if !bytes.Equal(resumed, whole) {
+				t.Errorf("expected the %d bytes of the uninterrupted encode, got %d differing bytes", len(whole), len(resumed))
+			}
+
+			// readAllSamples fails on an MD5 mismatch
+			decoder, err := NewDecoder(bytes.NewReader(resumed))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if decoded := readAllSamples(t, decoder); !reflect.DeepEqual(decoded, samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+}
+
+func TestResumeEncoderReadError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "partial.flac")
+	samples := sineSamples(10*DefaultMinBlockSize, 2)
+	interrupted := &interruptedFormat{MemoryFormat: newTestFormat(44100, 2, 16, samples...), failAfter: 2 * 6 * DefaultMinBlockSize}
+	if err := encodeFile(t, interrupted, path); err == nil {
+		t.Fatalf("expected the interrupted encode to fail")
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the interrupted file: %v", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("failed to open the interrupted file: %v", err)
+	}
+	defer file.Close()
+	input := newTestFormat(44100, 2, 16, samples...)
+	encoder, err := NewEncoderWriter(input, nil)
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	// Fail partway through the frames, well before the end of the stream
+	if err := encoder.resume(&failingReadFile{File: file, limit: int64(len(before) / 2)}, input); !errors.Is(err, errInjected) {
+		t.Fatalf("expected the injected read error, got %v", err)
+	}
+	if after, err := os.ReadFile(path); err != nil || !bytes.Equal(after, before) {
+		t.Errorf("expected the %d bytes of the interrupted file to be left as they were, got %d (%v)", len(before), len(after), err)
+	}
+
+	// The file is still whole, so resuming without the failure finds every frame
+	resumed, err := ResumeEncoder(newTestFormat(44100, 2, 16, samples...), path)
+	if err != nil {
+		t.Fatalf("ResumeEncoder failed: %v", err)
+	}
+	defer resumed.Close()
+	if got := resumed.Checkpoint().Samples; got != 6*DefaultMinBlockSize {
+		t.Errorf("expected to resume from sample %d, got %d", 6*DefaultMinBlockSize, got)
+	}
+}
+
+func TestResumeEncoderErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "partial.flac")
+	samples := sineSamples(3*DefaultMinBlockSize, 2)
+	interrupted := &interruptedFormat{MemoryFormat: newTestFormat(44100, 2, 16, samples...), failAfter: 2 * DefaultMinBlockSize}
+	if err := encodeFile(t, interrupted, path, WithTags(map[string]string{"TITLE": "Partial"})); err == nil {
+		t.Fatalf("expected the interrupted encode to fail")
+	}
+	notFLAC := filepath.Join(dir, "not.flac")
+	if err := os.WriteFile(notFLAC, []byte("not a FLAC file"), 0o644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		input audio.Format
+		path  string
+		opts  []Option
+	}{
+		{name: "Different options", input: newTestFormat(44100, 2, 16, samples...), path: path},
+		{name: "Different input", input: newTestFormat(48000, 2, 16, samples...), path: path, opts: []Option{WithTags(map[string]string{"TITLE": "Partial"})}},
+		{name: "Input that cannot seek", input: struct{ audio.Format }{newTestFormat(44100, 2, 16, samples...)}, path: path},
+		{name: "Not FLAC", input: newTestFormat(44100, 2, 16, samples...), path: notFLAC},
+		{name: "Missing file", input: newTestFormat(44100, 2, 16, samples...), path: filepath.Join(dir, "missing.flac")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ResumeEncoder(tt.input, tt.path, tt.opts...); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
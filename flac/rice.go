@@ -0,0 +1,293 @@
+package flac
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+const (
+	// Residual coding methods, stored in the first 2 bits of a coded residual.
+	riceMethod4Bit = 0 // partitioned Rice code with 4-bit parameters
+	riceMethod5Bit = 1 // partitioned Rice code with 5-bit parameters
+
+	riceEscape4Bit   = 0xF  // escape code for 4-bit parameters
+	riceEscape5Bit   = 0x1F // escape code for 5-bit parameters
+	riceRawBitsWidth = 5    // width of the raw bits field following an escape code
+
+	riceMethodBits         = 2
+	ricePartitionOrderBits = 4
+)
+
+// riceCoding describes how a residual partition is coded: the method, the Rice
+// parameter (or escape with a raw sample width), the number of residuals and
+// the resulting size in bits.
+type riceCoding struct {
+	method  int
+	param   int
+	escaped bool
+	rawBits int
+	count   int
+	bits    int
+}
+
+// paramBits returns the width of the parameter field for the coding method.
+func (c riceCoding) paramBits() int {
+	if c.method == riceMethod5Bit {
+		return 5
+	}
+	return 4
+}
+
+// escapeCode returns the parameter value signalling an escaped partition.
+func (c riceCoding) escapeCode() int {
+	if c.method == riceMethod5Bit {
+		return riceEscape5Bit
+	}
+	return riceEscape4Bit
+}
+
+// zigzag folds a signed residual into an unsigned value: 0, -1, 1, -2, 2 ... map to 0, 1, 2, 3, 4 ...
+func zigzag(r int32) uint32 {
+	return uint32(r<<1) ^ uint32(r>>31)
+}
+
+// estimateRiceParameter estimates the Rice parameter from the mean of the folded residual.
+func estimateRiceParameter(residual []int32) int {
+	if len(residual) == 0 {
+		return 0
+	}
+	var sum uint64
+	for _, r := range residual {
+		sum += uint64(zigzag(r))
+	}
+	mean := sum / uint64(len(residual))
+	if mean == 0 {
+		return 0
+	}
+	return bits.Len64(mean) - 1
+}
+
+// riceBits returns the number of bits needed to Rice code the residual with parameter k.
+func riceBits(residual []int32, k int) int {
+	total := 0
+	for _, r := range residual {
+		total += int(zigzag(r)>>uint(k)) + 1 + k
+	}
+	return total
+}
+
+// rawResidualBits returns the smallest signed width that holds every residual,
+// which is 0 when all residuals are zero.
+func rawResidualBits(residual []int32) int {
+	width := 0
+	for _, r := range residual {
+		if r == 0 {
+			continue
+		}
+		v := uint32(r)
+		if r < 0 {
+			v = ^v
+		}
+		if n := bits.Len32(v) + 1; n > width {
+			width = n
+		}
+	}
+	return width
+}
+
+// riceMethodFor returns the coding method a residual needs: 5-bit parameters
+// once the estimated parameter reaches the 4-bit escape code.
+func riceMethodFor(residual []int32) int {
+	if estimateRiceParameter(residual) >= riceEscape4Bit {
+		return riceMethod5Bit
+	}
+	return riceMethod4Bit
+}
+
+// bestRiceParameter tries every parameter below limit and returns the one
+// that codes the residual in the fewest bits; ties go to the lower parameter.
+func bestRiceParameter(residual []int32, limit int) int {
+	best, bestBits := 0, riceBits(residual, 0)
+	for k := 1; k < limit; k++ {
+		if bits := riceBits(residual, k); bits < bestBits {
+			best, bestBits = k, bits
+		}
+	}
+	return best
+}
+
+// planPartition picks the Rice parameter for one partition coded with the
+// given method, estimated from the mean or, with exhaustive search, the best
+// of every parameter the method can code, and works out whether storing it
+// escaped as raw binary would be cheaper.
+func planPartition(residual []int32, method int, exhaustive bool) riceCoding {
+	c := riceCoding{method: method, count: len(residual)}
+	if exhaustive {
+		c.param = bestRiceParameter(residual, c.escapeCode())
+	} else {
+		c.param = min(estimateRiceParameter(residual), c.escapeCode()-1)
+	}
+	c.bits = c.paramBits() + riceBits(residual, c.param)
+
+	// The raw width field tops out at 31 bits, too narrow for some 32-bit residuals
+	rawBits := rawResidualBits(residual)
+	if escaped := c.paramBits() + riceRawBitsWidth + rawBits*len(residual); escaped < c.bits && rawBits < 1<<riceRawBitsWidth {
+		c.escaped = true
+		c.param = c.escapeCode()
+		c.rawBits = rawBits
+		c.bits = escaped
+	}
+	return c
+}
+
+// planResidual plans a residual coded as a single partition with an estimated
+// parameter.
+func planResidual(residual []int32) riceCoding {
+	return planPartition(residual, riceMethodFor(residual), false)
+}
+
+// residualCoding describes a partitioned residual: the method shared by every
+// partition, the partition order and each partition's coding.
+type residualCoding struct {
+	method         int
+	partitionOrder int
+	partitions     []riceCoding
+	bits           int // total size, including the method and partition order fields
+}
+
+// planPartitions plans the residual of a block of blockSize samples, whose
+// first predictorOrder samples are warm-up samples, split into 2^order
+// partitions. The first partition is shorter by the warm-up samples.
+// Exhaustive search tries every Rice parameter for each partition.
+func planPartitions(residual []int32, predictorOrder, order int, exhaustive bool) residualCoding {
+	blockSize := len(residual) + predictorOrder
+	partitionSize := blockSize >> order
+	bounds := make([][]int32, 1<<order)
+	start := 0
+	for p := range bounds {
+		end := (p+1)*partitionSize - predictorOrder
+		bounds[p] = residual[start:end]
+		start = end
+	}
+
+	// Every partition shares one method, so one needing 5-bit parameters
+	// forces them all to 5 bits.
+	method := riceMethod4Bit
+	for _, part := range bounds {
+		if riceMethodFor(part) == riceMethod5Bit {
+			method = riceMethod5Bit
+			break
+		}
+	}
+
+	rc := residualCoding{method: method, partitionOrder: order, bits: riceMethodBits + ricePartitionOrderBits}
+	rc.partitions = make([]riceCoding, len(bounds))
+	for p, part := range bounds {
+		rc.partitions[p] = planPartition(part, method, exhaustive)
+		rc.bits += rc.partitions[p].bits
+	}
+	return rc
+}
+
+// validPartitionOrder reports whether a block of blockSize samples can be
+// split into 2^order equal partitions, each longer than the predictor's warm-up.
+func validPartitionOrder(blockSize, predictorOrder, order int) bool {
+	return blockSize%(1<<order) == 0 && blockSize>>order > predictorOrder
+}
+
+// planResidualPartitions tries every partition order up to maxOrder and
+// returns the smallest coding; ties go to the lower order.
+func planResidualPartitions(residual []int32, predictorOrder, maxOrder int, exhaustive bool) residualCoding {
+	blockSize := len(residual) + predictorOrder
+	best := planPartitions(residual, predictorOrder, 0, exhaustive)
+	for order := 1; order <= maxOrder && validPartitionOrder(blockSize, predictorOrder, order); order++ {
+		if rc := planPartitions(residual, predictorOrder, order, exhaustive); rc.bits < best.bits {
+			best = rc
+		}
+	}
+	return best
+}
+
+// maxValidPartitionOrder returns the highest partition order up to maxOrder
+// that a block of blockSize samples can be split into.
+func maxValidPartitionOrder(blockSize, predictorOrder, maxOrder int) int {
+	order := 0
+	for order < maxOrder && validPartitionOrder(blockSize, predictorOrder, order+1) {
+		order++
+	}
+	return order
+}
+
+// planResidualCoding plans the coding of a subframe's residual. With partition
+// search it tries every order up to the encoder's maximum; without, it
+// settles for the highest order the block allows, which is quicker and
+// usually close. Rice parameters are estimated unless WithExhaustiveRiceSearch
+// asks for every parameter to be tried.
+func (e *Encoder) planResidualCoding(residual []int32, predictorOrder int) residualCoding {
+	if e.partitionSearch {
+		return planResidualPartitions(residual, predictorOrder, e.maxPartitionOrder, e.exhaustiveRice)
+	}
+	blockSize := len(residual) + predictorOrder
+	return planPartitions(residual, predictorOrder, maxValidPartitionOrder(blockSize, predictorOrder, e.maxPartitionOrder), e.exhaustiveRice)
+}
+
+// readResidual decodes a partitioned Rice coded residual into samples[order:],
+// the first order samples being the subframe's warm-up samples.
+func readResidual(br *BitReader, samples []int32, order int) error {
+	method, err := br.ReadBits(riceMethodBits)
+	if err != nil {
+		return err
+	}
+	if method != riceMethod4Bit && method != riceMethod5Bit {
+		return fmt.Errorf("reserved residual coding method %d", method)
+	}
+	c := riceCoding{method: int(method)}
+
+	partitionOrder, err := br.ReadBits(ricePartitionOrderBits)
+	if err != nil {
+		return err
+	}
+	partitions := 1 << partitionOrder
+	partitionSize := len(samples) >> partitionOrder
+	if partitionSize<<partitionOrder != len(samples) || partitionSize < order {
+		return fmt.Errorf("partition order %d does not fit block size %d with predictor order %d", partitionOrder, len(samples), order)
+	}
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		end := (p + 1) * partitionSize
+		param, err := br.ReadBits(uint(c.paramBits()))
+		if err != nil {
+			return err
+		}
+
+		if int(param) == c.escapeCode() {
+			rawBits, err := br.ReadBits(riceRawBitsWidth)
+			if err != nil {
+				return err
+			}
+			for ; i < end; i++ {
+				v, err := br.ReadSignedBits(uint(rawBits))
+				if err != nil {
+					return err
+				}
+				samples[i] = int32(v)
+			}
+			continue
+		}
+
+		for ; i < end; i++ {
+			q, err := br.ReadUnary()
+			if err != nil {
+				return err
+			}
+			r, err := br.ReadBits(uint(param))
+			if err != nil {
+				return err
+			}
+			u := uint32(q<<param | r)
+			samples[i] = int32(u>>1) ^ -int32(u&1)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package flac
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// testBitReader reads MSB-first bits back out of a packed byte slice.
+type testBitReader struct {
+	buf []byte
+	pos uint
+}
+
+func (r *testBitReader) readBits(n uint) uint64 {
+	var v uint64
+	for ; n > 0; n-- {
+		bit := r.buf[r.pos/8] >> (7 - r.pos%8) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+	return v
+}
+
+func (r *testBitReader) readUnary() uint64 {
+	var n uint64
+	for r.readBits(1) == 0 {
+		n++
+	}
+	return n
+}
+
+func TestEncodeResidual(t *testing.T) {
+	tests := []struct {
+		name          string
+		residual      []int32
+		expectedParam int
+		expectedBits  int
+		expectEscape  bool
+	}{
+		{
+			name:          "All zero",
+			residual:      []int32{0, 0, 0, 0},
+			expectedParam: 0,
+			expectedBits:  8,
+		},
+		{
+			name:          "Small alternating",
+			residual:      []int32{1, -1, 2, -2},
+			expectedParam: 1,
+			expectedBits:  16,
+		},
+		{
+			name:          "Flat residual cheaper escaped",
+			residual:      []int32{7, 7, 7, 7, 7, 7, 7, 7},
+			expectedParam: riceEscape4Bit,
+			expectedBits:  41,
+			expectEscape:  true,
+		},
+		{
+			name:          "Large residual needs 5-bit parameter",
+			residual:      []int32{1 << 20, 1 << 20},
+			expectedParam: 21,
+			expectedBits:  51,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder := &Encoder{logging: false}
+
+			c := planResidual(tt.residual)
+			if c.bits != tt.expectedBits {
+				t.Errorf("expected %d bits, got %d", tt.expectedBits, c.bits)
+			}
+			if c.escaped != tt.expectEscape {
+				t.Errorf("expected escaped to be %v, got %v", tt.expectEscape, c.escaped)
+			}
+
+			var buf bytes.Buffer
+			bw := NewBitWriter(&buf)
+			rc := planResidualPartitions(tt.residual, 0, 0, false)
+			encoder.encodeResidual(bw, tt.residual, rc)
+			param := rc.partitions[0].param
+			if err := bw.Flush(); err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+			data := buf.Bytes()
+			if param != tt.expectedParam {
+				t.Errorf("expected parameter %d, got %d", tt.expectedParam, param)
+			}
+			totalBits := riceMethodBits + ricePartitionOrderBits + tt.expectedBits
+			if expectedLen := (totalBits + 7) / 8; len(data) != expectedLen {
+				t.Fatalf("expected %d bytes, got %d", expectedLen, len(data))
+			}
+
+			// Decode the bitstream back to check the codes themselves.
+			r := &testBitReader{buf: data}
+			paramBits := uint(4)
+			if r.readBits(riceMethodBits) == riceMethod5Bit {
+				paramBits = 5
+			}
+			if order := r.readBits(ricePartitionOrderBits); order != 0 {
+				t.Fatalf("expected partition order 0, got %d", order)
+			}
+			if got := int(r.readBits(paramBits)); got != tt.expectedParam {
+				t.Fatalf("expected parameter %d in stream, got %d", tt.expectedParam, got)
+			}
+			rawBits := uint(0)
+			if tt.expectEscape {
+				rawBits = uint(r.readBits(riceRawBitsWidth))
+			}
+			for i, want := range tt.residual {
+				var got int32
+				if tt.expectEscape {
+					got = int32(r.readBits(rawBits)<<(32-rawBits)) >> (32 - rawBits)
+				} else {
+					u := r.readUnary()<<uint(param) | r.readBits(uint(param))
+					got = int32(u>>1) ^ -int32(u&1)
+				}
+				if got != want {
+					t.Errorf("residual %d: expected %d, got %d", i, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPlanResidualPartitions(t *testing.T) {
+	// A loud first half followed by a quiet second half
+	loudQuiet := make([]int32, 4096)
+	for i := range loudQuiet {
+		if i < len(loudQuiet)/2 {
+			loudQuiet[i] = int32((i*7919)%4001 - 2000)
+		} else {
+			loudQuiet[i] = int32(i%3 - 1)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		samples        []int32
+		predictorOrder int
+		maxOrder       int
+		expectOrder    func(order int) bool
+	}{
+		{
+			name:           "Loud half and quiet half",
+			samples:        loudQuiet,
+			predictorOrder: 0,
+			maxOrder:       4,
+			expectOrder:    func(order int) bool { return order > 0 },
+		},
+		{
+			name:           "Loud half and quiet half after warm-up",
+			samples:        loudQuiet,
+			predictorOrder: 2,
+			maxOrder:       8,
+			expectOrder:    func(order int) bool { return order > 0 },
+		},
+		{
+			name:        "Order limited to 0",
+			samples:     loudQuiet,
+			maxOrder:    0,
+			expectOrder: func(order int) bool { return order == 0 },
+		},
+		{
+			// 6 samples split evenly only once, and the order 2 predictor
+			// needs partitions longer than its warm-up
+			name:           "Order limited by block size",
+			samples:        []int32{5000, -5000, 1, 0, 1, 0},
+			predictorOrder: 2,
+			maxOrder:       15,
+			expectOrder:    func(order int) bool { return order <= 1 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			residual := tt.samples[tt.predictorOrder:]
+			rc := planResidualPartitions(residual, tt.predictorOrder, tt.maxOrder, false)
+			if !tt.expectOrder(rc.partitionOrder) {
+				t.Fatalf("unexpected partition order %d", rc.partitionOrder)
+			}
+			if single := planPartitions(residual, tt.predictorOrder, 0, false); rc.bits > single.bits {
+				t.Errorf("expected at most %d bits, the single partition size, got %d", single.bits, rc.bits)
+			} else if rc.partitionOrder > 0 && rc.bits >= single.bits {
+				t.Errorf("expected order %d to beat %d bits, got %d", rc.partitionOrder, single.bits, rc.bits)
+			}
+
+			// The planned size is what gets written, and it decodes back.
+			encoder := &Encoder{logging: false}
+			var buf bytes.Buffer
+			bw := NewBitWriter(&buf)
+			encoder.encodeResidual(bw, residual, rc)
+			if bw.count != int64(rc.bits) {
+				t.Errorf("expected %d bits written, got %d", rc.bits, bw.count)
+			}
+			if err := bw.Flush(); err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+
+			decoded := make([]int32, len(tt.samples))
+			if err := readResidual(NewBitReader(&buf), decoded, tt.predictorOrder); err != nil {
+				t.Fatalf("readResidual failed: %v", err)
+			}
+			if !reflect.DeepEqual(decoded[tt.predictorOrder:], residual) {
+				t.Errorf("decoded residual differs from the input")
+			}
+		})
+	}
+}
+
+func TestExhaustiveRiceSearch(t *testing.T) {
+	// Mostly small values with rare spikes: the mean overestimates the parameter
+	spiky := make([]int32, 64)
+	for i := range spiky {
+		spiky[i] = 1
+		if i%32 == 0 {
+			spiky[i] = 100
+		}
+	}
+	noise := make([]int32, 1024)
+	for i := range noise {
+		noise[i] = int32(i*7919%2001 - 1000)
+	}
+
+	tests := []struct {
+		name          string
+		residual      []int32
+		expectSmaller bool
+	}{
+		{name: "Spiky", residual: spiky, expectSmaller: true},
+		{name: "Noise", residual: noise},
+		{name: "Sine", residual: sineSamples(1024, 1)},
+		{name: "Silence", residual: make([]int32, 256)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			estimated := planResidualPartitions(tt.residual, 0, 0, false)
+			exhaustive := planResidualPartitions(tt.residual, 0, 0, true)
+			if exhaustive.bits > estimated.bits {
+				t.Errorf("expected exhaustive search to take at most the estimate's %d bits, got %d", estimated.bits, exhaustive.bits)
+			}
+			if tt.expectSmaller && exhaustive.bits >= estimated.bits {
+				t.Errorf("expected exhaustive search to beat the estimate's %d bits, got %d", estimated.bits, exhaustive.bits)
+			}
+
+			// The planned size is what gets written, and it decodes back.
+			encoder := &Encoder{logging: false}
+			var buf bytes.Buffer
+			bw := NewBitWriter(&buf)
+			encoder.encodeResidual(bw, tt.residual, exhaustive)
+			if bw.count != int64(exhaustive.bits) {
+				t.Errorf("expected %d bits written, got %d", exhaustive.bits, bw.count)
+			}
+			if err := bw.Flush(); err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+			decoded := make([]int32, len(tt.residual))
+			if err := readResidual(NewBitReader(&buf), decoded, 0); err != nil {
+				t.Fatalf("readResidual failed: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.residual) {
+				t.Errorf("decoded residual differs from the input")
+			}
+		})
+	}
+}
+
+func TestWithExhaustiveRiceSearch(t *testing.T) {
+	samples := sineSamples(3*DefaultMinBlockSize+100, 2)
+	estimated := encodeToBuffer(t, newTestFormat(44100, 2, 16, samples...))
+	exhaustive := encodeToBuffer(t, newTestFormat(44100, 2, 16, samples...), WithExhaustiveRiceSearch(true))
+	if len(exhaustive) > len(estimated) {
+		t.Errorf("expected exhaustive search to take at most %d bytes, got %d", len(estimated), len(exhaustive))
+	}
+
+	decoder, err := NewDecoder(bytes.NewReader(exhaustive))
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if decoded := readAllSamples(t, decoder); !reflect.DeepEqual(decoded, samples) {
+		t.Errorf("decoded samples differ from the input")
+	}
+}
@@ -0,0 +1,73 @@
+package flac
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+const (
+	metadataSeekTable = 3
+
+	// seekPointSize is the size of one seek point: a 64-bit sample number, a
+	// 64-bit byte offset and a 16-bit frame sample count.
+	seekPointSize = 18
+
+	// placeholderSeekPoint is the sample number marking an unused seek point.
+	placeholderSeekPoint = math.MaxUint64
+)
+
+// seekPoint points a player at the frame holding a sample.
+type seekPoint struct {
+	sample  uint64 // first sample of the target frame
+	offset  uint64 // byte offset of the frame from the first frame header
+	samples uint16 // number of samples per channel in the frame
+}
+
+// seekTable collects seek points while a stream is encoded. Its size is fixed
+// when the header is written and its points are filled in at the end.
+type seekTable struct {
+	interval uint64 // samples per channel between seek targets
+	count    int    // number of points reserved in the block
+	points   []seekPoint
+	next     uint64 // sample number of the next seek target
+	offset   int64  // offset of the block body from the start of the stream
+}
+
+// newSeekTable plans a seek table with a point every intervalSeconds for a
+// stream of totalSamples at sampleRate.
+func newSeekTable(intervalSeconds float64, sampleRate int, totalSamples uint64) *seekTable {
+	interval := uint64(math.Round(intervalSeconds * float64(sampleRate)))
+	if interval == 0 {
+		interval = 1
+	}
+	return &seekTable{interval: interval, count: int((totalSamples + interval - 1) / interval)}
+}
+
+// addFrame records seek points for every target falling in a frame of
+// blockSize samples starting at firstSample. Targets sharing a frame share a
+// single point, since seek points must be unique.
+func (t *seekTable) addFrame(firstSample uint64, blockSize int, offset uint64) {
+	end := firstSample + uint64(blockSize)
+	for t.next < end && len(t.points) < t.count {
+		if n := len(t.points); n == 0 || t.points[n-1].sample != firstSample {
+			t.points = append(t.points, seekPoint{sample: firstSample, offset: offset, samples: uint16(blockSize)})
+		}
+		t.next += t.interval
+	}
+}
+
+// block returns the SEEKTABLE body, with placeholders after the points found.
+func (t *seekTable) block() []byte {
+	body := make([]byte, t.count*seekPointSize)
+	for i := 0; i < t.count; i++ {
+		p := seekPoint{sample: placeholderSeekPoint}
+		if i < len(t.points) {
+			p = t.points[i]
+		}
+		entry := body[i*seekPointSize:]
+		binary.BigEndian.PutUint64(entry[0:8], p.sample)
+		binary.BigEndian.PutUint64(entry[8:16], p.offset)
+		binary.BigEndian.PutUint16(entry[16:18], p.samples)
+	}
+	return body
+}
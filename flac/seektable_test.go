@@ -0,0 +1,146 @@
+package flac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// metadataBlockBodies walks the metadata blocks of an encoded stream and
+// returns their bodies by type, along with the offset of the first frame.
+func metadataBlockBodies(t *testing.T, data []byte) (map[int][]byte, int) {
+	t.Helper()
+	bodies := make(map[int][]byte)
+	offset := len(FlacMarker)
+	for {
+		if offset+4 > len(data) {
+			t.Fatalf("metadata runs past the end of the stream")
+		}
+		header := data[offset:]
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		bodies[int(header[0]&^LastMetadataBlock)] = data[offset+4 : offset+4+length]
+		offset += 4 + length
+		if header[0]&LastMetadataBlock != 0 {
+			return bodies, offset
+		}
+	}
+}
+
+func TestWithSeekTable(t *testing.T) {
+	const seconds = 10
+
+	tests := []struct {
+		name           string
+		interval       float64
+		file           bool
+		expectedPoints int
+		expectedUnique int
+	}{
+		{
+			name:           "Every 2 seconds to a buffer",
+			interval:       2,
+			expectedPoints: seconds / 2,
+			expectedUnique: seconds / 2,
+		},
+		{
+			name:           "Every 2 seconds to a file",
+			interval:       2,
+			file:           true,
+			expectedPoints: seconds / 2,
+			expectedUnique: seconds / 2,
+		},
+		{
+			name:           "Every 1.5 seconds",
+			interval:       1.5,
+			expectedPoints: 7,
+			expectedUnique: 7,
+		},
+		{
+			// Targets closer together than a frame share the frame's point;
+			// the rest of the table is placeholders.
+			name:           "Interval shorter than a frame",
+			interval:       0.05,
+			expectedPoints: seconds * 20,
+			expectedUnique: (seconds*44100 + DefaultMinBlockSize - 1) / DefaultMinBlockSize,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := sineSamples(seconds*44100, 2)
+			input := newTestFormat(44100, 2, 16, samples...)
+
+			var data []byte
+			if tt.file {
+				path := t.TempDir() + "/seektable.flac"
+				encoder, err := NewEncoder(input, path, WithSeekTable(tt.interval))
+				if err != nil {
+					t.Fatalf("NewEncoder failed: %v", err)
+				}
+				if err := encoder.Encode(); err != nil {
+					t.Fatalf("Encode failed: %v", err)
+				}
+				encoder.Close()
+				if data, err = os.ReadFile(path); err != nil {
+					t.Fatalf("failed to read output: %v", err)
+				}
+			} else {
+				data = encodeToBuffer(t, input, WithSeekTable(tt.interval))
+			}
+
+			bodies, firstFrame := metadataBlockBodies(t, data)
+			body, ok := bodies[metadataSeekTable]
+			if !ok {
+				t.Fatalf("expected a SEEKTABLE block")
+			}
+			if got := len(body) / seekPointSize; got != tt.expectedPoints {
+				t.Fatalf("expected %d seek points, got %d", tt.expectedPoints, got)
+			}
+
+			var previous uint64
+			unique := 0
+			for i := 0; i < len(body)/seekPointSize; i++ {
+				entry := body[i*seekPointSize:]
+				sample := binary.BigEndian.Uint64(entry[0:8])
+				offset := binary.BigEndian.Uint64(entry[8:16])
+				samples := binary.BigEndian.Uint16(entry[16:18])
+				if sample == placeholderSeekPoint {
+					continue
+				}
+				if unique > 0 && sample <= previous {
+					t.Errorf("seek point %d: sample %d not after %d", i, sample, previous)
+				}
+				if sample%DefaultMinBlockSize != 0 || samples == 0 {
+					t.Errorf("seek point %d: sample %d with %d samples is not a frame start", i, sample, samples)
+				}
+				frame := data[firstFrame+int(offset):]
+				if frame[0] != 0xFF || frame[1]&0xFE != 0xF8 {
+					t.Errorf("seek point %d: offset %d does not point at a frame", i, offset)
+				}
+				previous = sample
+				unique++
+			}
+			if unique != tt.expectedUnique {
+				t.Errorf("expected %d seek points in use, got %d", tt.expectedUnique, unique)
+			}
+
+			decoder, err := NewDecoder(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if decoded := readAllSamples(t, decoder); !reflect.DeepEqual(decoded, samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+}
+
+func TestWithSeekTableInvalid(t *testing.T) {
+	for _, interval := range []float64{0, -1} {
+		if _, err := NewEncoderWriter(newTestFormat(44100, 1, 16), &bytes.Buffer{}, WithSeekTable(interval)); err == nil {
+			t.Errorf("expected an error for interval %v", interval)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package flac
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nooooaaaaah/soundcompression/audio"
+)
+
+// EncodeStats summarises an encode.
+type EncodeStats struct {
+	InputBytes  uint64        // size of the samples read, as PCM of the input's bit depth
+	OutputBytes uint64        // size of the FLAC stream written, metadata included
+	Ratio       float64       // OutputBytes / InputBytes, 0 when nothing was read
+	Elapsed     time.Duration // wall time of Encode, 0 until it succeeds
+}
+
+// Stats returns the sizes and timing of the last Encode, or of the one in
+// progress. PCM samples are counted in whole bytes, 3 per 24-bit sample and 2
+// per 12-bit one, as WAV stores them.
+func (e *Encoder) Stats() EncodeStats {
+	bytesPerSample := uint64(e.input.BitDepth()+7) / 8
+	stats := EncodeStats{
+		InputBytes:  e.samplesDone * uint64(e.input.Channels()) * bytesPerSample,
+		OutputBytes: e.headerBytes + e.frameBytes,
+		Elapsed:     e.elapsed,
+	}
+	if stats.InputBytes > 0 {
+		stats.Ratio = float64(stats.OutputBytes) / float64(stats.InputBytes)
+	}
+	return stats
+}
+
+// EstimateSize returns the size in bytes the FLAC stream of the input would
+// have, metadata included, without writing anything, to help choose a
+// compression level before committing to an encode. It runs the whole encode,
+// prediction and Rice coding included, into a writer that only counts the
+// bytes, so it takes about as long as Encode. The input must implement
+// audio.Seeker: it is read to the end and then seeked back to its first
+// sample, ready for Encode, also when the estimate fails. Progress callbacks,
+// analysis output, periodic flushes and verification are skipped, and Stats
+// describes the estimate until the next Encode. An Encoder returned by
+// ResumeEncoder cannot estimate before its Encode, which would have to carry
+// on from where the interrupted encode stopped.
+func (e *Encoder) EstimateSize() (int64, error) {
+	seeker, ok := e.input.(audio.Seeker)
+	if !ok {
+		return 0, fmt.Errorf("cannot estimate the size of an input that cannot seek")
+	}
+	if e.resuming {
+		return 0, fmt.Errorf("cannot estimate the size of a resumed encode")
+	}
+
+	output, outputPath := e.output, e.outputPath
+	progress, analysis, flushInterval, verify := e.progress, e.analysis, e.flushInterval, e.verify
+	counter := &countingWriter{}
+	e.output, e.outputPath = counter, ""
+	e.progress, e.analysis, e.flushInterval, e.verify = nil, nil, 0, false
+	err := e.Encode()
+	e.output, e.outputPath = output, outputPath
+	e.progress, e.analysis, e.flushInterval, e.verify = progress, analysis, flushInterval, verify
+
+	if seekErr := seeker.Seek(0); seekErr != nil && err == nil {
+		err = fmt.Errorf("error rewinding input: %w", seekErr)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return counter.size, nil
+}
+
+// countingWriter discards what is written to it, keeping only the size it
+// would have as a file. It can seek, so the encoder patches STREAMINFO in
+// place rather than buffering the stream.
+type countingWriter struct {
+	pos, size int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.pos += int64(len(p))
+	c.size = max(c.size, c.pos)
+	return len(p), nil
+}
+
+func (c *countingWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += c.pos
+	case io.SeekEnd:
+		offset += c.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative seek offset: %d", offset)
+	}
+	c.pos = offset
+	return offset, nil
+}
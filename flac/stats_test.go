@@ -0,0 +1,172 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nooooaaaaah/soundcompression/audio"
+)
+
+func TestEncoderStats(t *testing.T) {
+	tests := []struct {
+		name  string
+		input audio.Format
+	}{
+		{name: "Sine", input: newTestFormat(44100, 2, 16, sineSamples(3*DefaultMinBlockSize+100, 2)...)},
+		{name: "24-bit sine", input: newTestFormat(48000, 1, 24, sineSamples(DefaultMinBlockSize, 1)...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			encoder, err := NewEncoderWriter(tt.input, &out)
+			if err != nil {
+				t.Fatalf("NewEncoderWriter failed: %v", err)
+			}
+			if stats := encoder.Stats(); stats != (EncodeStats{}) {
+				t.Errorf("expected empty stats before encoding, got %+v", stats)
+			}
+			if err := encoder.Encode(); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+
+			stats := encoder.Stats()
+			bytesPerSample := uint64(tt.input.BitDepth()+7) / 8
+			if want := tt.input.TotalSamples() * uint64(tt.input.Channels()) * bytesPerSample; stats.InputBytes != want {
+				t.Errorf("expected %d input bytes, got %d", want, stats.InputBytes)
+			}
+			if stats.OutputBytes != uint64(out.Len()) {
+				t.Errorf("expected %d output bytes, the stream's size, got %d", out.Len(), stats.OutputBytes)
+			}
+			if !(stats.Ratio > 0 && stats.Ratio < 1) {
+				t.Errorf("expected a ratio between 0 and 1, got %v", stats.Ratio)
+			}
+			if stats.Elapsed <= 0 {
+				t.Errorf("expected a positive elapsed time, got %v", stats.Elapsed)
+			}
+		})
+	}
+}
+
+func TestEstimateSize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input audio.Format
+		opts  []Option
+	}{
+		{name: "Sine", input: newTestFormat(44100, 2, 16, sineSamples(5*DefaultMinBlockSize+100, 2)...)},
+		{name: "Sine at level 0", input: newTestFormat(44100, 2, 16, sineSamples(5*DefaultMinBlockSize+100, 2)...), opts: []Option{WithCompressionLevel(0)}},
+		{name: "Sine at level 8 with a seek table", input: newTestFormat(44100, 2, 16, sineSamples(5*DefaultMinBlockSize+100, 2)...), opts: []Option{WithCompressionLevel(8), WithSeekTable(0.1)}},
+		{name: "Dithered to 16 bits", input: newTestFormat(48000, 1, 24, sineSamples(5*DefaultMinBlockSize, 1)...), opts: []Option{WithOutputBitDepth(16)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var analysis bytes.Buffer
+			out := &memWriteSeeker{}
+			encoder, err := NewEncoderWriter(tt.input, out, append(tt.opts, WithAnalysisWriter(&analysis))...)
+			if err != nil {
+				t.Fatalf("NewEncoderWriter failed: %v", err)
+			}
+			estimate, err := encoder.EstimateSize()
+			if err != nil {
+				t.Fatalf("EstimateSize failed: %v", err)
+			}
+			if len(out.data) != 0 || analysis.Len() != 0 {
+				t.Errorf("expected nothing written by the estimate, got %d bytes of output and %d of analysis", len(out.data), analysis.Len())
+			}
+
+			if err := encoder.Encode(); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			actual := int64(len(out.data))
+			if diff := estimate - actual; diff*50 > actual || -diff*50 > actual {
+				t.Errorf("expected an estimate within 2%% of the %d bytes written, got %d", actual, estimate)
+			}
+			if analysis.Len() == 0 {
+				t.Errorf("expected the encode after the estimate to write its analysis")
+			}
+
+			decoder, err := NewDecoder(bytes.NewReader(out.data))
+			if err != nil {
+				t.Fatalf("NewDecoder failed: %v", err)
+			}
+			if decoded := readAllSamples(t, decoder); uint64(len(decoded)) != tt.input.TotalSamples()*uint64(tt.input.Channels()) {
+				t.Errorf("expected the whole input encoded after the estimate, got %d samples", len(decoded))
+			}
+		})
+	}
+
+	input := struct{ audio.Format }{newTestFormat(44100, 2, 16, sineSamples(100, 2)...)}
+	encoder, err := NewEncoderWriter(input, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	if _, err := encoder.EstimateSize(); err == nil {
+		t.Errorf("expected an error for an input that cannot seek")
+	}
+}
+
+func TestEstimateSizeFailure(t *testing.T) {
+	samples := sineSamples(5*DefaultMinBlockSize, 2)
+	input := &interruptedFormat{MemoryFormat: newTestFormat(44100, 2, 16, samples...), failAfter: 2 * 3 * DefaultMinBlockSize}
+	encoder, err := NewEncoderWriter(input, &memWriteSeeker{})
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	if _, err := encoder.EstimateSize(); !errors.Is(err, errInjected) {
+		t.Fatalf("expected the injected failure, got %v", err)
+	}
+
+	// The input is rewound even so
+	buffer := make([]int32, 4)
+	if n, err := input.MemoryFormat.ReadSamples(buffer); err != nil || !reflect.DeepEqual(buffer[:n], samples[:4]) {
+		t.Errorf("expected the input rewound to %v, got %v (%v)", samples[:4], buffer[:n], err)
+	}
+}
+
+func TestEstimateSizeResumed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "partial.flac")
+	samples := sineSamples(5*DefaultMinBlockSize, 2)
+	interrupted := &interruptedFormat{MemoryFormat: newTestFormat(44100, 2, 16, samples...), failAfter: 2 * 3 * DefaultMinBlockSize}
+	if err := encodeFile(t, interrupted, path); err == nil {
+		t.Fatalf("expected the interrupted encode to fail")
+	}
+
+	encoder, err := ResumeEncoder(newTestFormat(44100, 2, 16, samples...), path)
+	if err != nil {
+		t.Fatalf("ResumeEncoder failed: %v", err)
+	}
+	defer encoder.Close()
+	if _, err := encoder.EstimateSize(); err == nil {
+		t.Errorf("expected an error estimating a resumed encode")
+	}
+	if checkpoint := encoder.Checkpoint(); checkpoint.Samples != 3*DefaultMinBlockSize {
+		t.Errorf("expected the resumed encode left at sample %d, got %+v", 3*DefaultMinBlockSize, checkpoint)
+	}
+
+	// The resumed encode goes on undisturbed
+	if err := encoder.Encode(); err != nil {
+		t.Fatalf("resumed Encode failed: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	resumed, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read the resumed file: %v", err)
+	}
+	// readAllSamples fails on an MD5 mismatch, as a second stream header
+	// written after the resumed frames would cause
+	decoder, err := NewDecoder(bytes.NewReader(resumed))
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+	if decoded := readAllSamples(t, decoder); !reflect.DeepEqual(decoded, samples) {
+		t.Errorf("decoded samples differ from the input")
+	}
+}
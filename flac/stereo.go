@@ -0,0 +1,157 @@
+package flac
+
+// stereoMode selects how stereo channel assignments are chosen.
+type stereoMode int
+
+const (
+	stereoAdaptive    stereoMode = iota // pick the assignment with the smallest estimated size
+	stereoIndependent                   // always code left and right independently
+	stereoExhaustive                    // code every assignment and keep the smallest
+)
+
+// Channel assignments for stereo decorrelation. Independent channels use
+// the channel count minus one.
+const (
+	channelIndependentStereo = 0x1 // left, right
+	channelLeftSide          = 0x8 // left, side
+	channelSideRight         = 0x9 // side, right
+	channelMidSide           = 0xA // mid, side
+)
+
+// decorrelate converts left and right into the two channels coded for the
+// given assignment. Side is left minus right and mid is (left+right)>>1; the
+// bit mid loses is recovered from side when decoding.
+func decorrelate(assignment int, left, right []int32) ([]int32, []int32) {
+	if assignment == channelIndependentStereo {
+		return left, right
+	}
+
+	side := make([]int32, len(left))
+	for i := range left {
+		side[i] = left[i] - right[i]
+	}
+
+	switch assignment {
+	case channelLeftSide:
+		return left, side
+	case channelSideRight:
+		return side, right
+	default:
+		mid := make([]int32, len(left))
+		for i := range left {
+			mid[i] = int32((int64(left[i]) + int64(right[i])) >> 1)
+		}
+		return mid, side
+	}
+}
+
+// restoreStereo reverses decorrelate, returning the left and right channels.
+func restoreStereo(assignment int, first, second []int32) ([]int32, []int32) {
+	left := make([]int32, len(first))
+	right := make([]int32, len(first))
+	for i := range first {
+		a, b := first[i], second[i]
+		switch assignment {
+		case channelLeftSide:
+			left[i], right[i] = a, a-b
+		case channelSideRight:
+			left[i], right[i] = a+b, b
+		case channelMidSide:
+			mid := int64(a)<<1 | int64(b)&1
+			left[i] = int32((mid + int64(b)) >> 1)
+			right[i] = int32((mid - int64(b)) >> 1)
+		default:
+			left[i], right[i] = a, b
+		}
+	}
+	return left, right
+}
+
+// sideChannel returns which of the two coded channels is the side channel for
+// an assignment, or -1 if there is none. The side channel needs one extra bit.
+func sideChannel(assignment int) int {
+	switch assignment {
+	case channelLeftSide, channelMidSide:
+		return 1
+	case channelSideRight:
+		return 0
+	default:
+		return -1
+	}
+}
+
+// estimateBits estimates the coded size of a channel from the Rice coded
+// residual of its best fixed predictor, or as 32-bit verbatim samples when no
+// fixed residual fits.
+func estimateBits(samples []int32) int {
+	_, residual := bestFixedOrder(samples)
+	if residual == nil {
+		return len(samples) * 32
+	}
+	return planResidual(residual).bits
+}
+
+// decorrelateStereo estimates the cost of coding a stereo block as left/right,
+// left/side, side/right and mid/side, and returns the cheapest assignment with
+// the two channels to code.
+func (e *Encoder) decorrelateStereo(left, right []int32) (int, []int32, []int32) {
+	mid, side := decorrelate(channelMidSide, left, right)
+	l, r := estimateBits(left), estimateBits(right)
+	m, sd := estimateBits(mid), estimateBits(side)
+
+	// Ties go to the earlier assignment
+	best, bestCost := channelIndependentStereo, l+r
+	for _, c := range []struct{ assignment, cost int }{
+		{channelLeftSide, l + sd},
+		{channelSideRight, sd + r},
+		{channelMidSide, m + sd},
+	} {
+		if c.cost < bestCost {
+			best, bestCost = c.assignment, c.cost
+		}
+	}
+
+	if e.logging {
+		e.logger.Debug("Chose stereo channel assignment", "assignment", best)
+	}
+
+	switch best {
+	case channelLeftSide:
+		return best, left, side
+	case channelSideRight:
+		return best, side, right
+	case channelMidSide:
+		return best, mid, side
+	default:
+		return best, left, right
+	}
+}
+
+// planStereo codes a stereo block's left, right, mid and side channels and
+// returns the assignment whose pair of subframes is smallest, along with the
+// plans for those two subframes. bitDepth is the input's; side needs one more.
+func (e *Encoder) planStereo(left, right []int32, bitDepth int) (int, []subframePlan) {
+	mid, side := decorrelate(channelMidSide, left, right)
+	l, r := e.planSubframe(left, bitDepth), e.planSubframe(right, bitDepth)
+	m, sd := e.planSubframe(mid, bitDepth), e.planSubframe(side, bitDepth+1)
+
+	// Ties go to the earlier assignment
+	best, bestPlans := channelIndependentStereo, []subframePlan{l, r}
+	for _, c := range []struct {
+		assignment int
+		plans      []subframePlan
+	}{
+		{channelLeftSide, []subframePlan{l, sd}},
+		{channelSideRight, []subframePlan{sd, r}},
+		{channelMidSide, []subframePlan{m, sd}},
+	} {
+		if c.plans[0].bits+c.plans[1].bits < bestPlans[0].bits+bestPlans[1].bits {
+			best, bestPlans = c.assignment, c.plans
+		}
+	}
+
+	if e.logging {
+		e.logger.Debug("Chose stereo channel assignment", "assignment", best)
+	}
+	return best, bestPlans
+}
@@ -0,0 +1,65 @@
+package flac
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestDecorrelateRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	left := make([]int32, 256)
+	right := make([]int32, 256)
+	for i := range left {
+		left[i] = int32(rng.Intn(1<<16) - 1<<15)
+		right[i] = int32(rng.Intn(1<<16) - 1<<15)
+	}
+	// Include the extremes, where mid and side need the most care
+	left[0], right[0] = 32767, -32768
+	left[1], right[1] = -32768, 32767
+	left[2], right[2] = -1, 0
+
+	tests := []struct {
+		name       string
+		assignment int
+		side       int
+	}{
+		{"Independent", channelIndependentStereo, -1},
+		{"Left/side", channelLeftSide, 1},
+		{"Side/right", channelSideRight, 0},
+		{"Mid/side", channelMidSide, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, second := decorrelate(tt.assignment, left, right)
+			if side := sideChannel(tt.assignment); side != tt.side {
+				t.Errorf("expected side channel %d, got %d", tt.side, side)
+			}
+
+			gotLeft, gotRight := restoreStereo(tt.assignment, first, second)
+			if !reflect.DeepEqual(gotLeft, left) {
+				t.Errorf("left channel was not reconstructed")
+			}
+			if !reflect.DeepEqual(gotRight, right) {
+				t.Errorf("right channel was not reconstructed")
+			}
+		})
+	}
+}
+
+func TestDecorrelateStereo(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	left := make([]int32, 4096)
+	right := make([]int32, 4096)
+	for i := range left {
+		left[i] = int32(rng.Intn(1<<16) - 1<<15)
+		right[i] = left[i] + int32(rng.Intn(3)-1)
+	}
+
+	encoder := &Encoder{logging: false}
+	assignment, _, _ := encoder.decorrelateStereo(left, right)
+	if assignment == channelIndependentStereo {
+		t.Errorf("expected nearly identical channels to be decorrelated, got independent coding")
+	}
+}
@@ -0,0 +1,307 @@
+package flac
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+const (
+	subframeTypeConstant = 0b000000
+	subframeTypeVerbatim = 0b000001
+	subframeTypeFixed    = 0b001000 // low 3 bits hold the predictor order
+	subframeTypeLPC      = 0b100000 // low 5 bits hold the predictor order minus one
+)
+
+// subframe holds one channel of a frame ready to be coded.
+type subframe struct {
+	samples    []int32 // samples with the wasted bits shifted out
+	bitDepth   int     // sample size of the subframe, excluding wasted bits
+	wastedBits int     // number of zero low bits shared by every sample
+}
+
+// wastedBits returns the number of trailing zero bits common to all samples.
+// An all-zero block has no meaningful count and returns 0; it is coded as a
+// constant subframe rather than shifted.
+func wastedBits(samples []int32) int {
+	var acc int32
+	for _, s := range samples {
+		acc |= s
+		if acc&1 == 1 {
+			return 0
+		}
+	}
+	if acc == 0 {
+		return 0
+	}
+	return bits.TrailingZeros32(uint32(acc))
+}
+
+// newSubframe detects the wasted bits of a channel's samples, shifts them out
+// and records the count for the subframe header. The input slice is left untouched.
+func (e *Encoder) newSubframe(samples []int32, bitDepth int) subframe {
+	wasted := wastedBits(samples)
+	if wasted == 0 {
+		return subframe{samples: samples, bitDepth: bitDepth}
+	}
+
+	if e.logging {
+		e.logger.Debug("Shifting out wasted bits", "bits", wasted)
+	}
+
+	shifted := make([]int32, len(samples))
+	for i, s := range samples {
+		shifted[i] = s >> uint(wasted)
+	}
+	return subframe{samples: shifted, bitDepth: bitDepth - wasted, wastedBits: wasted}
+}
+
+// writeSubframeHeader writes the zero padding bit, the 6-bit subframe type and
+// the wasted bits flag, followed by the wasted bit count minus one in unary.
+func writeSubframeHeader(bw *BitWriter, subframeType int, wasted int) {
+	bw.WriteBits(0, 1)
+	bw.WriteBits(uint64(subframeType), 6)
+	if wasted == 0 {
+		bw.WriteBits(0, 1)
+		return
+	}
+	bw.WriteBits(1, 1)
+	bw.WriteUnary(uint(wasted - 1))
+}
+
+// isConstant reports whether every sample has the same value.
+func isConstant(samples []int32) bool {
+	for _, s := range samples[1:] {
+		if s != samples[0] {
+			return false
+		}
+	}
+	return len(samples) > 0
+}
+
+// subframeHeaderBits returns the size of a subframe header: the padding bit,
+// type and wasted bits flag, plus the unary wasted bit count if there is one.
+func subframeHeaderBits(wasted int) int {
+	return 8 + wasted
+}
+
+// subframePlan is the coding chosen for one channel of a frame and its size,
+// worked out before anything is written so that codings can be compared.
+type subframePlan struct {
+	subframeType int
+	sf           subframe
+	prediction   prediction // for fixed and LPC subframes
+	bits         int
+}
+
+// planSubframe chooses how to code one channel of a frame. Channels holding a
+// single value, such as silence or DC, take a constant subframe. The rest are
+// predicted, unless storing the samples verbatim would be smaller, as it is
+// for noise or already compressed content.
+func (e *Encoder) planSubframe(samples []int32, bitDepth int) subframePlan {
+	if isConstant(samples) {
+		return subframePlan{
+			subframeType: subframeTypeConstant,
+			sf:           subframe{samples: samples, bitDepth: bitDepth},
+			bits:         subframeHeaderBits(0) + bitDepth,
+		}
+	}
+
+	sf := e.newSubframe(samples, bitDepth)
+	p := e.predictSamples(sf)
+	if bits := verbatimBits(sf); bits < p.bits {
+		return subframePlan{subframeType: subframeTypeVerbatim, sf: sf, bits: bits}
+	}
+	return subframePlan{subframeType: p.subframeType, sf: sf, prediction: p, bits: p.bits}
+}
+
+// writePlannedSubframe writes a subframe coded as planned.
+func (e *Encoder) writePlannedSubframe(bw *BitWriter, plan subframePlan) {
+	p := plan.prediction
+	switch {
+	case plan.subframeType == subframeTypeConstant:
+		e.writeConstantSubframe(bw, plan.sf.samples[0], plan.sf.bitDepth)
+	case plan.subframeType == subframeTypeVerbatim:
+		e.writeVerbatimSubframe(bw, plan.sf)
+	case p.coefficients != nil:
+		e.writeLPCSubframe(bw, plan.sf, p)
+	default:
+		e.writeFixedSubframe(bw, plan.sf, p.order, p.residual, p.coding)
+	}
+}
+
+// verbatimBits returns the size of a subframe storing every sample unencoded.
+func verbatimBits(sf subframe) int {
+	return subframeHeaderBits(sf.wastedBits) + len(sf.samples)*sf.bitDepth
+}
+
+// writeVerbatimSubframe codes a subframe with every sample stored unencoded at
+// the subframe's bit depth.
+func (e *Encoder) writeVerbatimSubframe(bw *BitWriter, sf subframe) {
+	if e.logging {
+		e.logger.Debug("Writing verbatim subframe", "samples", len(sf.samples))
+	}
+	writeSubframeHeader(bw, subframeTypeVerbatim, sf.wastedBits)
+	for _, s := range sf.samples {
+		bw.WriteBits(uint64(uint32(s)), uint(sf.bitDepth))
+	}
+}
+
+// writeConstantSubframe codes a subframe whose samples all equal value: the
+// header and the value once, at the channel's bit depth.
+func (e *Encoder) writeConstantSubframe(bw *BitWriter, value int32, bitDepth int) {
+	if e.logging {
+		e.logger.Debug("Writing constant subframe", "value", value)
+	}
+	writeSubframeHeader(bw, subframeTypeConstant, 0)
+	bw.WriteBits(uint64(uint32(value)), uint(bitDepth))
+}
+
+// writeFixedSubframe codes a subframe with a fixed predictor of the given order:
+// the header, the warm-up samples at the subframe's bit depth and the residual
+// Rice coded as planned.
+func (e *Encoder) writeFixedSubframe(bw *BitWriter, sf subframe, order int, residual []int32, rc residualCoding) {
+	writeSubframeHeader(bw, subframeTypeFixed|order, sf.wastedBits)
+	for _, s := range sf.samples[:order] {
+		bw.WriteBits(uint64(uint32(s)), uint(sf.bitDepth))
+	}
+	e.encodeResidual(bw, residual, rc)
+}
+
+// writeLPCSubframe codes a subframe with an LPC predictor: the header, the
+// warm-up samples, the coefficient precision and shift, the quantized
+// coefficients and the residual Rice coded as planned.
+func (e *Encoder) writeLPCSubframe(bw *BitWriter, sf subframe, p prediction) {
+	writeSubframeHeader(bw, p.subframeType, sf.wastedBits)
+	for _, s := range sf.samples[:p.order] {
+		bw.WriteBits(uint64(uint32(s)), uint(sf.bitDepth))
+	}
+	bw.WriteBits(uint64(e.lpcPrecision-1), lpcPrecisionBits)
+	bw.WriteBits(uint64(p.shift), lpcShiftBits)
+	for _, c := range p.coefficients {
+		bw.WriteBits(uint64(uint32(c)), uint(e.lpcPrecision))
+	}
+	e.encodeResidual(bw, p.residual, p.coding)
+}
+
+// readSubframe decodes one subframe of blockSize samples coded at bitDepth
+// bits, shifting any wasted bits back in.
+func readSubframe(br *BitReader, blockSize, bitDepth int) ([]int32, error) {
+	header, err := br.ReadBits(8)
+	if err != nil {
+		return nil, err
+	}
+	if header&0x80 != 0 {
+		return nil, fmt.Errorf("invalid subframe padding bit")
+	}
+	subframeType := int(header>>1) & 0x3F
+	wasted := 0
+	if header&1 == 1 {
+		k, err := br.ReadUnary()
+		if err != nil {
+			return nil, err
+		}
+		wasted = int(k) + 1
+		if wasted > bitDepth {
+			return nil, fmt.Errorf("%d wasted bits in a %d-bit subframe", wasted, bitDepth)
+		}
+	}
+	bitDepth -= wasted
+
+	samples := make([]int32, blockSize)
+	switch {
+	case subframeType == subframeTypeConstant:
+		v, err := br.ReadSignedBits(uint(bitDepth))
+		if err != nil {
+			return nil, err
+		}
+		for i := range samples {
+			samples[i] = int32(v)
+		}
+	case subframeType == subframeTypeVerbatim:
+		if err := readWarmUp(br, samples, bitDepth); err != nil {
+			return nil, err
+		}
+	case subframeType&0b111000 == subframeTypeFixed && subframeType&0b111 <= MaxFixedOrder:
+		order := subframeType & 0b111
+		if order > len(samples) {
+			return nil, fmt.Errorf("fixed order %d exceeds block size %d", order, len(samples))
+		}
+		if err := readWarmUp(br, samples[:order], bitDepth); err != nil {
+			return nil, err
+		}
+		if err := readResidual(br, samples, order); err != nil {
+			return nil, err
+		}
+		restoreFixed(samples, order)
+	case subframeType&subframeTypeLPC != 0:
+		order := subframeType&0x1F + 1
+		if err := readLPCSubframe(br, samples, order, bitDepth); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("reserved subframe type %#b", subframeType)
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= uint(wasted)
+		}
+	}
+	return samples, nil
+}
+
+// readWarmUp reads len(samples) unencoded samples of bitDepth bits.
+func readWarmUp(br *BitReader, samples []int32, bitDepth int) error {
+	if len(samples) > 0 && bitDepth == 0 {
+		return fmt.Errorf("zero bit depth for unencoded samples")
+	}
+	for i := range samples {
+		v, err := br.ReadSignedBits(uint(bitDepth))
+		if err != nil {
+			return err
+		}
+		samples[i] = int32(v)
+	}
+	return nil
+}
+
+// readLPCSubframe reads the warm-up samples, quantized coefficients and
+// residual of an LPC subframe and restores its samples.
+func readLPCSubframe(br *BitReader, samples []int32, order, bitDepth int) error {
+	if order > len(samples) {
+		return fmt.Errorf("LPC order %d exceeds block size %d", order, len(samples))
+	}
+	if err := readWarmUp(br, samples[:order], bitDepth); err != nil {
+		return err
+	}
+
+	precision, err := br.ReadBits(4)
+	if err != nil {
+		return err
+	}
+	if precision == 0xF {
+		return fmt.Errorf("invalid LPC coefficient precision")
+	}
+	shift, err := br.ReadSignedBits(5)
+	if err != nil {
+		return err
+	}
+	if shift < 0 {
+		return fmt.Errorf("negative LPC shift %d", shift)
+	}
+
+	coefficients := make([]int32, order)
+	for i := range coefficients {
+		c, err := br.ReadSignedBits(uint(precision + 1))
+		if err != nil {
+			return err
+		}
+		coefficients[i] = int32(c)
+	}
+
+	if err := readResidual(br, samples, order); err != nil {
+		return err
+	}
+	restoreLPC(samples, coefficients, int(shift))
+	return nil
+}
@@ -0,0 +1,184 @@
+package flac
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// writeSubframe codes one channel of a frame as planSubframe chooses.
+func (e *Encoder) writeSubframe(bw *BitWriter, samples []int32, bitDepth int) {
+	e.writePlannedSubframe(bw, e.planSubframe(samples, bitDepth))
+}
+
+func TestNewSubframeWastedBits(t *testing.T) {
+	tests := []struct {
+		name             string
+		samples          []int32
+		bitDepth         int
+		expectedWasted   int
+		expectedBitDepth int
+		expectedSamples  []int32
+	}{
+		{
+			name:             "12-bit content in 16-bit samples",
+			samples:          []int32{16, -32, 48, 0, -4096},
+			bitDepth:         16,
+			expectedWasted:   4,
+			expectedBitDepth: 12,
+			expectedSamples:  []int32{1, -2, 3, 0, -256},
+		},
+		{
+			name:             "16-bit content in 24-bit samples",
+			samples:          []int32{256, -256, 768, -8388608},
+			bitDepth:         24,
+			expectedWasted:   8,
+			expectedBitDepth: 16,
+			expectedSamples:  []int32{1, -1, 3, -32768},
+		},
+		{
+			name:             "All-zero block",
+			samples:          []int32{0, 0, 0, 0},
+			bitDepth:         16,
+			expectedWasted:   0,
+			expectedBitDepth: 16,
+			expectedSamples:  []int32{0, 0, 0, 0},
+		},
+		{
+			name:             "Single odd sample",
+			samples:          []int32{1024, 2048, 3, 4096},
+			bitDepth:         24,
+			expectedWasted:   0,
+			expectedBitDepth: 24,
+			expectedSamples:  []int32{1024, 2048, 3, 4096},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder := &Encoder{logging: false}
+			input := append([]int32(nil), tt.samples...)
+
+			sf := encoder.newSubframe(input, tt.bitDepth)
+			if sf.wastedBits != tt.expectedWasted {
+				t.Errorf("expected %d wasted bits, got %d", tt.expectedWasted, sf.wastedBits)
+			}
+			if sf.bitDepth != tt.expectedBitDepth {
+				t.Errorf("expected bit depth %d, got %d", tt.expectedBitDepth, sf.bitDepth)
+			}
+			if !reflect.DeepEqual(sf.samples, tt.expectedSamples) {
+				t.Errorf("expected samples %v, got %v", tt.expectedSamples, sf.samples)
+			}
+			if !reflect.DeepEqual(input, tt.samples) {
+				t.Errorf("input samples were modified: %v", input)
+			}
+		})
+	}
+}
+
+func TestWriteSubframe(t *testing.T) {
+	constant := func(value int32, n int) []int32 {
+		samples := make([]int32, n)
+		for i := range samples {
+			samples[i] = value
+		}
+		return samples
+	}
+	noise := func(bitDepth int, n int) []int32 {
+		rng := rand.New(rand.NewSource(1))
+		samples := make([]int32, n)
+		for i := range samples {
+			samples[i] = int32(rng.Int63n(1<<bitDepth) - 1<<(bitDepth-1))
+		}
+		return samples
+	}
+
+	tests := []struct {
+		name         string
+		samples      []int32
+		bitDepth     int
+		expectedType int
+		expectedBits int64
+	}{
+		{
+			name:         "All-zero block",
+			samples:      constant(0, 4096),
+			bitDepth:     16,
+			expectedType: subframeTypeConstant,
+			expectedBits: 8 + 16,
+		},
+		{
+			name:         "All-12345 block",
+			samples:      constant(12345, 4096),
+			bitDepth:     16,
+			expectedType: subframeTypeConstant,
+			expectedBits: 8 + 16,
+		},
+		{
+			name:         "Negative DC on a 17-bit side channel",
+			samples:      constant(-65536, 1152),
+			bitDepth:     17,
+			expectedType: subframeTypeConstant,
+			expectedBits: 8 + 17,
+		},
+		{
+			name:         "White noise",
+			samples:      noise(16, 4096),
+			bitDepth:     16,
+			expectedType: subframeTypeVerbatim,
+			expectedBits: 8 + 4096*16,
+		},
+		{
+			name:         "White noise with wasted bits",
+			samples:      mapSamples(noise(16, 1024), func(s int32) int32 { return s &^ 0b111 }),
+			bitDepth:     16,
+			expectedType: subframeTypeVerbatim,
+			expectedBits: 8 + 3 + 1024*13,
+		},
+		{
+			name:         "Sine",
+			samples:      sineSamples(4096, 1),
+			bitDepth:     16,
+			expectedType: subframeTypeFixed,
+		},
+		{
+			name:         "Single differing sample",
+			samples:      append(constant(12345, 15), 0),
+			bitDepth:     16,
+			expectedType: subframeTypeFixed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder := &Encoder{logging: false}
+			var buf bytes.Buffer
+			bw := NewBitWriter(&buf)
+			encoder.writeSubframe(bw, tt.samples, tt.bitDepth)
+			bits := bw.count
+			if err := bw.Flush(); err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+
+			got := int(buf.Bytes()[0] >> 1)
+			if tt.expectedType == subframeTypeFixed {
+				got &^= 0b111 // ignore the predictor order
+			}
+			if got != tt.expectedType {
+				t.Errorf("expected subframe type %#b, got %#b", tt.expectedType, got)
+			}
+			if tt.expectedBits > 0 && bits != tt.expectedBits {
+				t.Errorf("expected %d bits, got %d", tt.expectedBits, bits)
+			}
+
+			decoded, err := readSubframe(NewBitReader(&buf), len(tt.samples), tt.bitDepth)
+			if err != nil {
+				t.Fatalf("readSubframe failed: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.samples) {
+				t.Errorf("decoded samples differ from the input")
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package flac
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// verifyFrame decodes an encoded frame and compares it with the interleaved
+// samples it was encoded from, returning a *VerifyError for the first sample
+// that differs.
+func (e *Encoder) verifyFrame(frame []byte, samples []int32) error {
+	d := &Decoder{
+		br: NewBitReader(bytes.NewReader(frame)),
+		info: StreamInfo{
+			SampleRate: e.input.SampleRate(),
+			Channels:   e.input.Channels(),
+			BitDepth:   e.input.BitDepth(),
+		},
+	}
+	_, decoded, err := d.decodeFrame()
+	if err != nil {
+		return fmt.Errorf("verify failed in frame %d: %w", e.frameNumber, err)
+	}
+	if len(decoded) != len(samples) {
+		return fmt.Errorf("verify failed in frame %d: decoded %d samples, expected %d", e.frameNumber, len(decoded), len(samples))
+	}
+
+	channels := e.input.Channels()
+	for i, s := range samples {
+		if decoded[i] != s {
+			return &VerifyError{
+				Frame:    e.frameNumber,
+				Channel:  i % channels,
+				Sample:   i / channels,
+				Expected: s,
+				Got:      decoded[i],
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package flac
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestWithVerify(t *testing.T) {
+	samples := sineSamples(3*DefaultMinBlockSize+100, 2)
+	var buf bytes.Buffer
+	encoder, err := NewEncoderWriter(newTestFormat(44100, 2, 16, samples...), &buf, WithVerify(true))
+	if err != nil {
+		t.Fatalf("NewEncoderWriter failed: %v", err)
+	}
+	if err := encoder.Encode(); err != nil {
+		t.Fatalf("Encode with verify failed: %v", err)
+	}
+}
+
+func TestVerifyFrameWrongResidual(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel int
+		index   int // residual index to corrupt
+	}{
+		{name: "Left channel", channel: 0, index: 10},
+		{name: "Right channel", channel: 1, index: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := sineSamples(1024, 2)
+			var buf bytes.Buffer
+			// Level 0 codes stereo independently, so a bad residual shows up in its own channel.
+			encoder, err := NewEncoderWriter(newTestFormat(44100, 2, 16, samples...), &buf, WithVerify(true), WithCompressionLevel(0))
+			if err != nil {
+				t.Fatalf("NewEncoderWriter failed: %v", err)
+			}
+
+			assignment, plans := encoder.planBlock(deinterleave(samples, 2))
+			plan := &plans[tt.channel]
+			if plan.prediction.residual == nil {
+				t.Fatalf("expected a predicted subframe, got type %#b", plan.subframeType)
+			}
+			plan.prediction.residual[tt.index] += 5
+
+			frame, _, err := encoder.buildFrame(1024, assignment, plans)
+			if err != nil {
+				t.Fatalf("buildFrame failed: %v", err)
+			}
+			err = encoder.verifyFrame(frame, samples)
+
+			var verr *VerifyError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected a VerifyError, got %v", err)
+			}
+			if verr.Channel != tt.channel {
+				t.Errorf("expected channel %d, got %d", tt.channel, verr.Channel)
+			}
+			if want := tt.index + plan.prediction.order; verr.Sample != want {
+				t.Errorf("expected sample %d, got %d", want, verr.Sample)
+			}
+			if verr.Got-verr.Expected != 5 {
+				t.Errorf("expected the decoded sample to be off by 5, got %d instead of %d", verr.Got, verr.Expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package flac
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultApodization is the window applied before estimating LPC
+// coefficients, the same the reference encoder uses.
+const DefaultApodization = "tukey(0.5)"
+
+// apodization computes a window of n weights for a block of n samples.
+type apodization func(n int) []float64
+
+// parseApodization returns the window function named by name: "rectangle",
+// "hann", "tukey", which tapers half the block, or "tukey(P)" tapering a
+// fraction P between 0 and 1 of it.
+func parseApodization(name string) (apodization, error) {
+	switch name {
+	case "rectangle":
+		return rectangleWindow, nil
+	case "hann":
+		return hannWindow, nil
+	case "tukey":
+		return func(n int) []float64 { return tukeyWindow(n, 0.5) }, nil
+	}
+
+	if arg, ok := strings.CutPrefix(name, "tukey("); ok && strings.HasSuffix(arg, ")") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(arg, ")"), 64)
+		if err != nil || !(p >= 0 && p <= 1) {
+			return nil, fmt.Errorf("invalid tukey window parameter in %q: must be between 0 and 1", name)
+		}
+		return func(n int) []float64 { return tukeyWindow(n, p) }, nil
+	}
+	return nil, fmt.Errorf("unknown apodization %q", name)
+}
+
+// rectangleWindow weighs every sample equally, leaving the block as it is.
+func rectangleWindow(n int) []float64 {
+	w := make([]float64, n)
+	for i := range w {
+		w[i] = 1
+	}
+	return w
+}
+
+// hannWindow returns the Hann window 0.5 - 0.5cos(2πi/(n-1)), which rises from
+// 0 at the ends to 1 in the middle.
+func hannWindow(n int) []float64 {
+	if n == 1 {
+		return rectangleWindow(n)
+	}
+	w := make([]float64, n)
+	for i := range w {
+		w[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+	}
+	return w
+}
+
+// tukeyWindow returns a window that is flat except for a fraction p of the
+// block, split between both ends, which is tapered like a Hann window. p of 0
+// is the rectangle window and p of 1 the Hann window.
+func tukeyWindow(n int, p float64) []float64 {
+	if p <= 0 || n == 1 {
+		return rectangleWindow(n)
+	}
+	w := make([]float64, n)
+	for i := range w {
+		x := float64(i) / float64(n-1)
+		switch {
+		case x < p/2:
+			w[i] = 0.5 - 0.5*math.Cos(2*math.Pi*x/p)
+		case x > 1-p/2:
+			w[i] = 0.5 - 0.5*math.Cos(2*math.Pi*(1-x)/p)
+		default:
+			w[i] = 1
+		}
+	}
+	return w
+}
+
+// windowFor returns the encoder's window for a block of n samples, or nil if
+// no apodization is set. The window is kept between blocks, as every block but
+// the last has the same size.
+func (e *Encoder) windowFor(n int) []float64 {
+	if e.apodization == nil {
+		return nil
+	}
+	if len(e.window) != n {
+		e.window = e.apodization(n)
+	}
+	return e.window
+}
@@ -0,0 +1,113 @@
+package flac
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestHannWindow(t *testing.T) {
+	const n = 4097
+	w := hannWindow(n)
+	if len(w) != n {
+		t.Fatalf("expected %d weights, got %d", n, len(w))
+	}
+
+	for _, i := range []int{0, n / 4, n / 2, 3 * n / 4, n - 1} {
+		expected := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+		if math.Abs(w[i]-expected) > 1e-12 {
+			t.Errorf("weight %d: expected %v, got %v", i, expected, w[i])
+		}
+	}
+	if w[0] != 0 || math.Abs(w[n-1]) > 1e-12 {
+		t.Errorf("expected zero endpoints, got %v and %v", w[0], w[n-1])
+	}
+	if math.Abs(w[n/2]-1) > 1e-12 {
+		t.Errorf("expected 1 at the midpoint, got %v", w[n/2])
+	}
+}
+
+func TestTukeyWindow(t *testing.T) {
+	const n = 4097
+	tests := []struct {
+		name string
+		p    float64
+		flat [2]int // range of weights expected to be exactly 1
+	}{
+		{"Half tapered", 0.5, [2]int{n / 4, 3 * n / 4}},
+		{"Rectangle", 0, [2]int{0, n - 1}},
+		{"Quarter tapered", 0.25, [2]int{n / 8, 7 * n / 8}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := tukeyWindow(n, tt.p)
+			for i := tt.flat[0]; i <= tt.flat[1]; i++ {
+				if w[i] != 1 {
+					t.Fatalf("expected weight %d to be 1, got %v", i, w[i])
+				}
+			}
+			for i := range w {
+				if math.Abs(w[i]-w[n-1-i]) > 1e-12 {
+					t.Fatalf("window is not symmetric at %d", i)
+				}
+			}
+		})
+	}
+
+	hann := hannWindow(n)
+	for i, v := range tukeyWindow(n, 1) {
+		if math.Abs(v-hann[i]) > 1e-12 {
+			t.Fatalf("expected tukey(1) to match the Hann window at %d: %v, got %v", i, hann[i], v)
+		}
+	}
+}
+
+func TestWithApodization(t *testing.T) {
+	tests := []struct {
+		name        string
+		apodization string
+		expectedErr bool
+	}{
+		{name: "Rectangle", apodization: "rectangle"},
+		{name: "Hann", apodization: "hann"},
+		{name: "Tukey", apodization: "tukey"},
+		{name: "Tukey with parameter", apodization: "tukey(0.25)"},
+		{name: "Tukey parameter out of range", apodization: "tukey(1.5)", expectedErr: true},
+		{name: "Tukey parameter malformed", apodization: "tukey(half)", expectedErr: true},
+		{name: "Unknown", apodization: "blackman", expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder, err := NewEncoderWriter(newTestFormat(44100, 2, 16), &buf, WithApodization(tt.apodization))
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if w := encoder.windowFor(64); len(w) != 64 {
+				t.Errorf("expected a window of 64 weights, got %d", len(w))
+			}
+
+			// The window shapes the estimate only; the subframe still decodes.
+			samples := ar2Samples(1024)
+			bw := NewBitWriter(&buf)
+			encoder.writeSubframe(bw, samples, 16)
+			if err := bw.Flush(); err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+			decoded, err := readSubframe(NewBitReader(&buf), len(samples), 16)
+			if err != nil {
+				t.Fatalf("readSubframe failed: %v", err)
+			}
+			for i := range samples {
+				if decoded[i] != samples[i] {
+					t.Fatalf("decoded sample %d differs: expected %d, got %d", i, samples[i], decoded[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// Command soundcompression encodes a WAV file to FLAC.
+//
+// Usage:
+//
+//	soundcompression -in input.wav -out output.flac [-level 5] [-verbose]
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/nooooaaaaah/soundcompression/flac"
+)
+
+// config holds the command-line settings.
+type config struct {
+	inputPath  string
+	outputPath string
+	level      int
+	verbose    bool
+}
+
+// parseFlags parses the command-line arguments, not including the program
+// name. Usage and errors are written to output.
+func parseFlags(args []string, output io.Writer) (config, error) {
+	var cfg config
+	fs := flag.NewFlagSet("soundcompression", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&cfg.inputPath, "in", "", "input WAV `file`")
+	fs.StringVar(&cfg.outputPath, "out", "", "output FLAC `file`")
+	fs.IntVar(&cfg.level, "level", 5, fmt.Sprintf("compression level, 0 (fastest) to %d (smallest)", flac.MaxCompressionLevel))
+	fs.BoolVar(&cfg.verbose, "verbose", false, "log the encoding process")
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+
+	if fs.NArg() > 0 {
+		return config{}, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if cfg.inputPath == "" || cfg.outputPath == "" {
+		return config{}, errors.New("both -in and -out are required")
+	}
+	if cfg.level < 0 || cfg.level > flac.MaxCompressionLevel {
+		return config{}, fmt.Errorf("invalid compression level %d: must be between 0 and %d", cfg.level, flac.MaxCompressionLevel)
+	}
+	return cfg, nil
+}
+
+func main() {
+	cfg, err := parseFlags(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	start := time.Now()
+	err = flac.EncodeFile(cfg.inputPath, cfg.outputPath, flac.WithCompressionLevel(cfg.level), flac.WithLogging(cfg.verbose))
+	if err != nil {
+		log.Fatal(err)
+	}
+	elapsed := time.Since(start)
+
+	ratio, err := compressionRatio(cfg.inputPath, cfg.outputPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Encoded %s to %s in %v, compression ratio %.3f\n", cfg.inputPath, cfg.outputPath, elapsed.Round(time.Millisecond), ratio)
+}
+
+// compressionRatio returns the size of the output file relative to the input.
+func compressionRatio(inputPath, outputPath string) (float64, error) {
+	in, err := os.Stat(inputPath)
+	if err != nil {
+		return 0, fmt.Errorf("error reading input size: %w", err)
+	}
+	out, err := os.Stat(outputPath)
+	if err != nil {
+		return 0, fmt.Errorf("error reading output size: %w", err)
+	}
+	if in.Size() == 0 {
+		return 0, nil
+	}
+	return float64(out.Size()) / float64(in.Size()), nil
+}
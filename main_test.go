@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nooooaaaaah/soundcompression/audio"
+	"github.com/nooooaaaaah/soundcompression/flac"
+)
+
+// readAll reads every sample from f.
+func readAll(t *testing.T, f audio.Format) []int32 {
+	t.Helper()
+	var all []int32
+	buffer := make([]int32, 4096*f.Channels())
+	for {
+		n, err := f.ReadSamples(buffer)
+		all = append(all, buffer[:n]...)
+		if err == io.EOF {
+			return all
+		}
+		if err != nil {
+			t.Fatalf("ReadSamples failed: %v", err)
+		}
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		expected    config
+		expectedErr bool
+	}{
+		{
+			name:     "Input and output with the default level",
+			args:     []string{"-in", "in.wav", "-out", "out.flac"},
+			expected: config{inputPath: "in.wav", outputPath: "out.flac", level: 5},
+		},
+		{
+			name:     "All flags",
+			args:     []string{"-in", "in.wav", "-out", "out.flac", "-level", "8", "-verbose"},
+			expected: config{inputPath: "in.wav", outputPath: "out.flac", level: 8, verbose: true},
+		},
+		{
+			name:        "Missing output",
+			args:        []string{"-in", "in.wav"},
+			expectedErr: true,
+		},
+		{
+			name:        "Level out of range",
+			args:        []string{"-in", "in.wav", "-out", "out.flac", "-level", "9"},
+			expectedErr: true,
+		},
+		{
+			name:        "Unknown flag",
+			args:        []string{"-in", "in.wav", "-out", "out.flac", "-fast"},
+			expectedErr: true,
+		},
+		{
+			name:        "Stray argument",
+			args:        []string{"-in", "in.wav", "-out", "out.flac", "extra"},
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parseFlags(tt.args, io.Discard)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectedErr, err)
+			}
+			if err == nil && cfg != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, cfg)
+			}
+		})
+	}
+}
+
+func TestEncodeFile(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "sample.flac")
+	if err := flac.EncodeFile("sample.wav", outputPath); err != nil {
+		t.Fatalf("EncodeFile failed: %v", err)
+	}
+
+	input, err := audio.NewWAVFormat("sample.wav")
+	if err != nil {
+		t.Fatalf("failed to open sample.wav: %v", err)
+	}
+	defer input.Close()
+
+	output, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatalf("failed to open output: %v", err)
+	}
+	defer output.Close()
+	decoder, err := flac.NewDecoder(output)
+	if err != nil {
+		t.Fatalf("NewDecoder failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(readAll(t, decoder), readAll(t, input)) {
+		t.Errorf("decoded samples differ from sample.wav")
+	}
+
+	ratio, err := compressionRatio("sample.wav", outputPath)
+	if err != nil {
+		t.Fatalf("compressionRatio failed: %v", err)
+	}
+	if ratio <= 0 || ratio >= 1 {
+		t.Errorf("expected a compression ratio between 0 and 1, got %v", ratio)
+	}
+}
+
+func TestEncodeFileMissingInput(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "missing.flac")
+	if err := flac.EncodeFile("missing.wav", outputPath); err == nil {
+		t.Fatalf("expected an error for a missing input file")
+	}
+}